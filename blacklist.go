@@ -1,17 +1,34 @@
 package pubsub
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/whyrusleeping/timecache"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // Blacklist is an interface for peer blacklisting.
 type Blacklist interface {
 	Add(peer.ID)
 	Contains(peer.ID) bool
+	Remove(peer.ID)
+	List() []peer.ID
+}
+
+// ExpiringBlacklist is a blacklist that supports per-entry expiry.
+type ExpiringBlacklist interface {
+	Blacklist
+	// AddWithTTL adds a peer to the blacklist for the given duration.
+	AddWithTTL(peer.ID, time.Duration)
 }
 
 // MapBlacklist is a blacklist implementation using a perfect map
@@ -31,28 +48,319 @@ func (b MapBlacklist) Contains(p peer.ID) bool {
 	return ok
 }
 
-// TimeCachedBlacklist is a blacklist implementation using a time cache
+func (b MapBlacklist) Remove(p peer.ID) {
+	delete(b, p)
+}
+
+func (b MapBlacklist) List() []peer.ID {
+	out := make([]peer.ID, 0, len(b))
+	for p := range b {
+		out = append(out, p)
+	}
+	return out
+}
+
+// syncBlacklist wraps a blacklist that is not safe for concurrent use in a lock.
+type syncBlacklist struct {
+	sync.Mutex
+	b Blacklist
+}
+
+func (b *syncBlacklist) Add(p peer.ID) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.b.Add(p)
+}
+
+func (b *syncBlacklist) Contains(p peer.ID) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.b.Contains(p)
+}
+
+func (b *syncBlacklist) Remove(p peer.ID) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.b.Remove(p)
+}
+
+func (b *syncBlacklist) List() []peer.ID {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.b.List()
+}
+
+// expiringSetSweepInterval is the minimum interval between sweeps of an expiringSet.
+const expiringSetSweepInterval = time.Minute
+
+// expiringSet is a set of peers with per-entry expiry; the zero time never expires.
+// Expired entries are dropped when they are looked up, and the whole set is swept for expired
+// entries on insertion, at most once per sweep interval, so that the entries of peers that never
+// come back don't accumulate.
+type expiringSet struct {
+	entries   map[peer.ID]time.Time
+	lastSweep time.Time
+}
+
+func newExpiringSet() *expiringSet {
+	return &expiringSet{entries: make(map[peer.ID]time.Time)}
+}
+
+func (s *expiringSet) add(p peer.ID, expiry time.Time, now time.Time) {
+	s.entries[p] = expiry
+
+	if now.Sub(s.lastSweep) >= expiringSetSweepInterval {
+		s.sweep(now)
+	}
+}
+
+func (s *expiringSet) remove(p peer.ID) bool {
+	_, ok := s.entries[p]
+	delete(s.entries, p)
+	return ok
+}
+
+func (s *expiringSet) contains(p peer.ID, now time.Time) bool {
+	expiry, ok := s.entries[p]
+	if !ok {
+		return false
+	}
+
+	if !expiry.IsZero() && !now.Before(expiry) {
+		delete(s.entries, p)
+		return false
+	}
+
+	return true
+}
+
+func (s *expiringSet) list(now time.Time) []peer.ID {
+	s.sweep(now)
+
+	out := make([]peer.ID, 0, len(s.entries))
+	for p := range s.entries {
+		out = append(out, p)
+	}
+	return out
+}
+
+// sweep drops all the expired entries.
+func (s *expiringSet) sweep(now time.Time) {
+	for p, expiry := range s.entries {
+		if !expiry.IsZero() && !now.Before(expiry) {
+			delete(s.entries, p)
+		}
+	}
+	s.lastSweep = now
+}
+
+// TimeCachedBlacklist is a blacklist implementation with expiring entries; entries added with
+// Add expire after the expiry duration of the blacklist.
 type TimeCachedBlacklist struct {
-	sync.RWMutex
-	tc *timecache.TimeCache
+	sync.Mutex
+	expiry time.Duration
+	peers  *expiringSet
 }
 
+var _ ExpiringBlacklist = (*TimeCachedBlacklist)(nil)
+
 // NewTimeCachedBlacklist creates a new TimeCachedBlacklist with the given expiry duration
 func NewTimeCachedBlacklist(expiry time.Duration) (Blacklist, error) {
-	b := &TimeCachedBlacklist{tc: timecache.NewTimeCache(expiry)}
+	b := &TimeCachedBlacklist{expiry: expiry, peers: newExpiringSet()}
 	return b, nil
 }
 
 func (b *TimeCachedBlacklist) Add(p peer.ID) {
+	b.AddWithTTL(p, b.expiry)
+}
+
+func (b *TimeCachedBlacklist) AddWithTTL(p peer.ID, ttl time.Duration) {
 	b.Lock()
 	defer b.Unlock()
 
-	b.tc.Add(p.String())
+	now := time.Now()
+	b.peers.add(p, now.Add(ttl), now)
 }
 
 func (b *TimeCachedBlacklist) Contains(p peer.ID) bool {
-	b.RLock()
-	defer b.RUnlock()
+	b.Lock()
+	defer b.Unlock()
+
+	return b.peers.contains(p, time.Now())
+}
+
+func (b *TimeCachedBlacklist) Remove(p peer.ID) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.peers.remove(p)
+}
+
+func (b *TimeCachedBlacklist) List() []peer.ID {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.peers.list(time.Now())
+}
+
+// FileBlacklist is a blacklist implementation backed by a JSON file, so that it survives
+// restarts. Entries added with Add never expire, while entries added with AddWithTTL expire
+// after the given duration.
+// The file maps peer IDs to the expiry time of their entry, or null if the entry doesn't
+// expire; it is rewritten whenever the blacklist is modified.
+type FileBlacklist struct {
+	sync.Mutex
+	path  string
+	peers *expiringSet
+}
+
+var _ ExpiringBlacklist = (*FileBlacklist)(nil)
+
+// NewFileBlacklist creates a new FileBlacklist persisting to the file at path, loading the
+// existing entries if the file exists.
+func NewFileBlacklist(path string) (*FileBlacklist, error) {
+	b := &FileBlacklist{path: path, peers: newExpiringSet()}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return b, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var entries map[string]*time.Time
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing blacklist file %s: %w", path, err)
+	}
+
+	for s, expiry := range entries {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID in blacklist file %s: %w", path, err)
+		}
+
+		if expiry != nil {
+			b.peers.entries[p] = *expiry
+		} else {
+			b.peers.entries[p] = time.Time{}
+		}
+	}
+
+	return b, nil
+}
+
+func (b *FileBlacklist) Add(p peer.ID) {
+	b.add(p, time.Time{})
+}
+
+func (b *FileBlacklist) AddWithTTL(p peer.ID, ttl time.Duration) {
+	b.add(p, time.Now().Add(ttl))
+}
+
+func (b *FileBlacklist) add(p peer.ID, expiry time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.peers.add(p, expiry, time.Now())
+	b.save()
+}
+
+func (b *FileBlacklist) Contains(p peer.ID) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.peers.contains(p, time.Now())
+}
+
+func (b *FileBlacklist) Remove(p peer.ID) {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.peers.remove(p) {
+		return
+	}
+
+	b.save()
+}
+
+func (b *FileBlacklist) List() []peer.ID {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.peers.list(time.Now())
+}
+
+// save persists the blacklist, dropping expired entries; the lock must be held.
+func (b *FileBlacklist) save() {
+	entries := make(map[string]*time.Time, len(b.peers.entries))
+	for _, p := range b.peers.list(time.Now()) {
+		var expiry *time.Time
+		if t := b.peers.entries[p]; !t.IsZero() {
+			expiry = &t
+		}
+		entries[p.Pretty()] = expiry
+	}
+
+	data, err := json.Marshal(entries)
+	if err == nil {
+		err = writeFileAtomic(b.path, data)
+	}
+	if err != nil {
+		log.Warningf("error persisting blacklist: %s", err)
+	}
+}
+
+// BlacklistConnectionGater is a connection gater backed by a Blacklist, which refuses
+// connections with blacklisted peers; install it in the host to enforce the pubsub blacklist
+// at the connection layer.
+// The gater is invoked by the network concurrently with the PubSub updating the blacklist,
+// so the blacklist must be safe for concurrent use, like TimeCachedBlacklist and
+// FileBlacklist. A MapBlacklist is wrapped in a lock by the gater, and the PubSub must then
+// use the wrapped blacklist returned by the Blacklist method.
+type BlacklistConnectionGater struct {
+	blacklist Blacklist
+}
+
+var _ connmgr.ConnectionGater = (*BlacklistConnectionGater)(nil)
+
+// NewBlacklistConnectionGater creates a new connection gater backed by the given blacklist;
+// the blacklist returned by the Blacklist method of the gater should be provided to the
+// PubSub with WithBlacklist.
+func NewBlacklistConnectionGater(b Blacklist) *BlacklistConnectionGater {
+	if mb, ok := b.(MapBlacklist); ok {
+		b = &syncBlacklist{b: mb}
+	}
+	return &BlacklistConnectionGater{blacklist: b}
+}
+
+// Blacklist returns the blacklist backing the gater, which is safe for concurrent use.
+func (g *BlacklistConnectionGater) Blacklist() Blacklist {
+	return g.blacklist
+}
+
+func (g *BlacklistConnectionGater) InterceptPeerDial(p peer.ID) bool {
+	return !g.blacklist.Contains(p)
+}
+
+func (g *BlacklistConnectionGater) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return !g.blacklist.Contains(p)
+}
+
+func (g *BlacklistConnectionGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	// we don't know the peer until the security handshake
+	return true
+}
+
+func (g *BlacklistConnectionGater) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.blacklist.Contains(p)
+}
 
-	return b.tc.Has(p.String())
+func (g *BlacklistConnectionGater) InterceptUpgraded(c network.Conn) (bool, control.DisconnectReason) {
+	return !g.blacklist.Contains(c.RemotePeer()), 0
 }
@@ -2,10 +2,23 @@ package pubsub
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	ggio "github.com/gogo/protobuf/io"
+	bhost "github.com/libp2p/go-libp2p-blankhost"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	tnet "github.com/libp2p/go-libp2p-core/test"
+
+	swarmt "github.com/libp2p/go-libp2p-swarm/testing"
 )
 
 func TestMapBlacklist(t *testing.T) {
@@ -18,6 +31,14 @@ func TestMapBlacklist(t *testing.T) {
 		t.Fatal("peer not in the blacklist")
 	}
 
+	if l := b.List(); len(l) != 1 || l[0] != p {
+		t.Fatalf("unexpected blacklist: %v", l)
+	}
+
+	b.Remove(p)
+	if b.Contains(p) {
+		t.Fatal("peer still in the blacklist")
+	}
 }
 
 func TestTimeCachedBlacklist(t *testing.T) {
@@ -32,6 +53,100 @@ func TestTimeCachedBlacklist(t *testing.T) {
 	if !b.Contains(p) {
 		t.Fatal("peer not in the blacklist")
 	}
+
+	b.Remove(p)
+	if b.Contains(p) {
+		t.Fatal("peer still in the blacklist")
+	}
+
+	// entries can have their own expiry
+	p2 := peer.ID("test2")
+	b.Add(p)
+	b.(ExpiringBlacklist).AddWithTTL(p2, 50*time.Millisecond)
+	if len(b.List()) != 2 {
+		t.Fatalf("unexpected blacklist: %v", b.List())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if b.Contains(p2) || !b.Contains(p) {
+		t.Fatal("expected only the entry with the short expiry to have expired")
+	}
+	if l := b.List(); len(l) != 1 || l[0] != p {
+		t.Fatalf("unexpected blacklist: %v", l)
+	}
+}
+
+func TestExpiringSetSweep(t *testing.T) {
+	s := newExpiringSet()
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		s.add(peer.ID(fmt.Sprintf("expiring-%d", i)), now.Add(time.Second), now)
+	}
+	s.add(peer.ID("permanent"), time.Time{}, now)
+
+	// expired entries are swept on insertion, even if they are never looked up
+	later := now.Add(expiringSetSweepInterval)
+	s.add(peer.ID("new"), later.Add(time.Second), later)
+	if len(s.entries) != 2 {
+		t.Fatalf("expected the expired entries to be swept, got %d entries", len(s.entries))
+	}
+	if !s.contains(peer.ID("permanent"), later) || !s.contains(peer.ID("new"), later) {
+		t.Fatal("expected the live entries to be kept")
+	}
+}
+
+func TestFileBlacklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-blacklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "blacklist.json")
+	b, err := NewFileBlacklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := make([]peer.ID, 4)
+	for i := range hosts {
+		hosts[i] = tnet.RandPeerIDFatal(t)
+	}
+
+	b.Add(hosts[0])
+	b.Add(hosts[1])
+	b.AddWithTTL(hosts[2], time.Hour)
+	b.AddWithTTL(hosts[3], 50*time.Millisecond)
+	b.Remove(hosts[1])
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the entries survive a restart, with their expiry
+	b, err = NewFileBlacklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[peer.ID]bool{hosts[0]: true, hosts[2]: true}
+	for _, p := range hosts {
+		if b.Contains(p) != expected[p] {
+			t.Fatalf("unexpected blacklist entry for %s", p)
+		}
+	}
+	if l := b.List(); len(l) != 2 {
+		t.Fatalf("unexpected blacklist: %v", l)
+	}
+
+	// a corrupt file is an error
+	err = ioutil.WriteFile(path, []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewFileBlacklist(path)
+	if err == nil {
+		t.Fatal("expected error loading a corrupt blacklist")
+	}
 }
 
 func TestBlacklist(t *testing.T) {
@@ -123,3 +238,257 @@ func TestBlacklist3(t *testing.T) {
 		t.Fatal("got message from blacklisted peer")
 	}
 }
+
+func TestUnblacklistPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts)
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	psubs[1].BlacklistPeer(hosts[0].ID())
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[0].Publish("test", []byte("message"))
+
+	wctx, wcancel := context.WithTimeout(ctx, 1*time.Second)
+	defer wcancel()
+	_, err = sub.Next(wctx)
+	if err == nil {
+		t.Fatal("got message from blacklisted peer")
+	}
+
+	psubs[1].UnblacklistPeer(hosts[0].ID())
+	time.Sleep(time.Millisecond * 100)
+
+	// the peer has been readmitted
+	assertPeerList(t, psubs[1].ListPeers(""), hosts[0].ID())
+
+	psubs[0].Publish("test", []byte("message"))
+
+	wctx, wcancel = context.WithTimeout(ctx, 1*time.Second)
+	defer wcancel()
+	msg, err := sub.Next(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != "message" {
+		t.Fatal("unexpected message")
+	}
+}
+
+func TestBlacklistPeerWithTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := NewTimeCachedBlacklist(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0]),
+		getPubsub(ctx, hosts[1], WithBlacklist(b), WithBlacklistDisconnect(true)),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	if err := psubs[1].BlacklistPeerWithTTL(hosts[0].ID(), 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	// the peer has been torn down and disconnected
+	if len(psubs[1].ListPeers("")) != 0 {
+		t.Fatal("expected the blacklisted peer to be removed")
+	}
+	if hosts[1].Network().Connectedness(hosts[0].ID()) == network.Connected {
+		t.Fatal("expected the connection to the blacklisted peer to be closed")
+	}
+
+	// and is admitted again once the entry expires
+	time.Sleep(time.Millisecond * 500)
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Millisecond * 100)
+	assertPeerList(t, psubs[1].ListPeers(""), hosts[0].ID())
+
+	psubs[0].Publish("test", []byte("message"))
+
+	wctx, wcancel := context.WithTimeout(ctx, 1*time.Second)
+	defer wcancel()
+	msg, err := sub.Next(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != "message" {
+		t.Fatal("unexpected message")
+	}
+
+	// the default blacklist doesn't support expiry
+	if err := psubs[0].BlacklistPeerWithTTL(hosts[1].ID(), time.Second); err == nil {
+		t.Fatal("expected an error for a blacklist without expiry")
+	}
+}
+
+func TestBlacklistIgnoresSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	ps := getPubsub(ctx, hosts[1])
+	connect(t, hosts[0], hosts[1])
+
+	// a raw peer, with a stream opened before it is blacklisted
+	s, err := hosts[0].NewStream(ctx, hosts[1].ID(), FloodSubID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Reset()
+
+	time.Sleep(time.Millisecond * 100)
+	ps.BlacklistPeer(hosts[0].ID())
+	time.Sleep(time.Millisecond * 100)
+
+	// the subscription it announces while blacklisted is discarded
+	topic := "test"
+	subscribe := true
+	err = ggio.NewDelimitedWriter(s).WriteMsg(&pb.RPC{
+		Subscriptions: []*pb.RPC_SubOpts{{Subscribe: &subscribe, Topicid: &topic}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	res := make(chan bool)
+	ps.eval <- func() {
+		_, ok := ps.topics[topic][hosts[0].ID()]
+		res <- ok
+	}
+	if <-res {
+		t.Fatal("expected the subscription of the blacklisted peer to be discarded")
+	}
+}
+
+func TestBlacklistDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0]),
+		getPubsub(ctx, hosts[1], WithBlacklistDisconnect(true)),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	time.Sleep(time.Millisecond * 100)
+	psubs[1].BlacklistPeer(hosts[0].ID())
+	time.Sleep(time.Millisecond * 100)
+
+	if hosts[1].Network().Connectedness(hosts[0].ID()) == network.Connected {
+		t.Fatal("expected the connection to the blacklisted peer to be closed")
+	}
+
+	// and it is closed again when the peer reconnects
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Millisecond * 100)
+
+	if hosts[1].Network().Connectedness(hosts[0].ID()) == network.Connected {
+		t.Fatal("expected the connection to the blacklisted peer to be closed")
+	}
+}
+
+func TestBlacklistConnectionGater(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := NewTimeCachedBlacklist(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gater := NewBlacklistConnectionGater(b)
+	if gater.Blacklist() != b {
+		t.Fatal("expected the gater to use the blacklist as is")
+	}
+	hosts := []host.Host{
+		bhost.NewBlankHost(swarmt.GenSwarm(t, ctx)),
+		bhost.NewBlankHost(swarmt.GenSwarm(t, ctx, swarmt.OptConnGater(gater))),
+		bhost.NewBlankHost(swarmt.GenSwarm(t, ctx)),
+	}
+	ps := getPubsub(ctx, hosts[1], WithBlacklist(b))
+
+	b.Add(hosts[0].ID())
+
+	// connections with the blacklisted peer are refused in both directions
+	err = hosts[0].Connect(ctx, hosts[1].Peerstore().PeerInfo(hosts[1].ID()))
+	if err == nil {
+		t.Fatal("expected inbound connection from blacklisted peer to be refused")
+	}
+	err = hosts[1].Connect(ctx, hosts[0].Peerstore().PeerInfo(hosts[0].ID()))
+	if err == nil {
+		t.Fatal("expected outbound connection to blacklisted peer to be refused")
+	}
+
+	// other peers are unaffected
+	connect(t, hosts[1], hosts[2])
+
+	// and peers blacklisted through pubsub are refused too
+	ps.BlacklistPeer(hosts[2].ID())
+	time.Sleep(time.Millisecond * 100)
+	for _, c := range hosts[1].Network().ConnsToPeer(hosts[2].ID()) {
+		c.Close()
+	}
+	time.Sleep(time.Millisecond * 100)
+	err = hosts[2].Connect(ctx, hosts[1].Peerstore().PeerInfo(hosts[1].ID()))
+	if err == nil {
+		t.Fatal("expected connection from peer blacklisted through pubsub to be refused")
+	}
+
+	// until the peer is removed from the blacklist
+	ps.UnblacklistPeer(hosts[0].ID())
+	time.Sleep(time.Millisecond * 100)
+	connect(t, hosts[0], hosts[1])
+}
+
+func TestBlacklistConnectionGaterMapBlacklist(t *testing.T) {
+	// the map blacklist is wrapped in a lock, as the gater is invoked concurrently
+	gater := NewBlacklistConnectionGater(NewMapBlacklist())
+	b := gater.Blacklist()
+	if _, ok := b.(*syncBlacklist); !ok {
+		t.Fatalf("expected the map blacklist to be wrapped, got %T", b)
+	}
+
+	p := tnet.RandPeerIDFatal(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			gater.InterceptPeerDial(p)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		b.Add(p)
+		b.Remove(p)
+	}
+	<-done
+
+	b.Add(p)
+	if gater.InterceptPeerDial(p) {
+		t.Fatal("expected the gater to refuse the blacklisted peer")
+	}
+}
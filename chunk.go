@@ -0,0 +1,221 @@
+package pubsub
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var (
+	// ChunkReassemblyTimeout is the time a partially received chunked message is kept waiting
+	// for its remaining fragments.
+	ChunkReassemblyTimeout = time.Minute
+
+	// ChunkReassemblyMemoryLimit is the maximum total size of partially received chunked
+	// messages per subscription; it also bounds the size of chunked messages that can be
+	// reassembled. When the limit is exceeded, the oldest partial messages are dropped.
+	ChunkReassemblyMemoryLimit = 64 << 20
+)
+
+// WithChunking is a topic option that enables chunking of large messages: messages with data
+// larger than chunkSize are published as a sequence of signed fragments of at most chunkSize
+// bytes, sharing the sha256 hash of the whole message data as root.
+// Subscriptions from the topic reassemble fragmented messages, verify them against the root
+// and deliver the whole message once all fragments have been received.
+//
+// Note that peers that don't enable chunking see the individual fragments, and that fragments
+// are subject to the peer outbound queue and subscription buffer limits like any other message;
+// chunk sizes should be chosen so that messages are split in a moderate number of fragments.
+//
+// Reassembly happens in each subscription, after validation and delivery. Topic validators
+// only ever see the individual fragments, never the reassembled message, so validation of the
+// whole message data is up to the subscriber. Likewise, ChunkReassemblyMemoryLimit bounds the
+// partial messages of each subscription rather than of the PubSub, so the memory held for
+// reassembly grows with the number of subscriptions to chunked topics.
+// Reassembled messages carry the header of the first fragment without a signature, as the
+// signatures cover the individual fragments. With strict signature verification (the default),
+// every fragment is verified and commits to the root, so the reassembled data is authenticated
+// by the author's fragment signatures; otherwise reassembled messages are unauthenticated, like
+// any unsigned message.
+func WithChunking(chunkSize int) TopicOpt {
+	return func(t *Topic) error {
+		if chunkSize <= 0 {
+			return fmt.Errorf("chunk size must be positive")
+		}
+		t.chunkSize = chunkSize
+		return nil
+	}
+}
+
+// chunkData splits data into fragments of at most chunkSize bytes, returning the fragment data
+// along with their chunk headers.
+func chunkData(data []byte, chunkSize int) ([][]byte, []*pb.MessageChunk) {
+	root := sha256.Sum256(data)
+	count := (len(data) + chunkSize - 1) / chunkSize
+	size := uint64(len(data))
+
+	frags := make([][]byte, 0, count)
+	chunks := make([]*pb.MessageChunk, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		index := uint32(i)
+		total := uint32(count)
+		frags = append(frags, data[i*chunkSize:end])
+		chunks = append(chunks, &pb.MessageChunk{
+			Root:  root[:],
+			Index: &index,
+			Count: &total,
+			Size_: &size,
+		})
+	}
+
+	return frags, chunks
+}
+
+type chunkKey struct {
+	from string
+	root string
+}
+
+type partialMessage struct {
+	key      chunkKey
+	first    *Message
+	frags    [][]byte
+	count    uint32
+	size     uint64
+	received uint32
+	bytes    int
+	expire   time.Time
+}
+
+// chunkReassembler reassembles chunked messages for a subscription.
+type chunkReassembler struct {
+	timeout  time.Duration
+	maxBytes int
+
+	bytes   int
+	partial map[chunkKey]*list.Element
+	order   *list.List
+}
+
+func newChunkReassembler(timeout time.Duration, maxBytes int) *chunkReassembler {
+	return &chunkReassembler{
+		timeout:  timeout,
+		maxBytes: maxBytes,
+		partial:  make(map[chunkKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Add adds a fragment, returning the whole message if it is complete and valid.
+func (r *chunkReassembler) Add(msg *Message) *Message {
+	now := time.Now()
+	r.expire(now)
+
+	chunk := msg.GetChunk()
+	count := chunk.GetCount()
+	size := chunk.GetSize_()
+	if count == 0 || chunk.GetIndex() >= count || uint64(count) > size || size > uint64(r.maxBytes) ||
+		len(msg.GetData()) == 0 || uint64(len(msg.GetData())) > size || len(chunk.GetRoot()) != sha256.Size {
+		log.Debugf("dropping invalid message fragment from %s", msg.GetFrom())
+		return nil
+	}
+
+	key := chunkKey{from: string(msg.GetFrom()), root: string(chunk.GetRoot())}
+
+	var pm *partialMessage
+	e, ok := r.partial[key]
+	if ok {
+		pm = e.Value.(*partialMessage)
+		if pm.count != count || pm.size != size {
+			log.Debugf("dropping inconsistent message fragment from %s", msg.GetFrom())
+			return nil
+		}
+	} else {
+		pm = &partialMessage{
+			key:    key,
+			frags:  make([][]byte, count),
+			count:  count,
+			size:   size,
+			expire: now.Add(r.timeout),
+		}
+		r.partial[key] = r.order.PushBack(pm)
+	}
+
+	index := chunk.GetIndex()
+	if pm.frags[index] != nil {
+		return nil
+	}
+
+	pm.frags[index] = msg.GetData()
+	pm.received++
+	pm.bytes += len(msg.GetData())
+	r.bytes += len(msg.GetData())
+	if index == 0 {
+		pm.first = msg
+	}
+
+	if pm.received < pm.count {
+		r.evict()
+		return nil
+	}
+
+	r.remove(key)
+
+	data := bytes.Join(pm.frags, nil)
+	root := sha256.Sum256(data)
+	if uint64(len(data)) != pm.size || !bytes.Equal(root[:], chunk.GetRoot()) {
+		log.Debugf("dropping chunked message from %s: root mismatch", msg.GetFrom())
+		return nil
+	}
+
+	first := *pm.first.Message
+	first.Data = data
+	first.Chunk = nil
+	first.Signature = nil
+	first.Key = nil
+
+	return &Message{Message: &first, ReceivedFrom: msg.ReceivedFrom, ValidatorData: pm.first.ValidatorData}
+}
+
+func (r *chunkReassembler) remove(key chunkKey) {
+	e, ok := r.partial[key]
+	if !ok {
+		return
+	}
+
+	pm := r.order.Remove(e).(*partialMessage)
+	delete(r.partial, key)
+	r.bytes -= pm.bytes
+}
+
+// expire drops partial messages that have timed out.
+func (r *chunkReassembler) expire(now time.Time) {
+	for e := r.order.Front(); e != nil; e = r.order.Front() {
+		pm := e.Value.(*partialMessage)
+		if pm.expire.After(now) {
+			return
+		}
+		log.Debugf("dropping partial message from %s: reassembly timed out", peer.ID(pm.key.from))
+		r.remove(pm.key)
+	}
+}
+
+// evict drops the oldest partial messages until we are within the memory limit.
+func (r *chunkReassembler) evict() {
+	for r.bytes > r.maxBytes {
+		pm := r.order.Front().Value.(*partialMessage)
+		log.Debugf("dropping partial message from %s: reassembly memory limit exceeded", peer.ID(pm.key.from))
+		r.remove(pm.key)
+	}
+}
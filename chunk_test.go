@@ -0,0 +1,215 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func makeChunkTestMessages(from string, data []byte, chunkSize int) []*Message {
+	frags, chunks := chunkData(data, chunkSize)
+	msgs := make([]*Message, 0, len(frags))
+	for i := range frags {
+		msgs = append(msgs, &Message{Message: &pb.Message{
+			From:     []byte(from),
+			Data:     frags[i],
+			TopicIDs: []string{"test"},
+			Chunk:    chunks[i],
+		}})
+	}
+	return msgs
+}
+
+func TestChunkReassembly(t *testing.T) {
+	r := newChunkReassembler(time.Minute, 1024)
+
+	data := make([]byte, 500)
+	rand.Read(data)
+	msgs := makeChunkTestMessages("a", data, 100)
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 fragments, got %d", len(msgs))
+	}
+
+	// fragments may arrive out of order and be duplicated
+	for _, i := range []int{3, 0, 4, 0, 1} {
+		if r.Add(msgs[i]) != nil {
+			t.Fatal("unexpected complete message")
+		}
+	}
+
+	msg := r.Add(msgs[2])
+	if msg == nil {
+		t.Fatal("expected complete message")
+	}
+	if !bytes.Equal(msg.Data, data) || msg.Chunk != nil {
+		t.Fatal("got wrong message")
+	}
+	if len(r.partial) != 0 || r.bytes != 0 {
+		t.Fatal("expected reassembly state to be cleared")
+	}
+
+	// a tampered fragment fails the root check
+	msgs = makeChunkTestMessages("a", data, 100)
+	msgs[1].Data = append([]byte(nil), msgs[1].Data...)
+	msgs[1].Data[0]++
+	for _, m := range msgs {
+		if r.Add(m) != nil {
+			t.Fatal("tampered message was reassembled")
+		}
+	}
+
+	// messages over the memory limit are rejected
+	msgs = makeChunkTestMessages("a", make([]byte, 2048), 100)
+	if r.Add(msgs[0]) != nil || len(r.partial) != 0 {
+		t.Fatal("expected oversized message to be rejected")
+	}
+}
+
+func TestChunkReassemblyLimits(t *testing.T) {
+	r := newChunkReassembler(100*time.Millisecond, 1024)
+
+	a := makeChunkTestMessages("a", make([]byte, 1000), 100)
+	b := makeChunkTestMessages("b", make([]byte, 1000), 100)
+
+	// exceeding the memory limit drops the oldest partial message
+	for _, m := range a[:8] {
+		r.Add(m)
+	}
+	for _, m := range b[:3] {
+		r.Add(m)
+	}
+	if len(r.partial) != 1 || r.bytes != 300 {
+		t.Fatalf("expected oldest partial message to be dropped; got %d partial, %d bytes", len(r.partial), r.bytes)
+	}
+
+	// and partial messages time out
+	time.Sleep(200 * time.Millisecond)
+	r.Add(a[0])
+	if len(r.partial) != 1 || r.bytes != 100 {
+		t.Fatalf("expected timed out partial message to be dropped; got %d partial, %d bytes", len(r.partial), r.bytes)
+	}
+}
+
+func TestTopicChunking(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 5)
+	psubs := getGossipsubs(ctx, hosts)
+	topics := getTopics(psubs, "test", WithChunking(1<<18))
+	sparseConnect(t, hosts)
+
+	var subs []*Subscription
+	for _, topic := range topics {
+		sub, err := topic.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	time.Sleep(time.Second)
+
+	// larger than the default max message size
+	data := make([]byte, 3<<20/2)
+	rand.Read(data)
+
+	for i := 0; i < 2; i++ {
+		err := topics[i].Publish(ctx, data[:len(data)-i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sub := range subs {
+		for i := 0; i < 2; i++ {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg.Data, data[:len(msg.Data)]) || len(msg.Data) < len(data)-1 {
+				t.Fatal("got wrong message")
+			}
+		}
+	}
+
+	// small messages are not chunked
+	err := topics[0].Publish(ctx, []byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range subs {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) != "small" {
+			t.Fatal("got wrong message")
+		}
+	}
+}
+
+func TestChunkedSubscriptionConcurrentNext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	psubs := getGossipsubs(ctx, hosts)
+	topic := getTopics(psubs, "test", WithChunking(1024))[0]
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fragments fit in the subscription buffer
+	const count = 5
+	for i := 0; i < count; i++ {
+		data := make([]byte, 4096)
+		rand.Read(data)
+		err := topic.Publish(ctx, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// reassembly is safe with concurrent calls to Next
+	wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer wcancel()
+
+	results := make(chan *Message, count)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := sub.Next(wctx)
+				if err != nil {
+					return
+				}
+				results <- msg
+				if len(results) == count {
+					wcancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(results) != count {
+		t.Fatalf("expected %d reassembled messages, got %d", count, len(results))
+	}
+	close(results)
+	for msg := range results {
+		if len(msg.Data) != 4096 || msg.Chunk != nil {
+			t.Fatal("got wrong message")
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"io"
+	"time"
 
 	"github.com/libp2p/go-libp2p-core/helpers"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -13,6 +14,7 @@ import (
 	proto "github.com/gogo/protobuf/proto"
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
+	ma "github.com/multiformats/go-multiaddr"
 	ms "github.com/multiformats/go-multistream"
 )
 
@@ -29,11 +31,42 @@ func (p *PubSub) getHelloPacket() *RPC {
 	return &rpc
 }
 
+// newReader returns an RPC reader for the stream, according to the negotiated protocol.
+func (p *PubSub) newReader(s network.Stream) rpcReader {
+	if p.isCompressed(s.Protocol()) {
+		return newCompressedReader(s, p.compression, p.maxMessageSize)
+	}
+	return newDelimitedReader(s, p.maxMessageSize)
+}
+
+// acceptPeer returns true if the peer at the other end of the stream is admitted by the
+// peer filter.
+func (p *PubSub) acceptPeer(s network.Stream) bool {
+	if p.peerFilter == nil {
+		return true
+	}
+
+	pid := s.Conn().RemotePeer()
+
+	var addrs []ma.Multiaddr
+	for _, c := range p.host.Network().ConnsToPeer(pid) {
+		addrs = append(addrs, c.RemoteMultiaddr())
+	}
+
+	return p.peerFilter(pid, p.routerProtocol(s.Protocol()), addrs)
+}
+
 func (p *PubSub) handleNewStream(s network.Stream) {
-	r := ggio.NewDelimitedReader(s, p.maxMessageSize)
+	if !p.acceptPeer(s) {
+		log.Debugf("resetting stream from filtered peer %s", s.Conn().RemotePeer())
+		s.Reset()
+		return
+	}
+
+	r := p.newReader(s)
 	for {
 		rpc := new(RPC)
-		err := r.ReadMsg(&rpc.RPC)
+		err := r.ReadRPC(rpc)
 		if err != nil {
 			if err != io.EOF {
 				s.Reset()
@@ -57,9 +90,10 @@ func (p *PubSub) handleNewStream(s network.Stream) {
 	}
 }
 
-func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing <-chan *RPC) {
-	s, err := p.host.NewStream(p.ctx, pid, p.rt.Protocols()...)
+func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing *rpcQueue) {
+	s, err := p.host.NewStream(p.ctx, pid, p.protocols()...)
 	if err != nil {
+		p.writers.Done()
 		log.Warning("opening new stream to peer: ", err, pid)
 
 		var ch chan peer.ID
@@ -76,6 +110,18 @@ func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing <-chan
 		return
 	}
 
+	if !p.acceptPeer(s) {
+		p.writers.Done()
+		log.Debugf("not admitting filtered peer %s", pid)
+		s.Reset()
+
+		select {
+		case p.newPeerError <- pid:
+		case <-ctx.Done():
+		}
+		return
+	}
+
 	go p.handleSendingMessages(ctx, s, outgoing)
 	go p.handlePeerEOF(ctx, s)
 	select {
@@ -85,7 +131,7 @@ func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing <-chan
 }
 
 func (p *PubSub) handlePeerEOF(ctx context.Context, s network.Stream) {
-	r := ggio.NewDelimitedReader(s, p.maxMessageSize)
+	r := p.newReader(s)
 	rpc := new(RPC)
 	for {
 		err := r.ReadMsg(&rpc.RPC)
@@ -100,9 +146,17 @@ func (p *PubSub) handlePeerEOF(ctx context.Context, s network.Stream) {
 	}
 }
 
-func (p *PubSub) handleSendingMessages(ctx context.Context, s network.Stream, outgoing <-chan *RPC) {
-	bufw := bufio.NewWriter(s)
-	wc := ggio.NewDelimitedWriter(bufw)
+func (p *PubSub) handleSendingMessages(ctx context.Context, s network.Stream, outgoing *rpcQueue) {
+	defer p.writers.Done()
+
+	cw := &countingWriter{w: s}
+	bufw := bufio.NewWriter(cw)
+	var wc ggio.Writer
+	if p.isCompressed(s.Protocol()) {
+		wc = newCompressedWriter(bufw, p.compression)
+	} else {
+		wc = newDelimitedWriter(bufw)
+	}
 
 	writeMsg := func(msg proto.Message) error {
 		err := wc.WriteMsg(msg)
@@ -113,24 +167,264 @@ func (p *PubSub) handleSendingMessages(ctx context.Context, s network.Stream, ou
 		return bufw.Flush()
 	}
 
+	pid := s.Conn().RemotePeer()
+	shaper := p.newPeerShaper()
+
+	// shaped returns true if the RPC should be dropped because shaping would delay it
+	// beyond the maximum shaping delay; control RPCs are never dropped.
+	shaped := func(e rpcEntry) bool {
+		if shaper == nil || e.prio == rpcPriorityControl {
+			return false
+		}
+
+		delay := time.Since(e.queued) + shaper.Delay()
+		if delay <= OutboundShapingMaxDelay {
+			return false
+		}
+
+		log.Debugf("dropping message to peer %s: shaping delay exceeded", pid)
+		p.tracer.ShapeRPC(e.rpc, pid, delay)
+		return true
+	}
+
+	pop := func() (rpcEntry, bool) {
+		for {
+			e, ok, _ := outgoing.tryPop()
+			if !ok || !shaped(e) {
+				return e, ok
+			}
+		}
+	}
+
 	defer helpers.FullClose(s)
+	var next *rpcEntry
 	for {
-		select {
-		case rpc, ok := <-outgoing:
+		var e rpcEntry
+		if next != nil {
+			e = *next
+		} else {
+			var ok bool
+			e, ok = outgoing.Pop(ctx)
 			if !ok {
 				return
 			}
+			if shaped(e) {
+				continue
+			}
+		}
 
-			err := writeMsg(&rpc.RPC)
+		var rpc *RPC
+		rpc, next = p.coalesceRPCs(e.rpc, pop)
+
+		cw.n = 0
+		for _, frame := range p.splitRPC(rpc) {
+			err := writeMsg(rpcFrame{frame})
 			if err != nil {
 				s.Reset()
-				log.Infof("writing message to %s: %s", s.Conn().RemotePeer(), err)
+				log.Infof("writing message to %s: %s", pid, err)
 				return
 			}
-		case <-ctx.Done():
+			p.tracer.WriteRPC(frame, pid)
+		}
+
+		outgoing.observeDelay(time.Since(e.queued))
+
+		// pay for the bytes we have written before writing again
+		if shaper != nil {
+			err := shaper.Wait(ctx, cw.n)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += n
+	return n, err
+}
+
+// coalesceRPCs merges queued RPCs into rpc while the merged RPC fits in the maximum message
+// size; it returns the merged RPC along with the next queued RPC if that didn't fit.
+func (p *PubSub) coalesceRPCs(rpc *RPC, pop func() (rpcEntry, bool)) (*RPC, *rpcEntry) {
+	size := rpc.size()
+	merged := false
+	for size < p.maxMessageSize {
+		next, ok := pop()
+		if !ok {
+			break
+		}
+
+		nsize := next.rpc.size()
+		if size+nsize > p.maxMessageSize || !canMergeRPC(rpc, next.rpc) {
+			return rpc, &next
+		}
+
+		// RPCs are shared between peers, so we merge into a new one
+		if !merged {
+			rpc = mergeRPC(new(RPC), rpc)
+			merged = true
+		}
+		mergeRPC(rpc, next.rpc)
+		size += nsize
+	}
+
+	return rpc, nil
+}
+
+// canMergeRPC returns true if merging src into dst preserves the semantics of the RPCs;
+// the receiver processes GRAFTs before PRUNEs, so a GRAFT can't follow a PRUNE.
+func canMergeRPC(dst, src *RPC) bool {
+	return len(dst.GetControl().GetPrune()) == 0 || len(src.GetControl().GetGraft()) == 0
+}
+
+func mergeRPC(dst, src *RPC) *RPC {
+	dst.Subscriptions = append(dst.Subscriptions, src.Subscriptions...)
+	for i, m := range src.Publish {
+		dst.appendMessage(m, src.encodedMessage(i), src.messageHops(i))
+	}
+
+	ctl := src.GetControl()
+	if ctl == nil {
+		return dst
+	}
+
+	if dst.Control == nil {
+		dst.Control = new(pb.ControlMessage)
+	}
+	dst.Control.Ihave = append(dst.Control.Ihave, ctl.Ihave...)
+	dst.Control.Iwant = append(dst.Control.Iwant, ctl.Iwant...)
+	dst.Control.Graft = append(dst.Control.Graft, ctl.Graft...)
+	dst.Control.Prune = append(dst.Control.Prune, ctl.Prune...)
+	dst.Control.Idontwant = append(dst.Control.Idontwant, ctl.Idontwant...)
+
+	return dst
+}
+
+// splitRPC splits rpc into RPCs that fit in the maximum message size, so that the receiver
+// doesn't reset the stream; parts that don't fit in an RPC of their own are dropped.
+func (p *PubSub) splitRPC(rpc *RPC) []*RPC {
+	limit := p.maxMessageSize
+	if rpc.size() <= limit {
+		return []*RPC{rpc}
+	}
+
+	// reserve room for the hop counts, which are encoded after the other fields; the hop
+	// counts of any part are no larger than those of the whole RPC
+	if h := rpc.hopsField(); h != nil {
+		limit -= h.Size()
+	}
+
+	var res []*RPC
+	out := new(RPC)
+	size := 0
+
+	add := func(what string, fsize int, control bool, fn func(out *RPC)) {
+		// the cost of the field, including the tag and length prefix, and the control
+		// message envelope if it's not there yet
+		cost := func() int {
+			cost := 1 + sovRPC(fsize) + fsize
+			if control && out.Control == nil {
+				cost += 1 + sovRPC(limit)
+			}
+			return cost
+		}
+
+		// the cost of the field in an RPC of its own
+		standalone := 1 + sovRPC(fsize) + fsize
+		if control {
+			standalone += 1 + sovRPC(limit)
+		}
+		if standalone > limit {
+			log.Warningf("dropping oversized %s (%d bytes)", what, fsize)
 			return
 		}
+
+		if size+cost() > limit {
+			res = append(res, out)
+			out = new(RPC)
+			size = 0
+		}
+
+		size += cost()
+		if control && out.Control == nil {
+			out.Control = new(pb.ControlMessage)
+		}
+		fn(out)
+	}
+
+	for _, sub := range rpc.Subscriptions {
+		sub := sub
+		add("subscription", sub.Size(), false, func(out *RPC) {
+			out.Subscriptions = append(out.Subscriptions, sub)
+		})
+	}
+
+	for i, msg := range rpc.Publish {
+		msg, enc, hops := msg, rpc.encodedMessage(i), rpc.messageHops(i)
+		add("message", rpc.messageSize(i), false, func(out *RPC) {
+			out.appendMessage(msg, enc, hops)
+		})
+	}
+
+	ctl := rpc.GetControl()
+	for _, ihave := range ctl.GetIhave() {
+		ihave := ihave
+		add("IHAVE", ihave.Size(), true, func(out *RPC) {
+			out.Control.Ihave = append(out.Control.Ihave, ihave)
+		})
+	}
+
+	for _, iwant := range ctl.GetIwant() {
+		iwant := iwant
+		add("IWANT", iwant.Size(), true, func(out *RPC) {
+			out.Control.Iwant = append(out.Control.Iwant, iwant)
+		})
+	}
+
+	for _, graft := range ctl.GetGraft() {
+		graft := graft
+		add("GRAFT", graft.Size(), true, func(out *RPC) {
+			out.Control.Graft = append(out.Control.Graft, graft)
+		})
+	}
+
+	for _, prune := range ctl.GetPrune() {
+		prune := prune
+		add("PRUNE", prune.Size(), true, func(out *RPC) {
+			out.Control.Prune = append(out.Control.Prune, prune)
+		})
+	}
+
+	for _, idontwant := range ctl.GetIdontwant() {
+		idontwant := idontwant
+		add("IDONTWANT", idontwant.Size(), true, func(out *RPC) {
+			out.Control.Idontwant = append(out.Control.Idontwant, idontwant)
+		})
+	}
+
+	if size > 0 {
+		res = append(res, out)
+	}
+
+	return res
+}
+
+// sovRPC returns the size of the uvarint encoding of x.
+func sovRPC(x int) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
 	}
+	return n
 }
 
 func rpcWithSubs(subs ...*pb.RPC_SubOpts) *RPC {
@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestSplitRPC(t *testing.T) {
+	p := &PubSub{maxMessageSize: 1000}
+
+	rpc := new(RPC)
+	for i := 0; i < 10; i++ {
+		rpc.Publish = append(rpc.Publish, &pb.Message{Data: make([]byte, 300), Seqno: []byte{byte(i)}})
+	}
+	// a message that doesn't fit in an RPC of its own is dropped
+	rpc.Publish = append(rpc.Publish, &pb.Message{Data: make([]byte, 1000)})
+
+	topic := "test"
+	rpc.Control = &pb.ControlMessage{
+		Ihave: []*pb.ControlIHave{{TopicID: &topic, MessageIDs: []string{"a", "b"}}},
+		Graft: []*pb.ControlGraft{{TopicID: &topic}},
+	}
+
+	frames := p.splitRPC(rpc)
+
+	var msgs []*pb.Message
+	var ctl pb.ControlMessage
+	for _, frame := range frames {
+		if frame.Size() > p.maxMessageSize {
+			t.Fatalf("frame exceeds max message size: %d", frame.Size())
+		}
+		msgs = append(msgs, frame.Publish...)
+		mergeRPC(&RPC{RPC: pb.RPC{Control: &ctl}}, frame)
+	}
+
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(frames))
+	}
+	if len(msgs) != 10 {
+		t.Fatalf("expected 10 messages, got %d", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.Seqno[0] != byte(i) {
+			t.Fatal("messages out of order")
+		}
+	}
+	if len(ctl.Ihave) != 1 || len(ctl.Graft) != 1 {
+		t.Fatal("expected control messages to be preserved")
+	}
+
+	// small RPCs are not split
+	small := rpcWithMessages(&pb.Message{Data: []byte("small")})
+	if frames := p.splitRPC(small); len(frames) != 1 || frames[0] != small {
+		t.Fatal("expected small RPC to be sent as is")
+	}
+}
+
+func TestCoalesceRPCs(t *testing.T) {
+	p := &PubSub{maxMessageSize: 1000}
+	q := newRPCQueue(32)
+
+	topic := "test"
+	first := rpcWithMessages(&pb.Message{Data: make([]byte, 100)})
+	q.Push(rpcWithMessages(&pb.Message{Data: make([]byte, 100)}), rpcPriorityForward)
+	q.Push(rpcWithControl(nil, nil, nil, nil, []*pb.ControlPrune{{TopicID: &topic}}), rpcPriorityControl)
+	q.Push(rpcWithControl(nil, nil, nil, []*pb.ControlGraft{{TopicID: &topic}}, nil), rpcPriorityControl)
+
+	pop := func() (rpcEntry, bool) {
+		e, ok, _ := q.tryPop()
+		return e, ok
+	}
+
+	// control is dequeued first, and the GRAFT can't follow the PRUNE
+	rpc, next := p.coalesceRPCs(first, pop)
+	if len(rpc.Publish) != 1 || len(rpc.GetControl().GetPrune()) != 1 {
+		t.Fatal("expected queued PRUNE to be merged")
+	}
+	if len(next.rpc.GetControl().GetGraft()) != 1 {
+		t.Fatal("expected GRAFT to be sent in the next frame")
+	}
+
+	// the original RPC is unmodified, as it may be shared with other peers
+	if len(first.Publish) != 1 || first.Control != nil {
+		t.Fatal("coalescing modified the queued RPC")
+	}
+
+	// and the merged RPC fits in the max message size
+	for i := 0; i < 10; i++ {
+		q.Push(rpcWithMessages(&pb.Message{Data: make([]byte, 300)}), rpcPriorityForward)
+	}
+
+	rpc, next = p.coalesceRPCs(next.rpc, pop)
+	if len(rpc.Publish) != 3 || len(rpc.GetControl().GetGraft()) != 1 || next == nil {
+		t.Fatalf("expected GRAFT and 3 messages to be merged, got %d messages", len(rpc.Publish))
+	}
+	if rpc.Size() > p.maxMessageSize {
+		t.Fatalf("merged RPC exceeds max message size: %d", rpc.Size())
+	}
+}
+
+func TestOversizedRPC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts, WithMaxMessageSize(1<<16))
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// an RPC bundling messages beyond the max message size, as in IWANT responses
+	var msgs []*pb.Message
+	for i := 0; i < 10; i++ {
+		msgs = append(msgs, &pb.Message{
+			From:     []byte(hosts[0].ID()),
+			Data:     make([]byte, 1<<13),
+			Seqno:    []byte(fmt.Sprintf("seqno-%d", i)),
+			TopicIDs: []string{"test"},
+		})
+		err := signMessage(hosts[0].ID(), psubs[0].signer, msgs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	psubs[0].eval <- func() {
+		psubs[0].peers[hosts[1].ID()].Push(rpcWithMessages(msgs...), rpcPriorityGossip)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+// Compression is a block compression scheme for RPC frames.
+//
+// Compression is negotiated per peer: when enabled, we additionally speak a variant of each
+// router protocol with the compression name appended to the protocol ID (e.g.
+// /meshsub/1.0.0/snappy), and prefer it when opening streams. Peers that only speak the
+// uncompressed protocols transparently fall back to them.
+type Compression interface {
+	// Name returns the name of the compression scheme, which is used as the protocol ID suffix.
+	Name() string
+	// Compress returns the compressed block for src, using dst as the buffer if it is large enough.
+	Compress(dst, src []byte) []byte
+	// DecompressedLen returns the length of the decompressed block for src, without decompressing it.
+	DecompressedLen(src []byte) (int, error)
+	// Decompress returns the decompressed block for src, using dst as the buffer if it is large enough.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// SnappyCompression is the snappy block compression scheme.
+type SnappyCompression struct{}
+
+var _ Compression = SnappyCompression{}
+
+func (SnappyCompression) Name() string {
+	return "snappy"
+}
+
+func (SnappyCompression) Compress(dst, src []byte) []byte {
+	return snappy.Encode(dst, src)
+}
+
+func (SnappyCompression) DecompressedLen(src []byte) (int, error) {
+	return snappy.DecodedLen(src)
+}
+
+func (SnappyCompression) Decompress(dst, src []byte) ([]byte, error) {
+	return snappy.Decode(dst, src)
+}
+
+// WithCompression is an option to enable compression of RPC frames with peers that support it.
+// The decompressed size of received frames is limited to the maximum message size.
+func WithCompression(c Compression) Option {
+	return func(ps *PubSub) error {
+		ps.compression = c
+		return nil
+	}
+}
+
+// compressedProtocol returns the protocol ID of the compressed variant of id.
+func compressedProtocol(id protocol.ID, c Compression) protocol.ID {
+	return protocol.ID(fmt.Sprintf("%s/%s", id, c.Name()))
+}
+
+// protocols returns the protocols we speak, with the compressed variants first.
+func (p *PubSub) protocols() []protocol.ID {
+	protos := p.rt.Protocols()
+	if p.compression == nil {
+		return protos
+	}
+
+	res := make([]protocol.ID, 0, 2*len(protos))
+	for _, id := range protos {
+		res = append(res, compressedProtocol(id, p.compression))
+	}
+	return append(res, protos...)
+}
+
+// isCompressed returns true if id is the compressed variant of a router protocol.
+func (p *PubSub) isCompressed(id protocol.ID) bool {
+	return p.compression != nil && strings.HasSuffix(string(id), "/"+p.compression.Name())
+}
+
+// routerProtocol returns the router protocol for a negotiated protocol, stripping the
+// compression suffix.
+func (p *PubSub) routerProtocol(id protocol.ID) protocol.ID {
+	if !p.isCompressed(id) {
+		return id
+	}
+	return protocol.ID(strings.TrimSuffix(string(id), "/"+p.compression.Name()))
+}
+
+// compressedWriter writes uvarint length-delimited compressed protobuf frames.
+type compressedWriter struct {
+	w   io.Writer
+	c   Compression
+	raw frameBuffer
+	buf []byte
+	len [binary.MaxVarintLen64]byte
+}
+
+func newCompressedWriter(w io.Writer, c Compression) *compressedWriter {
+	return &compressedWriter{w: w, c: c}
+}
+
+func (w *compressedWriter) WriteMsg(msg proto.Message) error {
+	data, err := w.raw.marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	w.buf = w.c.Compress(w.buf[:cap(w.buf)], data)
+
+	n := binary.PutUvarint(w.len[:], uint64(len(w.buf)))
+	_, err = w.w.Write(w.len[:n])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(w.buf)
+	return err
+}
+
+// compressedReader reads uvarint length-delimited compressed protobuf frames, limiting the
+// decompressed size of frames to maxSize.
+type compressedReader struct {
+	r       *bufio.Reader
+	c       Compression
+	maxSize int
+	buf     []byte
+	data    []byte
+}
+
+func newCompressedReader(r io.Reader, c Compression, maxSize int) *compressedReader {
+	return &compressedReader{r: bufio.NewReader(r), c: c, maxSize: maxSize}
+}
+
+// readFrame reads and decompresses a frame into data, or a new buffer if data is too small.
+func (r *compressedReader) readFrame(data []byte) ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	// allow for the overhead of incompressible frames
+	if size > uint64(2*r.maxSize) {
+		return nil, fmt.Errorf("compressed frame too large (%d bytes)", size)
+	}
+
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+
+	_, err = io.ReadFull(r.r, r.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	dsize, err := r.c.DecompressedLen(r.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if dsize > r.maxSize {
+		return nil, fmt.Errorf("decompressed frame too large (%d bytes)", dsize)
+	}
+
+	if cap(data) < dsize {
+		data = make([]byte, dsize)
+	}
+
+	return r.c.Decompress(data[:dsize], r.buf)
+}
+
+func (r *compressedReader) ReadMsg(msg proto.Message) error {
+	data, err := r.readFrame(r.data)
+	if err != nil {
+		return err
+	}
+	r.data = data
+
+	return proto.Unmarshal(data, msg)
+}
+
+// ReadRPC reads an RPC, decompressing the frame in a buffer of its own, which is retained by
+// the wire encodings of the published messages.
+func (r *compressedReader) ReadRPC(rpc *RPC) error {
+	data, err := r.readFrame(nil)
+	if err != nil {
+		return err
+	}
+
+	return rpc.unmarshal(data)
+}
@@ -0,0 +1,135 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+func TestCompressedReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := newCompressedWriter(&buf, SnappyCompression{})
+
+	data := bytes.Repeat([]byte("compressible"), 1000)
+	for i := 0; i < 2; i++ {
+		err := w.WriteMsg(&rpcWithMessages(&pb.Message{Data: data}).RPC)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if buf.Len() > len(data) {
+		t.Fatalf("expected compressed frames, got %d bytes", buf.Len())
+	}
+
+	r := newCompressedReader(&buf, SnappyCompression{}, 1<<20)
+	for i := 0; i < 2; i++ {
+		rpc := new(RPC)
+		err := r.ReadMsg(&rpc.RPC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rpc.Publish) != 1 || !bytes.Equal(rpc.Publish[0].Data, data) {
+			t.Fatal("got wrong message")
+		}
+	}
+}
+
+func TestCompressedReaderSizeLimit(t *testing.T) {
+	// a small frame that decompresses to 1MiB
+	block := SnappyCompression{}.Compress(nil, make([]byte, 1<<20))
+
+	var buf bytes.Buffer
+	var size [binary.MaxVarintLen64]byte
+	buf.Write(size[:binary.PutUvarint(size[:], uint64(len(block)))])
+	buf.Write(block)
+
+	r := newCompressedReader(&buf, SnappyCompression{}, 1<<16)
+	rpc := new(RPC)
+	err := r.ReadMsg(&rpc.RPC)
+	if err == nil {
+		t.Fatal("expected decompressed size limit to be enforced")
+	}
+}
+
+func streamProtocols(h host.Host) map[protocol.ID]bool {
+	res := make(map[protocol.ID]bool)
+	for _, c := range h.Network().Conns() {
+		for _, s := range c.GetStreams() {
+			res[s.Protocol()] = true
+		}
+	}
+	return res
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithCompression(SnappyCompression{})),
+		getGossipsub(ctx, hosts[1], WithCompression(SnappyCompression{})),
+		getGossipsub(ctx, hosts[2]),
+	}
+	connectAll(t, hosts)
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		sub, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	time.Sleep(time.Second)
+
+	for i, ps := range psubs {
+		data := bytes.Repeat([]byte{byte(i)}, 1<<16)
+		err := ps.Publish("test", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sub := range subs {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg.Data, data) {
+				t.Fatal("got wrong message")
+			}
+		}
+	}
+
+	compressed := compressedProtocol(GossipSubID_v12, SnappyCompression{})
+
+	// the compressing peers speak compression between themselves and fall back
+	// with the peer that doesn't
+	protos := streamProtocols(hosts[0])
+	if !protos[compressed] || !protos[GossipSubID_v12] {
+		t.Fatalf("expected both compressed and uncompressed streams, got %v", protos)
+	}
+
+	protos = streamProtocols(hosts[2])
+	if protos[compressed] || !protos[GossipSubID_v12] {
+		t.Fatalf("expected only uncompressed streams, got %v", protos)
+	}
+
+	// and the router sees the router protocol
+	res := make(chan protocol.ID, 1)
+	psubs[0].eval <- func() {
+		res <- psubs[0].rt.(*GossipSubRouter).peers[hosts[1].ID()]
+	}
+	if proto := <-res; proto != GossipSubID_v12 {
+		t.Fatalf("expected router protocol %s, got %s", GossipSubID_v12, proto)
+	}
+}
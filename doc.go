@@ -9,6 +9,8 @@
 //
 // - NewGossipSub creates an instance that uses the gossipsub routing algorithm.
 //
+// - NewGossipSubWithRouter creates a gossipsub instance with a router from DefaultGossipSubRouter.
+//
 // - NewRandomSub creates an instance that uses the randomsub routing algorithm.
 //
 // In addition, there is a generic constructor that creates a pubsub instance with
@@ -88,21 +88,21 @@ func (fs *FloodSubRouter) Publish(msg *Message) {
 		}
 	}
 
-	out := rpcWithMessages(msg.Message)
+	out := fs.p.rpcWithMessage(msg)
+	prio := fs.p.messagePriority(msg)
 	for pid := range tosend {
 		if pid == from || pid == peer.ID(msg.GetFrom()) {
 			continue
 		}
 
-		mch, ok := fs.p.peers[pid]
+		q, ok := fs.p.peers[pid]
 		if !ok {
 			continue
 		}
 
-		select {
-		case mch <- out:
+		if q.Push(out, prio) {
 			fs.tracer.SendRPC(out, pid)
-		default:
+		} else {
 			log.Infof("dropping message to peer %s: queue full", pid)
 			fs.tracer.DropRPC(out, pid)
 			// Drop it. The peer is too slow.
@@ -16,6 +16,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 
 	swarmt "github.com/libp2p/go-libp2p-swarm/testing"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 func checkMessageRouting(t *testing.T, topic string, pubs []*PubSub, subs []*Subscription) {
@@ -902,6 +903,86 @@ func assertPeerList(t *testing.T, peers []peer.ID, expected ...peer.ID) {
 	}
 }
 
+func TestPeerFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+
+	var mx sync.Mutex
+	filtered := make(map[peer.ID]bool)
+	filter := func(pid peer.ID, proto protocol.ID, addrs []ma.Multiaddr) bool {
+		if proto != FloodSubID || len(addrs) == 0 {
+			t.Errorf("unexpected protocol %s and addrs %v for %s", proto, addrs, pid)
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		allow := pid == hosts[1].ID()
+		if !allow {
+			filtered[pid] = true
+		}
+		return allow
+	}
+
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithPeerFilter(filter)),
+		getPubsub(ctx, hosts[1]),
+		getPubsub(ctx, hosts[2]),
+	}
+	connectAll(t, hosts)
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		sub, err := ps.Subscribe("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// only the allowed peer has been admitted
+	assertPeerList(t, psubs[0].ListPeers("foo"), hosts[1].ID())
+	assertPeerList(t, psubs[2].ListPeers("foo"), hosts[1].ID())
+
+	mx.Lock()
+	if !filtered[hosts[2].ID()] {
+		t.Fatal("expected the filter to be invoked for the filtered peer")
+	}
+	mx.Unlock()
+
+	// the filtered peer can still reach us through the admitted peer
+	if err := psubs[2].Publish("foo", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range subs {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) != "hello" {
+			t.Fatal("unexpected message")
+		}
+		if sub == subs[0] && msg.ReceivedFrom != hosts[1].ID() {
+			t.Fatalf("expected message to be relayed by the admitted peer, got it from %s", msg.ReceivedFrom)
+		}
+	}
+
+	// streams from the filtered peer are reset rather than drained; depending on timing, the
+	// reset is observed when opening the stream or when reading from it
+	start := time.Now()
+	s, err := hosts[2].NewStream(ctx, hosts[0].ID(), FloodSubID)
+	if err == nil {
+		s.SetReadDeadline(start.Add(5 * time.Second))
+		_, err = s.Read(make([]byte, 1))
+	}
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected the stream from the filtered peer to be reset, got %v", err)
+	}
+}
+
 func TestNonsensicalSigningOptions(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -997,7 +1078,7 @@ func TestImproperlySignedMessageRejected(t *testing.T) {
 	// Change the sign key for the adversarial peer, and send the second,
 	// incorrectly signed, message.
 	adversaryPubSub.signID = honestPubSub.signID
-	adversaryPubSub.signKey = honestPubSub.host.Peerstore().PrivKey(honestPubSub.signID)
+	adversaryPubSub.signer = honestPubSub.host.Peerstore().PrivKey(honestPubSub.signID)
 	err = adversaryPubSub.Publish(topic, incorrectMessage)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// gossipTracer is an internal tracer that tracks IWANT requests in order to penalize
+// peers who don't follow up on IWANT requests after an IHAVE advertisement.
+// The tracking of promises is probabilistic to avoid using too much memory: we only track
+// one random message ID from each IWANT request.
+type gossipTracer struct {
+	sync.Mutex
+
+	msgID MsgIdFunction
+
+	// how long to wait for a peer to follow up on an IWANT request
+	followUpTime time.Duration
+
+	// promises for messages by message ID; for each message tracked, we track the promise
+	// expiration time for each peer.
+	promises map[string]map[peer.ID]time.Time
+}
+
+func newGossipTracer() *gossipTracer {
+	return &gossipTracer{
+		msgID:    DefaultMsgIdFn,
+		promises: make(map[string]map[peer.ID]time.Time),
+	}
+}
+
+func (gt *gossipTracer) Start(gs *GossipSubRouter) {
+	if gt == nil {
+		return
+	}
+
+	gt.msgID = gs.p.msgID
+	gt.followUpTime = gs.params.IWantFollowupTime
+}
+
+// AddPromise tracks a promise to deliver a message from a list of msgIDs we are requesting
+// from peer p.
+func (gt *gossipTracer) AddPromise(p peer.ID, msgIDs []string) {
+	if gt == nil || len(msgIDs) == 0 {
+		return
+	}
+
+	mid := msgIDs[rand.Intn(len(msgIDs))]
+
+	gt.Lock()
+	defer gt.Unlock()
+
+	peers, ok := gt.promises[mid]
+	if !ok {
+		peers = make(map[peer.ID]time.Time)
+		gt.promises[mid] = peers
+	}
+
+	_, ok = peers[p]
+	if !ok {
+		peers[p] = time.Now().Add(gt.followUpTime)
+	}
+}
+
+// WriteRPC tracks the promises for the IWANT requests in an RPC that has been written to peer p.
+// We only track promises once the requests have been written, as RPCs may be dropped by the
+// outbound queue or the shaper, and the peer can't be expected to follow up on requests it never
+// received.
+func (gt *gossipTracer) WriteRPC(rpc *RPC, p peer.ID) {
+	if gt == nil {
+		return
+	}
+
+	for _, iwant := range rpc.GetControl().GetIwant() {
+		gt.AddPromise(p, iwant.GetMessageIDs())
+	}
+}
+
+// GetBrokenPromises returns the number of broken promises for each peer who didn't follow
+// up on an IWANT request, and stops tracking them.
+func (gt *gossipTracer) GetBrokenPromises() map[peer.ID]int {
+	if gt == nil {
+		return nil
+	}
+
+	gt.Lock()
+	defer gt.Unlock()
+
+	var res map[peer.ID]int
+	now := time.Now()
+
+	for mid, peers := range gt.promises {
+		for p, expire := range peers {
+			if expire.Before(now) {
+				if res == nil {
+					res = make(map[peer.ID]int)
+				}
+				res[p]++
+
+				delete(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			delete(gt.promises, mid)
+		}
+	}
+
+	return res
+}
+
+// fulfillPromise stops tracking the promises for msg, as we have received it; it doesn't
+// matter from which peer, as we don't need the message anymore.
+func (gt *gossipTracer) fulfillPromise(msg *Message) {
+	mid := gt.msgID(msg.Message)
+
+	gt.Lock()
+	defer gt.Unlock()
+
+	delete(gt.promises, mid)
+}
+
+func (gt *gossipTracer) ValidateMessage(msg *Message) {
+	// we consider the promise fulfilled as soon as the message begins validation; if it
+	// turns out to be invalid, the peer is penalized by the invalid message deliveries
+	gt.fulfillPromise(msg)
+}
+
+func (gt *gossipTracer) DeliverMessage(msg *Message) {
+	// messages without validators and signatures are delivered without validation
+	gt.fulfillPromise(msg)
+}
+
+func (gt *gossipTracer) RejectMessage(msg *Message, reason string) {
+	// we only fulfill promises for messages that have been delivered intact, so that peers
+	// can't fulfill them with junk that merely claims the message ID
+	switch reason {
+	case rejectMissingSignature, rejectInvalidSignature:
+		return
+	}
+
+	gt.fulfillPromise(msg)
+}
@@ -0,0 +1,125 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	tnet "github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestBrokenPromises(t *testing.T) {
+	// tests that unfulfilled promises are tracked correctly
+	gt := newGossipTracer()
+	gt.followUpTime = 100 * time.Millisecond
+
+	peerA := tnet.RandPeerIDFatal(t)
+	peerB := tnet.RandPeerIDFatal(t)
+	peerC := tnet.RandPeerIDFatal(t)
+
+	var mids []string
+	for i := 0; i < 100; i++ {
+		m := makeTestMessage(i)
+		m.From = []byte(peerA)
+		mid := DefaultMsgIdFn(m)
+		mids = append(mids, mid)
+	}
+
+	gt.AddPromise(peerA, mids)
+	gt.AddPromise(peerB, mids)
+	gt.AddPromise(peerC, mids)
+
+	// no broken promises yet
+	brokenPromises := gt.GetBrokenPromises()
+	if brokenPromises != nil {
+		t.Fatal("expected no broken promises")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	brokenPromises = gt.GetBrokenPromises()
+	if len(brokenPromises) != 3 {
+		t.Fatalf("expected 3 broken promises, got %d", len(brokenPromises))
+	}
+
+	for _, p := range []peer.ID{peerA, peerB, peerC} {
+		if brokenPromises[p] != 1 {
+			t.Fatalf("expected 1 broken promise for peer %s, got %d", p, brokenPromises[p])
+		}
+	}
+
+	// the broken promises are no longer tracked
+	if gt.GetBrokenPromises() != nil {
+		t.Fatal("expected no broken promises")
+	}
+}
+
+func TestFulfilledPromises(t *testing.T) {
+	// tests that fulfilled promises are not tracked
+	gt := newGossipTracer()
+	gt.followUpTime = 100 * time.Millisecond
+
+	peerA := tnet.RandPeerIDFatal(t)
+
+	var msgs []*pb.Message
+	var mids []string
+	for i := 0; i < 100; i++ {
+		m := makeTestMessage(i)
+		m.From = []byte(peerA)
+		msgs = append(msgs, m)
+		mids = append(mids, DefaultMsgIdFn(m))
+	}
+
+	// the peer only delivers junk with an invalid signature, which doesn't fulfill the promise
+	gt.AddPromise(peerA, mids)
+	for _, m := range msgs {
+		gt.RejectMessage(&Message{Message: m, ReceivedFrom: peerA}, rejectInvalidSignature)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if gt.GetBrokenPromises()[peerA] != 1 {
+		t.Fatal("expected a broken promise")
+	}
+
+	// and now it delivers the messages
+	gt.AddPromise(peerA, mids)
+	for _, m := range msgs {
+		gt.DeliverMessage(&Message{Message: m, ReceivedFrom: peerA})
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if gt.GetBrokenPromises() != nil {
+		t.Fatal("expected no broken promises")
+	}
+}
+
+func TestPromisesTrackedOnWrite(t *testing.T) {
+	// tests that promises are only tracked for IWANT requests written to the peer
+	gt := newGossipTracer()
+	gt.followUpTime = 100 * time.Millisecond
+
+	peerA := tnet.RandPeerIDFatal(t)
+	peerB := tnet.RandPeerIDFatal(t)
+
+	var mids []string
+	for i := 0; i < 10; i++ {
+		m := makeTestMessage(i)
+		m.From = []byte(peerA)
+		mids = append(mids, DefaultMsgIdFn(m))
+	}
+
+	iwant := []*pb.ControlIWant{{MessageIDs: mids}}
+	gt.WriteRPC(rpcWithControl(nil, nil, iwant, nil, nil), peerA)
+	gt.WriteRPC(rpcWithMessages(makeTestMessage(100)), peerB)
+
+	time.Sleep(200 * time.Millisecond)
+
+	brokenPromises := gt.GetBrokenPromises()
+	if len(brokenPromises) != 1 || brokenPromises[peerA] != 1 {
+		t.Fatalf("expected a broken promise for the written IWANT only, got %v", brokenPromises)
+	}
+}
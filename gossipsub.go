@@ -3,6 +3,7 @@ package pubsub
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 	"time"
@@ -15,13 +16,18 @@ import (
 	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/libp2p/go-libp2p-core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 const (
 	GossipSubID_v10 = protocol.ID("/meshsub/1.0.0")
 	GossipSubID_v11 = protocol.ID("/meshsub/1.1.0")
+	GossipSubID_v12 = protocol.ID("/meshsub/1.2.0")
 )
 
+// Default gossipsub parameters; these are read when a router is created, and can be
+// overridden for each router with WithGossipSubParams.
 var (
 	// overlay parameters
 	GossipSubD      = 6
@@ -29,6 +35,11 @@ var (
 	GossipSubDhi    = 12
 	GossipSubDscore = 4
 
+	// minimum number of peers with outbound connections in the mesh; this protects the mesh
+	// from being filled by an attacker opening many inbound connections. It must be less than
+	// GossipSubDlo and at most GossipSubD/2.
+	GossipSubDout = 2
+
 	// gossip parameters
 	GossipSubHistoryLength = 5
 	GossipSubHistoryGossip = 3
@@ -51,6 +62,10 @@ var (
 	// backoff time for pruned peers
 	GossipSubPruneBackoff = time.Minute
 
+	// backoff time for peers pruned when we unsubscribe from a topic; this is shorter than the
+	// prune backoff, so that we can quickly rejoin the mesh if we resubscribe
+	GossipSubUnsubscribeBackoff = 10 * time.Second
+
 	// number of active connection attempts for peers obtained through px
 	GossipSubConnectors = 8
 
@@ -88,24 +103,316 @@ var (
 
 	// Maximum number of IHAVE messages to accept from a peer within a heartbeat.
 	GossipSubMaxIHaveMessages = 10
+
+	// Time to wait for a message requested through IWANT following an IHAVE advertisement.
+	// If the message is not received within this window, a broken promise is declared and
+	// the router may apply behavioural penalties.
+	GossipSubIWantFollowupTime = 3 * time.Second
+
+	// Minimum size of messages for which we send IDONTWANT to our mesh peers when we first
+	// receive them, so that they don't send us duplicates; smaller messages are not worth
+	// the control overhead.
+	GossipSubIDontWantMessageThreshold = 1024
+
+	// Number of heartbeats for which we honor the IDONTWANT message ids received from a peer.
+	GossipSubIDontWantMessageTTL = 3
+
+	// Maximum number of IDONTWANT message ids we track for a peer; further ids are ignored
+	// until the tracked ids expire, to protect from IDONTWANT floods.
+	GossipSubMaxIDontWantMessages = 1000
 )
 
+// GossipSubParams are the parameters of a gossipsub router.
+type GossipSubParams struct {
+	// overlay parameters: the mesh degree D, the low and high watermarks Dlo and Dhi for
+	// the mesh degree, the number of peers to retain by score when pruning the mesh, and
+	// the minimum number of outbound connection peers in the mesh
+	D      int
+	Dlo    int
+	Dhi    int
+	Dscore int
+	Dout   int
+
+	// gossip parameters: the number of heartbeats in the message cache, and the number of
+	// heartbeats of messages to gossip
+	HistoryLength int
+	HistoryGossip int
+
+	// the minimum number of peers to gossip to, and the fraction of the peers to gossip to
+	// if that is larger
+	Dlazy        int
+	GossipFactor float64
+
+	// the number of times we will respond to IWANT requests for a message from a peer
+	GossipRetransmission int
+
+	// heartbeat initial delay and interval
+	HeartbeatInitialDelay time.Duration
+	HeartbeatInterval     time.Duration
+
+	// fanout ttl
+	FanoutTTL time.Duration
+
+	// number of peers to include in prune Peer eXchange
+	PrunePeers int
+
+	// backoff time for pruned peers, and for peers pruned when we unsubscribe
+	PruneBackoff       time.Duration
+	UnsubscribeBackoff time.Duration
+
+	// number of active connection attempts for peers obtained through px
+	Connectors int
+
+	// maximum number of pending connections for peers attempted through px
+	MaxPendingConnections int
+
+	// timeout for connection attempts
+	ConnectionTimeout time.Duration
+
+	// Number of heartbeat ticks for attempting to reconnect direct peers that are not
+	// currently connected
+	DirectConnectTicks uint64
+
+	// Number of heartbeat ticks for attempting to improve the mesh with opportunistic
+	// grafting, and the number of peers to opportunistically graft
+	OpportunisticGraftTicks uint64
+	OpportunisticGraftPeers int
+
+	// If a GRAFT comes before GraftFloodThreshold has ellapsed since the last PRUNE,
+	// then there is no PRUNE response emitted. This protects against GRAFT floods and should be
+	// less than PruneBackoff.
+	GraftFloodThreshold time.Duration
+
+	// backoff penalty for GRAFT floods
+	PruneBackoffPenalty time.Duration
+
+	// Maximum number of messages to include in an IHAVE message, and maximum number of
+	// IHAVE messages to accept from a peer within a heartbeat; see GossipSubMaxIHaveLength.
+	MaxIHaveLength   int
+	MaxIHaveMessages int
+
+	// Time to wait for a message requested through IWANT; see GossipSubIWantFollowupTime.
+	IWantFollowupTime time.Duration
+
+	// IDONTWANT parameters; see GossipSubIDontWantMessageThreshold.
+	IDontWantMessageThreshold int
+	IDontWantMessageTTL       int
+	MaxIDontWantMessages      int
+}
+
+// DefaultGossipSubParams returns the default gossipsub parameters, as set in the GossipSub
+// package variables.
+func DefaultGossipSubParams() GossipSubParams {
+	return GossipSubParams{
+		D:                       GossipSubD,
+		Dlo:                     GossipSubDlo,
+		Dhi:                     GossipSubDhi,
+		Dscore:                  GossipSubDscore,
+		Dout:                    GossipSubDout,
+		HistoryLength:           GossipSubHistoryLength,
+		HistoryGossip:           GossipSubHistoryGossip,
+		Dlazy:                   GossipSubDlazy,
+		GossipFactor:            GossipSubGossipFactor,
+		GossipRetransmission:    GossipSubGossipRetransmission,
+		HeartbeatInitialDelay:   GossipSubHeartbeatInitialDelay,
+		HeartbeatInterval:       GossipSubHeartbeatInterval,
+		FanoutTTL:               GossipSubFanoutTTL,
+		PrunePeers:              GossipSubPrunePeers,
+		PruneBackoff:            GossipSubPruneBackoff,
+		UnsubscribeBackoff:      GossipSubUnsubscribeBackoff,
+		Connectors:              GossipSubConnectors,
+		MaxPendingConnections:   GossipSubMaxPendingConnections,
+		ConnectionTimeout:       GossipSubConnectionTimeout,
+		DirectConnectTicks:      GossipSubDirectConnectTicks,
+		OpportunisticGraftTicks: GossipSubOpportunisticGraftTicks,
+		OpportunisticGraftPeers: GossipSubOpportunisticGraftPeers,
+		GraftFloodThreshold:     GossipSubGraftFloodThreshold,
+		PruneBackoffPenalty:     GossipSubPruneBackoffPenalty,
+		MaxIHaveLength:          GossipSubMaxIHaveLength,
+		MaxIHaveMessages:        GossipSubMaxIHaveMessages,
+		IWantFollowupTime:       GossipSubIWantFollowupTime,
+
+		IDontWantMessageThreshold: GossipSubIDontWantMessageThreshold,
+		IDontWantMessageTTL:       GossipSubIDontWantMessageTTL,
+		MaxIDontWantMessages:      GossipSubMaxIDontWantMessages,
+	}
+}
+
+func (p *GossipSubParams) validate() error {
+	if p.D < 0 || p.Dlo < 0 || p.Dscore < 0 || p.Dlazy < 0 {
+		return fmt.Errorf("invalid mesh degree parameters; must be non-negative")
+	}
+	if !(p.Dlo <= p.D && p.D <= p.Dhi) {
+		return fmt.Errorf("invalid mesh degree parameters; must satisfy Dlo <= D <= Dhi")
+	}
+	if p.Dscore > p.D {
+		return fmt.Errorf("invalid Dscore parameter; must be at most D")
+	}
+	if p.Dout < 0 || (p.Dout > 0 && (p.Dout >= p.Dlo || p.Dout > p.D/2)) {
+		return fmt.Errorf("invalid Dout parameter; must be less than Dlo and at most D/2")
+	}
+	if p.HistoryGossip <= 0 || p.HistoryGossip > p.HistoryLength {
+		return fmt.Errorf("invalid history parameters; must satisfy 0 < HistoryGossip <= HistoryLength")
+	}
+	if p.GossipFactor < 0 || p.GossipFactor > 1 {
+		return fmt.Errorf("invalid GossipFactor parameter; must be in [0, 1]")
+	}
+	if p.HeartbeatInitialDelay < 0 || p.HeartbeatInterval <= 0 {
+		return fmt.Errorf("invalid heartbeat parameters; the interval must be positive")
+	}
+	if p.FanoutTTL <= 0 || p.PruneBackoff <= 0 || p.UnsubscribeBackoff <= 0 || p.PruneBackoffPenalty <= 0 || p.ConnectionTimeout <= 0 || p.IWantFollowupTime <= 0 {
+		return fmt.Errorf("invalid time parameters; FanoutTTL, PruneBackoff, UnsubscribeBackoff, PruneBackoffPenalty, ConnectionTimeout and IWantFollowupTime must be positive")
+	}
+	if p.GraftFloodThreshold < 0 || p.GraftFloodThreshold > p.PruneBackoff {
+		return fmt.Errorf("invalid GraftFloodThreshold parameter; must be at most PruneBackoff")
+	}
+	if p.Connectors <= 0 || p.MaxPendingConnections < 0 {
+		return fmt.Errorf("invalid connector parameters; Connectors must be positive")
+	}
+	if p.DirectConnectTicks == 0 || p.OpportunisticGraftTicks == 0 {
+		return fmt.Errorf("invalid tick parameters; must be positive")
+	}
+	if p.PrunePeers < 0 || p.GossipRetransmission < 0 || p.OpportunisticGraftPeers < 0 {
+		return fmt.Errorf("invalid peer count parameters; must be non-negative")
+	}
+	if p.MaxIHaveLength <= 0 || p.MaxIHaveMessages <= 0 {
+		return fmt.Errorf("invalid IHAVE parameters; must be positive")
+	}
+	if p.IDontWantMessageThreshold < 0 || p.IDontWantMessageTTL <= 0 || p.MaxIDontWantMessages < 0 {
+		return fmt.Errorf("invalid IDONTWANT parameters; the TTL must be positive")
+	}
+	return nil
+}
+
 // NewGossipSub returns a new PubSub object using GossipSubRouter as the router.
 func NewGossipSub(ctx context.Context, h host.Host, opts ...Option) (*PubSub, error) {
-	rt := &GossipSubRouter{
+	return NewGossipSubWithRouter(ctx, h, DefaultGossipSubRouter(), opts...)
+}
+
+// NewGossipSubWithRouter returns a new PubSub object using the given router, which should be
+// created with DefaultGossipSubRouter; this allows the application to keep a reference to the
+// router for runtime management.
+func NewGossipSubWithRouter(ctx context.Context, h host.Host, rt *GossipSubRouter, opts ...Option) (*PubSub, error) {
+	return NewPubSub(ctx, h, rt, opts...)
+}
+
+// DefaultGossipSubRouter returns a new GossipSubRouter with the default parameters.
+func DefaultGossipSubRouter() *GossipSubRouter {
+	params := DefaultGossipSubParams()
+	return &GossipSubRouter{
+		params:   params,
 		peers:    make(map[peer.ID]protocol.ID),
+		direct:   make(map[peer.ID]struct{}),
+		outbound: make(map[peer.ID]bool),
 		mesh:     make(map[string]map[peer.ID]struct{}),
+		grafted:  make(map[string]map[peer.ID]time.Time),
 		fanout:   make(map[string]map[peer.ID]struct{}),
 		lastpub:  make(map[string]int64),
 		gossip:   make(map[peer.ID][]*pb.ControlIHave),
 		control:  make(map[peer.ID]*pb.ControlMessage),
 		backoff:  make(map[string]map[peer.ID]time.Time),
+		tparams:  make(map[string]GossipSubTopicParams),
 		peerhave: make(map[peer.ID]int),
 		iasked:   make(map[peer.ID]int),
-		connect:  make(chan connectInfo, GossipSubMaxPendingConnections),
-		mcache:   NewMessageCache(GossipSubHistoryGossip, GossipSubHistoryLength),
+		unwanted: make(map[peer.ID]map[string]uint64),
+		connect:  make(chan connectInfo, params.MaxPendingConnections),
+		mcache:   NewMessageCache(params.HistoryGossip, params.HistoryLength),
+		selector: RandomPeerSelector{},
+	}
+}
+
+// WithGossipSubParams is a gossipsub router option that sets the router parameters, in place of
+// the defaults taken from the GossipSub package variables.
+func WithGossipSubParams(params GossipSubParams) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		err := params.validate()
+		if err != nil {
+			return err
+		}
+
+		gs.params = params
+		gs.connect = make(chan connectInfo, params.MaxPendingConnections)
+		gs.mcache = NewMessageCache(params.HistoryGossip, params.HistoryLength)
+
+		return nil
+	}
+}
+
+// GossipSubTopicParams are the mesh and gossip parameters of a topic, overriding the
+// router parameters; see GossipSubParams.
+type GossipSubTopicParams struct {
+	D      int
+	Dlo    int
+	Dhi    int
+	Dscore int
+	Dout   int
+
+	Dlazy        int
+	GossipFactor float64
+}
+
+func (p *GossipSubTopicParams) validate() error {
+	if p.D < 0 || p.Dlo < 0 || p.Dscore < 0 || p.Dlazy < 0 {
+		return fmt.Errorf("invalid mesh degree parameters; must be non-negative")
+	}
+	if !(p.Dlo <= p.D && p.D <= p.Dhi) {
+		return fmt.Errorf("invalid mesh degree parameters; must satisfy Dlo <= D <= Dhi")
+	}
+	if p.Dscore > p.D {
+		return fmt.Errorf("invalid Dscore parameter; must be at most D")
+	}
+	if p.Dout < 0 || (p.Dout > 0 && (p.Dout >= p.Dlo || p.Dout > p.D/2)) {
+		return fmt.Errorf("invalid Dout parameter; must be less than Dlo and at most D/2")
+	}
+	if p.GossipFactor < 0 || p.GossipFactor > 1 {
+		return fmt.Errorf("invalid GossipFactor parameter; must be in [0, 1]")
+	}
+	return nil
+}
+
+// WithGossipSubTopicParams is a topic option that sets the mesh and gossip parameters of the
+// topic in the gossipsub router, in place of the router parameters. The parameters take effect
+// when the topic is joined and are dropped when the topic handle is closed.
+// If Dout is 0, it defaults to the router's Dout, capped to what the topic's degree allows.
+func WithGossipSubTopicParams(params GossipSubTopicParams) TopicOpt {
+	return func(t *Topic) error {
+		gs, ok := t.p.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		if params.Dout == 0 {
+			params.Dout = gs.params.Dout
+			if params.Dout >= params.Dlo {
+				params.Dout = params.Dlo - 1
+			}
+			if params.Dout > params.D/2 {
+				params.Dout = params.D / 2
+			}
+			if params.Dout < 0 {
+				params.Dout = 0
+			}
+		}
+
+		err := params.validate()
+		if err != nil {
+			return err
+		}
+
+		t.onAdd = append(t.onAdd, func() {
+			gs.tparams[t.topic] = params
+		})
+		t.onRemove = append(t.onRemove, func() {
+			delete(gs.tparams, t.topic)
+		})
+
+		return nil
 	}
-	return NewPubSub(ctx, h, rt, opts...)
 }
 
 // WithPeerScore is a gossipsub router option that enables peer scoring.
@@ -129,6 +436,7 @@ func WithPeerScore(params *PeerScoreParams, thresholds *PeerScoreThresholds) Opt
 		}
 
 		gs.score = newPeerScore(params)
+		gs.gossipTracer = newGossipTracer()
 		gs.gossipThreshold = thresholds.GossipThreshold
 		gs.publishThreshold = thresholds.PublishThreshold
 		gs.graylistThreshold = thresholds.GraylistThreshold
@@ -138,8 +446,9 @@ func WithPeerScore(params *PeerScoreParams, thresholds *PeerScoreThresholds) Opt
 		// hook the tracer
 		if ps.tracer != nil {
 			ps.tracer.score = gs.score
+			ps.tracer.gossip = gs.gossipTracer
 		} else {
-			ps.tracer = &pubsubTracer{score: gs.score, pid: ps.host.ID(), msgID: ps.msgID}
+			ps.tracer = &pubsubTracer{score: gs.score, gossip: gs.gossipTracer, pid: ps.host.ID(), msgID: ps.msgID}
 		}
 
 		return nil
@@ -208,23 +517,36 @@ func WithDirectPeers(pis []peer.AddrInfo) Option {
 // For each topic we publish to without joining, we maintain a list of peers
 // to use for injecting our messages in the overlay with stable routes; this
 // is the fanout map. Fanout peer lists are expired if we don't publish any
-// messages to their topic for GossipSubFanoutTTL.
+// messages to their topic for the fanout TTL.
 type GossipSubRouter struct {
 	p        *PubSub
+	params   GossipSubParams
 	peers    map[peer.ID]protocol.ID          // peer protocols
 	direct   map[peer.ID]struct{}             // direct peers
+	outbound map[peer.ID]bool                 // connection direction cache, marks peers with outbound connections
 	mesh     map[string]map[peer.ID]struct{}  // topic meshes
+	grafted  map[string]map[peer.ID]time.Time // graft times of mesh peers
 	fanout   map[string]map[peer.ID]struct{}  // topic fanout
 	lastpub  map[string]int64                 // last publish time for fanout topics
 	gossip   map[peer.ID][]*pb.ControlIHave   // pending gossip
 	control  map[peer.ID]*pb.ControlMessage   // pending control messages
 	peerhave map[peer.ID]int                  // number of IHAVEs received from peer in the last heartbeat
 	iasked   map[peer.ID]int                  // number of messages we have asked from peer in the last heartbeat
+	unwanted map[peer.ID]map[string]uint64    // IDONTWANT message ids, with the heartbeat tick they expire
 	backoff  map[string]map[peer.ID]time.Time // prune backoff
+	tparams  map[string]GossipSubTopicParams  // per-topic mesh and gossip parameters
 	connect  chan connectInfo                 // px connection requests
 	mcache   *MessageCache
 	tracer   *pubsubTracer
 	score    *peerScore
+	selector PeerSelector // mesh peer selection strategy
+
+	// peer candidates for the peer selector, cached for the duration of a heartbeat
+	candidates map[peer.ID]PeerCandidate
+
+	// IWANT promise tracking, for penalizing peers that don't deliver messages they advertised;
+	// only enabled with peer scoring
+	gossipTracer *gossipTracer
 
 	// whether PX is enabled; this should be enabled in bootstrappers and other well connected/trusted
 	// nodes.
@@ -263,7 +585,7 @@ type connectInfo struct {
 }
 
 func (gs *GossipSubRouter) Protocols() []protocol.ID {
-	return []protocol.ID{GossipSubID_v11, GossipSubID_v10, FloodSubID}
+	return []protocol.ID{GossipSubID_v12, GossipSubID_v11, GossipSubID_v10, FloodSubID}
 }
 
 func (gs *GossipSubRouter) Attach(p *PubSub) {
@@ -273,14 +595,23 @@ func (gs *GossipSubRouter) Attach(p *PubSub) {
 	// start the scoring
 	gs.score.Start(gs)
 
+	// and the IWANT promise tracking
+	gs.gossipTracer.Start(gs)
+
 	// start using the same msg ID function as PubSub for caching messages.
 	gs.mcache.SetMsgIdFn(p.msgID)
 
+	// and keep the message encodings for as long as the messages are in the message cache,
+	// so that IWANT requests are served without encoding the messages again
+	if ttl := time.Duration(gs.params.HistoryLength) * gs.params.HeartbeatInterval; ttl > p.encodings.ttl {
+		p.encodings.ttl = ttl
+	}
+
 	// start the heartbeat
 	go gs.heartbeatTimer()
 
 	// start the PX connectors
-	for i := 0; i < GossipSubConnectors; i++ {
+	for i := 0; i < gs.params.Connectors; i++ {
 		go gs.connector()
 	}
 
@@ -299,6 +630,16 @@ func (gs *GossipSubRouter) AddPeer(p peer.ID, proto protocol.ID) {
 	gs.tracer.AddPeer(p, proto)
 	gs.peers[p] = proto
 
+	// track the connection direction
+	outbound := false
+	for _, c := range gs.p.host.Network().ConnsToPeer(p) {
+		if c.Stat().Direction == network.DirOutbound {
+			outbound = true
+			break
+		}
+	}
+	gs.outbound[p] = outbound
+
 	// tag peer if it is a direct peer
 	_, direct := gs.direct[p]
 	if direct {
@@ -310,14 +651,204 @@ func (gs *GossipSubRouter) RemovePeer(p peer.ID) {
 	log.Debugf("PEERDOWN: Remove disconnected peer %s", p)
 	gs.tracer.RemovePeer(p)
 	delete(gs.peers, p)
+	delete(gs.outbound, p)
 	for _, peers := range gs.mesh {
 		delete(peers, p)
 	}
 	for _, peers := range gs.fanout {
 		delete(peers, p)
 	}
+	for _, grafted := range gs.grafted {
+		delete(grafted, p)
+	}
 	delete(gs.gossip, p)
 	delete(gs.control, p)
+	delete(gs.unwanted, p)
+}
+
+// AddDirectPeer adds a direct peer at runtime, as with WithDirectPeers; if the peer is in our
+// mesh for any topic, it is pruned, as we don't GRAFT direct peers. The peer addresses are
+// added to the peerstore and a connection attempt is made if we are not connected.
+// The peering should be reciprocal, so the peer should add us as a direct peer too.
+func (gs *GossipSubRouter) AddDirectPeer(pi peer.AddrInfo) error {
+	return gs.eval(func() {
+		gs.p.host.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.PermanentAddrTTL)
+
+		_, direct := gs.direct[pi.ID]
+		if direct {
+			return
+		}
+
+		log.Debugf("DIRECT: Add direct peer %s", pi.ID)
+		gs.direct[pi.ID] = struct{}{}
+		gs.p.host.ConnManager().TagPeer(pi.ID, "pubsub:direct", 1000)
+
+		// remove the peer from our meshes and fanout
+		for topic, peers := range gs.mesh {
+			_, inMesh := peers[pi.ID]
+			if !inMesh {
+				continue
+			}
+
+			log.Debugf("DIRECT: Remove mesh link to %s in %s", pi.ID, topic)
+			gs.tracer.Prune(pi.ID, topic)
+			delete(peers, pi.ID)
+			gs.clearGraftTime(pi.ID, topic)
+			gs.untagPeer(pi.ID, topic)
+			gs.addBackoff(pi.ID, topic)
+
+			prune := []*pb.ControlPrune{gs.makePrune(pi.ID, topic, false, false)}
+			out := rpcWithControl(nil, nil, nil, nil, prune)
+			gs.sendRPC(pi.ID, out, rpcPriorityControl)
+		}
+
+		for _, peers := range gs.fanout {
+			delete(peers, pi.ID)
+		}
+
+		// connect now rather than waiting for the direct connect ticks
+		_, connected := gs.peers[pi.ID]
+		if !connected {
+			go func() {
+				select {
+				case gs.connect <- connectInfo{p: pi.ID}:
+				case <-gs.p.ctx.Done():
+				}
+			}()
+		}
+	})
+}
+
+// RemoveDirectPeer removes a direct peer at runtime; the peer is treated as a regular peer
+// from then on, and may be grafted to our mesh once any backoff has expired.
+func (gs *GossipSubRouter) RemoveDirectPeer(p peer.ID) error {
+	return gs.eval(func() {
+		_, direct := gs.direct[p]
+		if !direct {
+			return
+		}
+
+		log.Debugf("DIRECT: Remove direct peer %s", p)
+		delete(gs.direct, p)
+		gs.p.host.ConnManager().UntagPeer(p, "pubsub:direct")
+	})
+}
+
+// GossipSubTopicState is a snapshot of the router state for a topic, as returned by Inspect.
+type GossipSubTopicState struct {
+	// Mesh maps the mesh peers to the time they were grafted; empty if we haven't joined the
+	// topic.
+	Mesh map[peer.ID]time.Time
+	// Fanout lists the fanout peers, if we are publishing to the topic without having joined.
+	Fanout []peer.ID
+	// LastPublish is the last time we published to the topic as a fanout topic, or zero.
+	LastPublish time.Time
+	// Backoff maps the peers we are backing off from in the topic to the backoff expiry.
+	Backoff map[peer.ID]time.Time
+}
+
+// Inspect returns a snapshot of the mesh, fanout and backoff state of the router for every
+// topic that has any.
+func (gs *GossipSubRouter) Inspect() (map[string]*GossipSubTopicState, error) {
+	var res map[string]*GossipSubTopicState
+	err := gs.eval(func() {
+		topics := make(map[string]struct{})
+		for topic := range gs.mesh {
+			topics[topic] = struct{}{}
+		}
+		for topic := range gs.fanout {
+			topics[topic] = struct{}{}
+		}
+		for topic := range gs.backoff {
+			topics[topic] = struct{}{}
+		}
+
+		res = make(map[string]*GossipSubTopicState, len(topics))
+		now := time.Now()
+		for topic := range topics {
+			res[topic] = gs.topicState(topic, now)
+		}
+	})
+	return res, err
+}
+
+// InspectTopic returns a snapshot of the mesh, fanout and backoff state of the router for
+// a topic.
+func (gs *GossipSubRouter) InspectTopic(topic string) (*GossipSubTopicState, error) {
+	var res *GossipSubTopicState
+	err := gs.eval(func() {
+		res = gs.topicState(topic, time.Now())
+	})
+	return res, err
+}
+
+// topicState returns a snapshot of the state for topic; only called from processLoop.
+func (gs *GossipSubRouter) topicState(topic string, now time.Time) *GossipSubTopicState {
+	state := &GossipSubTopicState{
+		Mesh:    make(map[peer.ID]time.Time, len(gs.mesh[topic])),
+		Fanout:  peerMapToList(gs.fanout[topic]),
+		Backoff: make(map[peer.ID]time.Time),
+	}
+
+	for p := range gs.mesh[topic] {
+		state.Mesh[p] = gs.grafted[topic][p]
+	}
+
+	if lastpub, ok := gs.lastpub[topic]; ok {
+		state.LastPublish = time.Unix(0, lastpub)
+	}
+
+	// expired backoffs are cleaned up lazily, so skip them
+	for p, expire := range gs.backoff[topic] {
+		if now.Before(expire) {
+			state.Backoff[p] = expire
+		}
+	}
+
+	return state
+}
+
+// eval runs fn in the event loop and waits for it to complete; it must not be called from
+// the event loop.
+func (gs *GossipSubRouter) eval(fn func()) error {
+	if gs.p == nil {
+		return fmt.Errorf("router is not attached to a pubsub instance")
+	}
+
+	done := make(chan struct{})
+	select {
+	case gs.p.eval <- func() {
+		fn()
+		close(done)
+	}:
+	case <-gs.p.ctx.Done():
+		return gs.p.ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-gs.p.ctx.Done():
+		return gs.p.ctx.Err()
+	}
+}
+
+// topicParams returns the mesh and gossip parameters of topic.
+func (gs *GossipSubRouter) topicParams(topic string) GossipSubTopicParams {
+	params, ok := gs.tparams[topic]
+	if ok {
+		return params
+	}
+
+	return GossipSubTopicParams{
+		D:            gs.params.D,
+		Dlo:          gs.params.Dlo,
+		Dhi:          gs.params.Dhi,
+		Dscore:       gs.params.Dscore,
+		Dout:         gs.params.Dout,
+		Dlazy:        gs.params.Dlazy,
+		GossipFactor: gs.params.GossipFactor,
+	}
 }
 
 func (gs *GossipSubRouter) EnoughPeers(topic string, suggested int) bool {
@@ -338,11 +869,12 @@ func (gs *GossipSubRouter) EnoughPeers(topic string, suggested int) bool {
 	// gossipsub peers
 	gsPeers = len(gs.mesh[topic])
 
+	params := gs.topicParams(topic)
 	if suggested == 0 {
-		suggested = GossipSubDlo
+		suggested = params.Dlo
 	}
 
-	if fsPeers+gsPeers >= suggested || gsPeers >= GossipSubDhi {
+	if fsPeers+gsPeers >= suggested || gsPeers >= params.Dhi {
 		return true
 	}
 
@@ -364,13 +896,79 @@ func (gs *GossipSubRouter) HandleRPC(rpc *RPC) {
 	ihave := gs.handleIWant(rpc.from, ctl)
 	prune := gs.handleGraft(rpc.from, ctl)
 	gs.handlePrune(rpc.from, ctl)
+	gs.handleIDontWant(rpc.from, ctl)
 
 	if len(iwant) == 0 && len(ihave) == 0 && len(prune) == 0 {
 		return
 	}
 
-	out := rpcWithControl(ihave, nil, iwant, nil, prune)
-	gs.sendRPC(rpc.from, out)
+	if len(prune) > 0 {
+		out := rpcWithControl(nil, nil, nil, nil, prune)
+		gs.sendRPC(rpc.from, out, rpcPriorityControl)
+	}
+
+	if len(iwant) > 0 || len(ihave) > 0 {
+		out := rpcWithControl(nil, nil, iwant, nil, nil)
+		for _, m := range ihave {
+			out.appendMessage(m, gs.p.encodings.Get(gs.p.msgID(m)), gs.p.messageHops(m))
+		}
+		gs.sendRPC(rpc.from, out, rpcPriorityGossip)
+	}
+}
+
+var _ PreValidationRouter = (*GossipSubRouter)(nil)
+
+func (gs *GossipSubRouter) PreValidation(msg *Message) {
+	// tell our mesh peers not to send us large messages we have already received; we do this
+	// before validation, as duplicates are likely to be on their way while we validate
+	if msg.ReceivedFrom == gs.p.host.ID() || msg.Size() < gs.params.IDontWantMessageThreshold {
+		return
+	}
+
+	mid := gs.p.msgID(msg.Message)
+	tosend := make(map[peer.ID]struct{})
+	for _, topic := range msg.GetTopicIDs() {
+		for p := range gs.mesh[topic] {
+			if p == msg.ReceivedFrom || p == msg.GetFrom() || gs.peers[p] != GossipSubID_v12 {
+				continue
+			}
+			tosend[p] = struct{}{}
+		}
+	}
+
+	if len(tosend) == 0 {
+		return
+	}
+
+	out := rpcWithControl(nil, nil, nil, nil, nil)
+	out.Control.Idontwant = []*pb.ControlIDontWant{&pb.ControlIDontWant{MessageIDs: []string{mid}}}
+	for p := range tosend {
+		gs.sendRPC(p, out, rpcPriorityControl)
+	}
+}
+
+func (gs *GossipSubRouter) handleIDontWant(p peer.ID, ctl *pb.ControlMessage) {
+	if len(ctl.GetIdontwant()) == 0 {
+		return
+	}
+
+	// IDONTWANT flood protection; the tracked ids are bounded per peer
+	unwanted, ok := gs.unwanted[p]
+	if !ok {
+		unwanted = make(map[string]uint64)
+		gs.unwanted[p] = unwanted
+	}
+
+	expire := gs.heartbeatTicks + uint64(gs.params.IDontWantMessageTTL)
+	for _, idontwant := range ctl.GetIdontwant() {
+		for _, mid := range idontwant.GetMessageIDs() {
+			if len(unwanted) >= gs.params.MaxIDontWantMessages {
+				log.Debugf("IDONTWANT: peer %s has sent too many message ids (%d); ignoring", p, len(unwanted))
+				return
+			}
+			unwanted[mid] = expire
+		}
+	}
 }
 
 func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.ControlIWant {
@@ -383,12 +981,12 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 
 	// IHAVE flood protection
 	gs.peerhave[p]++
-	if gs.peerhave[p] > GossipSubMaxIHaveMessages {
+	if gs.peerhave[p] > gs.params.MaxIHaveMessages {
 		log.Debugf("IHAVE: peer %s has advertised too many times (%d) within this heartbeat interval; ignoring", p, gs.peerhave[p])
 		return nil
 	}
 
-	if gs.iasked[p] >= GossipSubMaxIHaveLength {
+	if gs.iasked[p] >= gs.params.MaxIHaveLength {
 		log.Debugf("IHAVE: peer %s has already advertised too many messages (%d); ignoring", p, gs.iasked[p])
 		return nil
 	}
@@ -414,8 +1012,8 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 	}
 
 	iask := len(iwant)
-	if iask+gs.iasked[p] > GossipSubMaxIHaveLength {
-		iask = GossipSubMaxIHaveLength - gs.iasked[p]
+	if iask+gs.iasked[p] > gs.params.MaxIHaveLength {
+		iask = gs.params.MaxIHaveLength - gs.iasked[p]
 	}
 
 	log.Debugf("IHAVE: Asking for %d out of %d messages from %s", iask, len(iwant), p)
@@ -432,6 +1030,7 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 	iwantlst = iwantlst[:iask]
 	gs.iasked[p] += iask
 
+	// the promise is tracked once the IWANT is written to the peer, see gossipTracer.WriteRPC
 	return []*pb.ControlIWant{&pb.ControlIWant{MessageIDs: iwantlst}}
 }
 
@@ -443,6 +1042,7 @@ func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.
 		return nil
 	}
 
+	now := time.Now()
 	ihave := make(map[string]*pb.Message)
 	for _, iwant := range ctl.GetIwant() {
 		for _, mid := range iwant.GetMessageIDs() {
@@ -451,7 +1051,12 @@ func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.
 				continue
 			}
 
-			if count > GossipSubGossipRetransmission {
+			if messageExpired(msg, now) {
+				log.Debugf("IWANT: Message %s has expired; ignoring request", mid)
+				continue
+			}
+
+			if count > gs.params.GossipRetransmission {
 				log.Debugf("IWANT: Peer %s has asked for message %s too many times; ignoring request", p, mid)
 				continue
 			}
@@ -507,7 +1112,7 @@ func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.
 		if backoff && now.Before(expire) {
 			log.Debugf("GRAFT: ignoring backed off peer %s", p)
 			// check the flood cutoff -- is the GRAFT coming too fast?
-			floodCutoff := expire.Add(GossipSubGraftFloodThreshold - GossipSubPruneBackoff)
+			floodCutoff := expire.Add(gs.params.GraftFloodThreshold - gs.params.PruneBackoff)
 			if now.Before(floodCutoff) {
 				// no prune, and no PX either
 				doPX = false
@@ -538,6 +1143,7 @@ func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.
 		gs.tracer.Graft(p, topic)
 		peers[p] = struct{}{}
 		gs.tagPeer(p, topic)
+		gs.setGraftTime(p, topic)
 	}
 
 	if len(prune) == 0 {
@@ -546,7 +1152,7 @@ func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.
 
 	cprune := make([]*pb.ControlPrune, 0, len(prune))
 	for _, topic := range prune {
-		cprune = append(cprune, gs.makePrune(p, topic, doPX))
+		cprune = append(cprune, gs.makePrune(p, topic, doPX, false))
 	}
 
 	return cprune
@@ -565,8 +1171,19 @@ func (gs *GossipSubRouter) handlePrune(p peer.ID, ctl *pb.ControlMessage) {
 		log.Debugf("PRUNE: Remove mesh link to %s in %s", p, topic)
 		gs.tracer.Prune(p, topic)
 		delete(peers, p)
+		gs.clearGraftTime(p, topic)
 		gs.untagPeer(p, topic)
-		gs.addBackoff(p, topic)
+
+		// honor the backoff requested by the peer, if any; older peers don't send it
+		backoff := prune.GetBackoff()
+		if backoff > 0 {
+			if backoff > maxPruneBackoff {
+				backoff = maxPruneBackoff
+			}
+			gs.doAddBackoff(p, topic, time.Duration(backoff)*time.Second)
+		} else {
+			gs.addBackoff(p, topic)
+		}
 
 		px := prune.GetPeers()
 		if len(px) > 0 {
@@ -581,12 +1198,16 @@ func (gs *GossipSubRouter) handlePrune(p peer.ID, ctl *pb.ControlMessage) {
 	}
 }
 
+// maxPruneBackoff is the maximum backoff in seconds we honor in PRUNE, so that the backoff
+// duration doesn't overflow
+const maxPruneBackoff = uint64(math.MaxInt64 / int64(time.Second))
+
 func (gs *GossipSubRouter) addBackoff(p peer.ID, topic string) {
-	gs.doAddBackoff(p, topic, GossipSubPruneBackoff)
+	gs.doAddBackoff(p, topic, gs.params.PruneBackoff)
 }
 
 func (gs *GossipSubRouter) addBackoffPenalty(p peer.ID, topic string) {
-	gs.doAddBackoff(p, topic, GossipSubPruneBackoffPenalty)
+	gs.doAddBackoff(p, topic, gs.params.PruneBackoffPenalty)
 }
 
 func (gs *GossipSubRouter) doAddBackoff(p peer.ID, topic string, interval time.Duration) {
@@ -602,9 +1223,9 @@ func (gs *GossipSubRouter) doAddBackoff(p peer.ID, topic string, interval time.D
 }
 
 func (gs *GossipSubRouter) pxConnect(peers []*pb.PeerInfo) {
-	if len(peers) > GossipSubPrunePeers {
+	if len(peers) > gs.params.PrunePeers {
 		shufflePeerInfo(peers)
-		peers = peers[:GossipSubPrunePeers]
+		peers = peers[:gs.params.PrunePeers]
 	}
 
 	toconnect := make([]connectInfo, 0, len(peers))
@@ -671,7 +1292,7 @@ func (gs *GossipSubRouter) connector() {
 				}
 			}
 
-			ctx, cancel := context.WithTimeout(gs.p.ctx, GossipSubConnectionTimeout)
+			ctx, cancel := context.WithTimeout(gs.p.ctx, gs.params.ConnectionTimeout)
 			err := gs.p.host.Connect(ctx, peer.AddrInfo{ID: ci.p})
 			cancel()
 			if err != nil {
@@ -728,7 +1349,7 @@ func (gs *GossipSubRouter) Publish(msg *Message) {
 			gmap, ok = gs.fanout[topic]
 			if !ok || len(gmap) == 0 {
 				// we don't have any, pick some with score above the publish threshold
-				peers := gs.getPeers(topic, GossipSubD, func(p peer.ID) bool {
+				peers := gs.getPeers(topic, gs.topicParams(topic).D, func(p peer.ID) bool {
 					return gs.score.Score(p) >= gs.publishThreshold
 				})
 
@@ -745,13 +1366,24 @@ func (gs *GossipSubRouter) Publish(msg *Message) {
 		}
 	}
 
-	out := rpcWithMessages(msg.Message)
+	// skip peers that have told us they don't want the message
+	var mid string
+	if len(gs.unwanted) > 0 {
+		mid = gs.p.msgID(msg.Message)
+	}
+
+	out := gs.p.rpcWithMessage(msg)
+	prio := gs.p.messagePriority(msg)
 	for pid := range tosend {
 		if pid == from || pid == peer.ID(msg.GetFrom()) {
 			continue
 		}
 
-		gs.sendRPC(pid, out)
+		if _, unwanted := gs.unwanted[pid][mid]; unwanted {
+			continue
+		}
+
+		gs.sendRPC(pid, out, prio)
 	}
 }
 
@@ -764,23 +1396,28 @@ func (gs *GossipSubRouter) Join(topic string) {
 	log.Debugf("JOIN %s", topic)
 	gs.tracer.Join(topic)
 
+	params := gs.topicParams(topic)
+	backoff := gs.backoff[topic]
+
 	gmap, ok = gs.fanout[topic]
 	if ok {
 		// these peers have a score above the publish threshold, which may be negative
-		// so drop the ones with a negative score
+		// so drop the ones with a negative score, and the ones we are backing off
 		for p := range gmap {
-			if gs.score.Score(p) < 0 {
+			_, doBackoff := backoff[p]
+			if doBackoff || gs.score.Score(p) < 0 {
 				delete(gmap, p)
 			}
 		}
 
-		if len(gmap) < GossipSubD {
+		if len(gmap) < params.D {
 			// we need more peers; eager, as this would get fixed in the next heartbeat
-			more := gs.getPeers(topic, GossipSubD-len(gmap), func(p peer.ID) bool {
-				// filter our current peers, direct peers, and peers with negative scores
+			more := gs.selectPeers(topic, params.D-len(gmap), func(p peer.ID) bool {
+				// filter our current peers, direct peers, peers we are backing off, and peers with negative scores
 				_, inMesh := gmap[p]
+				_, doBackoff := backoff[p]
 				_, direct := gs.direct[p]
-				return !inMesh && !direct && gs.score.Score(p) >= 0
+				return !inMesh && !doBackoff && !direct && gs.score.Score(p) >= 0
 			})
 			for _, p := range more {
 				gmap[p] = struct{}{}
@@ -790,10 +1427,11 @@ func (gs *GossipSubRouter) Join(topic string) {
 		delete(gs.fanout, topic)
 		delete(gs.lastpub, topic)
 	} else {
-		peers := gs.getPeers(topic, GossipSubD, func(p peer.ID) bool {
-			// filter direct peers and peers with negative score
+		peers := gs.selectPeers(topic, params.D, func(p peer.ID) bool {
+			// filter direct peers, peers we are backing off, and peers with negative score
+			_, doBackoff := backoff[p]
 			_, direct := gs.direct[p]
-			return !direct && gs.score.Score(p) >= 0
+			return !doBackoff && !direct && gs.score.Score(p) >= 0
 		})
 		gmap = peerListToMap(peers)
 		gs.mesh[topic] = gmap
@@ -804,6 +1442,7 @@ func (gs *GossipSubRouter) Join(topic string) {
 		gs.tracer.Graft(p, topic)
 		gs.sendGraft(p, topic)
 		gs.tagPeer(p, topic)
+		gs.setGraftTime(p, topic)
 	}
 }
 
@@ -817,11 +1456,15 @@ func (gs *GossipSubRouter) Leave(topic string) {
 	gs.tracer.Leave(topic)
 
 	delete(gs.mesh, topic)
+	delete(gs.grafted, topic)
 
 	for p := range gmap {
 		log.Debugf("LEAVE: Remove mesh link to %s in %s", p, topic)
 		gs.tracer.Prune(p, topic)
-		gs.sendPrune(p, topic)
+		gs.sendPrune(p, topic, true)
+		// the peer will back off for the unsubscribe backoff we sent it, so we back off too
+		// to avoid GRAFTing too early if we rejoin
+		gs.doAddBackoff(p, topic, gs.params.UnsubscribeBackoff)
 		gs.untagPeer(p, topic)
 	}
 }
@@ -829,22 +1472,23 @@ func (gs *GossipSubRouter) Leave(topic string) {
 func (gs *GossipSubRouter) sendGraft(p peer.ID, topic string) {
 	graft := []*pb.ControlGraft{&pb.ControlGraft{TopicID: &topic}}
 	out := rpcWithControl(nil, nil, nil, graft, nil)
-	gs.sendRPC(p, out)
+	gs.sendRPC(p, out, rpcPriorityControl)
 }
 
-func (gs *GossipSubRouter) sendPrune(p peer.ID, topic string) {
-	prune := []*pb.ControlPrune{gs.makePrune(p, topic, true)}
+func (gs *GossipSubRouter) sendPrune(p peer.ID, topic string, isUnsubscribe bool) {
+	prune := []*pb.ControlPrune{gs.makePrune(p, topic, true, isUnsubscribe)}
 	out := rpcWithControl(nil, nil, nil, nil, prune)
-	gs.sendRPC(p, out)
+	gs.sendRPC(p, out, rpcPriorityControl)
 }
 
-func (gs *GossipSubRouter) sendRPC(p peer.ID, out *RPC) {
+func (gs *GossipSubRouter) sendRPC(p peer.ID, out *RPC, prio rpcPriority) {
 	// do we own the RPC?
 	own := false
 
-	// piggyback control message retries
+	// piggyback control message retries; only in the control lane, so that they are not
+	// held back by payload congestion
 	ctl, ok := gs.control[p]
-	if ok {
+	if ok && prio == rpcPriorityControl {
 		out = copyRPC(out)
 		own = true
 		gs.piggybackControl(p, out, ctl)
@@ -862,15 +1506,14 @@ func (gs *GossipSubRouter) sendRPC(p peer.ID, out *RPC) {
 		delete(gs.gossip, p)
 	}
 
-	mch, ok := gs.p.peers[p]
+	q, ok := gs.p.peers[p]
 	if !ok {
 		return
 	}
 
-	select {
-	case mch <- out:
+	if q.Push(out, prio) {
 		gs.tracer.SendRPC(out, p)
-	default:
+	} else {
 		log.Infof("dropping message to peer %s: queue full", p)
 		gs.tracer.DropRPC(out, p)
 		// push control messages that need to be retried
@@ -882,14 +1525,14 @@ func (gs *GossipSubRouter) sendRPC(p peer.ID, out *RPC) {
 }
 
 func (gs *GossipSubRouter) heartbeatTimer() {
-	time.Sleep(GossipSubHeartbeatInitialDelay)
+	time.Sleep(gs.params.HeartbeatInitialDelay)
 	select {
 	case gs.p.eval <- gs.heartbeat:
 	case <-gs.p.ctx.Done():
 		return
 	}
 
-	ticker := time.NewTicker(GossipSubHeartbeatInterval)
+	ticker := time.NewTicker(gs.params.HeartbeatInterval)
 	defer ticker.Stop()
 
 	for {
@@ -921,14 +1564,27 @@ func (gs *GossipSubRouter) heartbeat() {
 	// clean up iasked counters
 	gs.clearIHaveCounters()
 
+	// apply IWANT request penalties
+	gs.applyIwantPenalties()
+
+	// clean up expired IDONTWANT message ids
+	gs.clearIDontWant()
+
 	// ensure direct peers are connected
 	gs.directConnect()
 
+	// the peer candidates for grafting are built at most once per heartbeat
+	gs.candidates = make(map[peer.ID]PeerCandidate)
+	defer func() { gs.candidates = nil }()
+
 	// maintain the mesh for topics we have joined
 	for topic, peers := range gs.mesh {
+		params := gs.topicParams(topic)
+
 		prunePeer := func(p peer.ID) {
 			gs.tracer.Prune(p, topic)
 			delete(peers, p)
+			gs.clearGraftTime(p, topic)
 			gs.untagPeer(p, topic)
 			gs.addBackoff(p, topic)
 			topics := toprune[p]
@@ -940,6 +1596,7 @@ func (gs *GossipSubRouter) heartbeat() {
 			gs.tracer.Graft(p, topic)
 			peers[p] = struct{}{}
 			gs.tagPeer(p, topic)
+			gs.setGraftTime(p, topic)
 			topics := tograft[p]
 			tograft[p] = append(topics, topic)
 		}
@@ -960,10 +1617,10 @@ func (gs *GossipSubRouter) heartbeat() {
 		}
 
 		// do we have enough peers?
-		if l := len(peers); l < GossipSubDlo {
+		if l := len(peers); l < params.Dlo {
 			backoff := gs.backoff[topic]
-			ineed := GossipSubD - l
-			plst := gs.getPeers(topic, ineed, func(p peer.ID) bool {
+			ineed := params.D - l
+			plst := gs.selectPeers(topic, ineed, func(p peer.ID) bool {
 				// filter our current and direct peers, peers we are backing off, and peers with negative score
 				_, inMesh := peers[p]
 				_, doBackoff := backoff[p]
@@ -977,7 +1634,7 @@ func (gs *GossipSubRouter) heartbeat() {
 		}
 
 		// do we have too many peers?
-		if len(peers) > GossipSubDhi {
+		if len(peers) > params.Dhi {
 			plst := peerMapToList(peers)
 
 			// sort by score (but shuffle first for the case we don't use the score)
@@ -986,16 +1643,73 @@ func (gs *GossipSubRouter) heartbeat() {
 				return scores[plst[i]] > scores[plst[j]]
 			})
 
-			// We keep the first D_score peers by score and the remaining up to D_lo randomly
-			shufflePeers(plst[GossipSubDscore:])
-			for _, p := range plst[GossipSubD:] {
+			// We keep the first D_score peers by score and the remaining up to D randomly
+			shufflePeers(plst[params.Dscore:])
+
+			// under the constraint that we keep D_out outbound peers in the mesh (if we have that
+			// many); we swap outbound peers from the excess with inbound peers we are keeping,
+			// starting from the random selection
+			outbound := 0
+			for _, p := range plst[:params.D] {
+				if gs.outbound[p] {
+					outbound++
+				}
+			}
+
+			j := params.D - 1
+			for i := params.D; i < len(plst) && outbound < params.Dout; i++ {
+				if !gs.outbound[plst[i]] {
+					continue
+				}
+
+				// the first Dscore peers are kept for their score, so we only swap out peers
+				// after them
+				for j >= params.Dscore && gs.outbound[plst[j]] {
+					j--
+				}
+				if j < params.Dscore {
+					break
+				}
+
+				plst[i], plst[j] = plst[j], plst[i]
+				outbound++
+			}
+
+			for _, p := range plst[params.D:] {
 				log.Debugf("HEARTBEAT: Remove mesh link to %s in %s", p, topic)
 				prunePeer(p)
 			}
 		}
 
+		// do we have enough outbound peers?
+		if len(peers) >= params.Dlo {
+			outbound := 0
+			for p := range peers {
+				if gs.outbound[p] {
+					outbound++
+				}
+			}
+
+			// if it's less than D_out, select some peers with outbound connections and graft them
+			if outbound < params.Dout {
+				ineed := params.Dout - outbound
+				backoff := gs.backoff[topic]
+				plst := gs.selectPeers(topic, ineed, func(p peer.ID) bool {
+					// filter our current and direct peers, peers we are backing off, and peers with negative score
+					_, inMesh := peers[p]
+					_, doBackoff := backoff[p]
+					_, direct := gs.direct[p]
+					return !inMesh && !doBackoff && !direct && gs.outbound[p] && gs.score.Score(p) >= 0
+				})
+
+				for _, p := range plst {
+					graftPeer(p)
+				}
+			}
+		}
+
 		// should we try to improve the mesh with opportunistic grafting?
-		if gs.heartbeatTicks%GossipSubOpportunisticGraftTicks == 0 && len(peers) > 1 {
+		if gs.heartbeatTicks%gs.params.OpportunisticGraftTicks == 0 && len(peers) > 1 {
 			// Opportunistic grafting works as follows: we check the median score of peers in the
 			// mesh; if this score is below the opportunisticGraftThreshold, we select a few peers at
 			// random with score over the median.
@@ -1023,7 +1737,7 @@ func (gs *GossipSubRouter) heartbeat() {
 			// if the median score is below the threshold, select a better peer (if any) and GRAFT
 			if medianScore < gs.opportunisticGraftThreshold {
 				backoff := gs.backoff[topic]
-				plst = gs.getPeers(topic, GossipSubOpportunisticGraftPeers, func(p peer.ID) bool {
+				plst = gs.selectPeers(topic, gs.params.OpportunisticGraftPeers, func(p peer.ID) bool {
 					_, inMesh := peers[p]
 					_, doBackoff := backoff[p]
 					_, direct := gs.direct[p]
@@ -1047,7 +1761,7 @@ func (gs *GossipSubRouter) heartbeat() {
 	// expire fanout for topics we haven't published to in a while
 	now := time.Now().UnixNano()
 	for topic, lastpub := range gs.lastpub {
-		if lastpub+int64(GossipSubFanoutTTL) < now {
+		if lastpub+int64(gs.params.FanoutTTL) < now {
 			delete(gs.fanout, topic)
 			delete(gs.lastpub, topic)
 		}
@@ -1064,8 +1778,8 @@ func (gs *GossipSubRouter) heartbeat() {
 		}
 
 		// do we need more peers?
-		if len(peers) < GossipSubD {
-			ineed := GossipSubD - len(peers)
+		if D := gs.topicParams(topic).D; len(peers) < D {
+			ineed := D - len(peers)
 			plst := gs.getPeers(topic, ineed, func(p peer.ID) bool {
 				// filter our current and direct peers and peers with score above the publish threshold
 				_, inFanout := peers[p]
@@ -1105,6 +1819,26 @@ func (gs *GossipSubRouter) clearIHaveCounters() {
 	}
 }
 
+func (gs *GossipSubRouter) applyIwantPenalties() {
+	for p, count := range gs.gossipTracer.GetBrokenPromises() {
+		log.Infof("peer %s didn't follow up in %d IWANT requests; adding penalty", p, count)
+		gs.score.AddPenalty(p, count)
+	}
+}
+
+func (gs *GossipSubRouter) clearIDontWant() {
+	for p, unwanted := range gs.unwanted {
+		for mid, expire := range unwanted {
+			if expire <= gs.heartbeatTicks {
+				delete(unwanted, mid)
+			}
+		}
+		if len(unwanted) == 0 {
+			delete(gs.unwanted, p)
+		}
+	}
+}
+
 func (gs *GossipSubRouter) clearBackoff() {
 	// we only clear once every 15 ticks to avoid iterating over the map(s) too much
 	if gs.heartbeatTicks%15 != 0 {
@@ -1127,7 +1861,7 @@ func (gs *GossipSubRouter) clearBackoff() {
 func (gs *GossipSubRouter) directConnect() {
 	// we donly do this every some ticks to allow pending connections to complete and account
 	// for restarts/downtime
-	if gs.heartbeatTicks%GossipSubDirectConnectTicks != 0 {
+	if gs.heartbeatTicks%gs.params.DirectConnectTicks != 0 {
 		return
 	}
 
@@ -1161,22 +1895,22 @@ func (gs *GossipSubRouter) sendGraftPrune(tograft, toprune map[peer.ID][]string,
 			delete(toprune, p)
 			prune = make([]*pb.ControlPrune, 0, len(pruning))
 			for _, topic := range pruning {
-				prune = append(prune, gs.makePrune(p, topic, gs.doPX && !noPX[p]))
+				prune = append(prune, gs.makePrune(p, topic, gs.doPX && !noPX[p], false))
 			}
 		}
 
 		out := rpcWithControl(nil, nil, nil, graft, prune)
-		gs.sendRPC(p, out)
+		gs.sendRPC(p, out, rpcPriorityControl)
 	}
 
 	for p, topics := range toprune {
 		prune := make([]*pb.ControlPrune, 0, len(topics))
 		for _, topic := range topics {
-			prune = append(prune, gs.makePrune(p, topic, gs.doPX && !noPX[p]))
+			prune = append(prune, gs.makePrune(p, topic, gs.doPX && !noPX[p], false))
 		}
 
 		out := rpcWithControl(nil, nil, nil, nil, prune)
-		gs.sendRPC(p, out)
+		gs.sendRPC(p, out, rpcPriorityControl)
 	}
 
 }
@@ -1192,8 +1926,8 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 	// shuffle to emit in random order
 	shuffleStrings(mids)
 
-	// if we are emitting more than GossipSubMaxIHaveLength mids, truncate the list
-	if len(mids) > GossipSubMaxIHaveLength {
+	// if we are emitting more than MaxIHaveLength mids, truncate the list
+	if len(mids) > gs.params.MaxIHaveLength {
 		// we do the truncation (with shuffling) per peer below
 		log.Debugf("too many messages for gossip; will truncate IHAVE list (%d messages)", len(mids))
 	}
@@ -1206,13 +1940,14 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 	for p := range gs.p.topics[topic] {
 		_, inExclude := exclude[p]
 		_, direct := gs.direct[p]
-		if !inExclude && !direct && (gs.peers[p] == GossipSubID_v10 || gs.peers[p] == GossipSubID_v11) && gs.score.Score(p) >= gs.gossipThreshold {
+		if !inExclude && !direct && (gs.peers[p] == GossipSubID_v10 || gs.peers[p] == GossipSubID_v11 || gs.peers[p] == GossipSubID_v12) && gs.score.Score(p) >= gs.gossipThreshold {
 			peers = append(peers, p)
 		}
 	}
 
-	target := GossipSubDlazy
-	factor := int(GossipSubGossipFactor * float64(len(peers)))
+	params := gs.topicParams(topic)
+	target := params.Dlazy
+	factor := int(params.GossipFactor * float64(len(peers)))
 	if factor > target {
 		target = factor
 	}
@@ -1227,11 +1962,11 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 	// Emit the IHAVE gossip to the selected peers.
 	for _, p := range peers {
 		peerMids := mids
-		if len(mids) > GossipSubMaxIHaveLength {
+		if len(mids) > gs.params.MaxIHaveLength {
 			// we do this per peer so that we emit a different set for each peer.
 			// we have enough redundancy in the system that this will significantly increase the message
 			// coverage when we do truncate.
-			peerMids = make([]string, GossipSubMaxIHaveLength)
+			peerMids = make([]string, gs.params.MaxIHaveLength)
 			shuffleStrings(mids)
 			copy(peerMids, mids)
 		}
@@ -1240,18 +1975,18 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 }
 
 func (gs *GossipSubRouter) flush() {
-	// send gossip first, which will also piggyback pending control
-	for p, ihave := range gs.gossip {
-		delete(gs.gossip, p)
-		out := rpcWithControl(nil, ihave, nil, nil, nil)
-		gs.sendRPC(p, out)
-	}
-
-	// send the remaining control messages that wasn't merged with gossip
+	// send pending control first, which will also piggyback gossip
 	for p, ctl := range gs.control {
 		delete(gs.control, p)
 		out := rpcWithControl(nil, nil, nil, ctl.Graft, ctl.Prune)
-		gs.sendRPC(p, out)
+		gs.sendRPC(p, out, rpcPriorityControl)
+	}
+
+	// send the remaining gossip that wasn't merged with control
+	for p, ihave := range gs.gossip {
+		delete(gs.gossip, p)
+		out := rpcWithControl(nil, ihave, nil, nil, nil)
+		gs.sendRPC(p, out, rpcPriorityGossip)
 	}
 }
 
@@ -1272,9 +2007,10 @@ func (gs *GossipSubRouter) piggybackGossip(p peer.ID, out *RPC, ihave []*pb.Cont
 }
 
 func (gs *GossipSubRouter) pushControl(p peer.ID, ctl *pb.ControlMessage) {
-	// remove IHAVE/IWANT from control message, gossip is not retried
+	// remove IHAVE/IWANT/IDONTWANT from control message, gossip is not retried
 	ctl.Ihave = nil
 	ctl.Iwant = nil
+	ctl.Idontwant = nil
 	if ctl.Graft != nil || ctl.Prune != nil {
 		gs.control[p] = ctl
 	}
@@ -1328,16 +2064,22 @@ func (gs *GossipSubRouter) piggybackControl(p peer.ID, out *RPC, ctl *pb.Control
 	}
 }
 
-func (gs *GossipSubRouter) makePrune(p peer.ID, topic string, doPX bool) *pb.ControlPrune {
+func (gs *GossipSubRouter) makePrune(p peer.ID, topic string, doPX bool, isUnsubscribe bool) *pb.ControlPrune {
 	if gs.peers[p] == GossipSubID_v10 {
-		// GossipSub v1.0 -- no peer exchange, the peer won't be able to parse it anyway
+		// GossipSub v1.0 -- no peer exchange or backoff, the peer won't be able to parse it anyway
 		return &pb.ControlPrune{TopicID: &topic}
 	}
 
+	// the backoff we want the peer to observe before GRAFTing us again
+	backoff := uint64(gs.params.PruneBackoff / time.Second)
+	if isUnsubscribe {
+		backoff = uint64(gs.params.UnsubscribeBackoff / time.Second)
+	}
+
 	var px []*pb.PeerInfo
 	if doPX {
 		// select peers for Peer eXchange
-		peers := gs.getPeers(topic, GossipSubPrunePeers, func(xp peer.ID) bool {
+		peers := gs.getPeers(topic, gs.params.PrunePeers, func(xp peer.ID) bool {
 			return p != xp && gs.score.Score(xp) >= 0
 		})
 
@@ -1362,7 +2104,7 @@ func (gs *GossipSubRouter) makePrune(p peer.ID, topic string, doPX bool) *pb.Con
 		}
 	}
 
-	return &pb.ControlPrune{TopicID: &topic, Peers: px}
+	return &pb.ControlPrune{TopicID: &topic, Peers: px, Backoff: &backoff}
 }
 
 func (gs *GossipSubRouter) getPeers(topic string, count int, filter func(peer.ID) bool) []peer.ID {
@@ -1373,13 +2115,25 @@ func (gs *GossipSubRouter) getPeers(topic string, count int, filter func(peer.ID
 
 	peers := make([]peer.ID, 0, len(tmap))
 	for p := range tmap {
-		if (gs.peers[p] == GossipSubID_v10 || gs.peers[p] == GossipSubID_v11) && filter(p) {
+		if (gs.peers[p] == GossipSubID_v10 || gs.peers[p] == GossipSubID_v11 || gs.peers[p] == GossipSubID_v12) && filter(p) {
 			peers = append(peers, p)
 		}
 	}
 
 	shufflePeers(peers)
 
+	// with bandwidth shaping, prefer peers with lower outbound queue delay; the delay is
+	// truncated so that peers with similar delays remain in random order
+	if gs.p.shaping() {
+		delay := make(map[peer.ID]time.Duration, len(peers))
+		for _, p := range peers {
+			delay[p] = gs.p.queueDelay(p).Truncate(time.Millisecond)
+		}
+		sort.SliceStable(peers, func(i, j int) bool {
+			return delay[peers[i]] < delay[peers[j]]
+		})
+	}
+
 	if count > 0 && len(peers) > count {
 		peers = peers[:count]
 	}
@@ -1387,11 +2141,92 @@ func (gs *GossipSubRouter) getPeers(topic string, count int, filter func(peer.ID
 	return peers
 }
 
+// selectPeers selects up to count peers to graft in the mesh for topic, among the peers passing
+// the filter, using the configured peer selection strategy.
+func (gs *GossipSubRouter) selectPeers(topic string, count int, filter func(peer.ID) bool) []peer.ID {
+	if count <= 0 {
+		return nil
+	}
+
+	// the default selector takes the first peers, so we don't need to enumerate candidates
+	if _, ok := gs.selector.(RandomPeerSelector); ok {
+		return gs.getPeers(topic, count, filter)
+	}
+
+	peers := gs.getPeers(topic, 0, filter)
+	if len(peers) == 0 {
+		return nil
+	}
+
+	candidates := make([]PeerCandidate, 0, len(peers))
+	for _, p := range peers {
+		candidates = append(candidates, gs.peerCandidate(p))
+	}
+
+	// the selector is user code, so make sure it honors the count and only selects candidates
+	eligible := peerListToMap(peers)
+	plst := make([]peer.ID, 0, count)
+	for _, p := range gs.selector.SelectPeers(topic, candidates, count) {
+		if len(plst) == count {
+			break
+		}
+		if _, ok := eligible[p]; !ok {
+			continue
+		}
+		delete(eligible, p)
+		plst = append(plst, p)
+	}
+
+	return plst
+}
+
+// peerCandidate returns the candidate presented to the peer selector for p; in the heartbeat,
+// the candidate is cached so that it is only built once across topics.
+func (gs *GossipSubRouter) peerCandidate(p peer.ID) PeerCandidate {
+	c, ok := gs.candidates[p]
+	if ok {
+		return c
+	}
+
+	conns := gs.p.host.Network().ConnsToPeer(p)
+	addrs := make([]ma.Multiaddr, 0, len(conns))
+	for _, conn := range conns {
+		addrs = append(addrs, conn.RemoteMultiaddr())
+	}
+
+	c = PeerCandidate{
+		ID:       p,
+		Protocol: gs.peers[p],
+		Score:    gs.score.Score(p),
+		Outbound: gs.outbound[p],
+		Addrs:    addrs,
+	}
+
+	if gs.candidates != nil {
+		gs.candidates[p] = c
+	}
+
+	return c
+}
+
 func (gs *GossipSubRouter) tagPeer(p peer.ID, topic string) {
 	tag := topicTag(topic)
 	gs.p.host.ConnManager().TagPeer(p, tag, 20)
 }
 
+func (gs *GossipSubRouter) setGraftTime(p peer.ID, topic string) {
+	grafted, ok := gs.grafted[topic]
+	if !ok {
+		grafted = make(map[peer.ID]time.Time)
+		gs.grafted[topic] = grafted
+	}
+	grafted[p] = time.Now()
+}
+
+func (gs *GossipSubRouter) clearGraftTime(p peer.ID, topic string) {
+	delete(gs.grafted[topic], p)
+}
+
 func (gs *GossipSubRouter) untagPeer(p peer.ID, topic string) {
 	tag := topicTag(topic)
 	gs.p.host.ConnManager().UntagPeer(p, tag)
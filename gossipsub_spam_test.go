@@ -668,3 +668,98 @@ func newMockGS(ctx context.Context, t *testing.T, attacker host.Host, onReadMsg
 		}
 	})
 }
+
+// Test that when Gossipsub receives IHAVEs for messages the peer doesn't deliver
+// when asked for with IWANT, it penalizes the peer
+func TestGossipsubAttackBrokenPromises(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create legitimate and attacker hosts
+	hosts := getNetHosts(t, ctx, 2)
+	legit := hosts[0]
+	attacker := hosts[1]
+
+	// Set up gossipsub on the legit host, with a short IWANT followup time
+	params := DefaultGossipSubParams()
+	params.IWantFollowupTime = 500 * time.Millisecond
+	ps, err := NewGossipSub(ctx, legit,
+		WithGossipSubParams(params),
+		WithPeerScore(
+			&PeerScoreParams{
+				AppSpecificScore:       func(peer.ID) float64 { return 0 },
+				BehaviourPenaltyWeight: -1,
+				BehaviourPenaltyDecay:  0.99,
+				DecayInterval:          time.Second,
+				DecayToZero:            0.01,
+			},
+			&PeerScoreThresholds{
+				GossipThreshold:   -100,
+				PublishThreshold:  -200,
+				GraylistThreshold: -300,
+			}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscribe to mytopic on the legit host
+	mytopic := "mytopic"
+	_, err = ps.Subscribe(mytopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getScore := func() float64 {
+		res := make(chan float64)
+		ps.eval <- func() {
+			res <- ps.rt.(*GossipSubRouter).score.Score(attacker.ID())
+		}
+		return <-res
+	}
+
+	var iwantCount int
+	var mx sync.Mutex
+	newMockGS(ctx, t, attacker, func(writeMsg func(*pb.RPC), irpc *pb.RPC) {
+		// When the legit host connects it will send us its subscriptions
+		for _, sub := range irpc.GetSubscriptions() {
+			if sub.GetSubscribe() {
+				// Reply by subcribing to the topic
+				writeMsg(&pb.RPC{
+					Subscriptions: []*pb.RPC_SubOpts{&pb.RPC_SubOpts{Subscribe: sub.Subscribe, Topicid: sub.Topicid}},
+				})
+
+				// Advertise a few messages we will never deliver
+				for i := 0; i < 3; i++ {
+					ihavelst := []string{"someid" + strconv.Itoa(i)}
+					ihave := []*pb.ControlIHave{&pb.ControlIHave{TopicID: sub.Topicid, MessageIDs: ihavelst}}
+					orpc := rpcWithControl(nil, ihave, nil, nil, nil)
+					writeMsg(&orpc.RPC)
+				}
+			}
+		}
+
+		// Record the count of received IWANT messages, and don't respond
+		if ctl := irpc.GetControl(); ctl != nil {
+			mx.Lock()
+			iwantCount += len(ctl.GetIwant())
+			mx.Unlock()
+		}
+	})
+
+	connect(t, hosts[0], hosts[1])
+
+	// Wait for the IWANTs and a heartbeat after the followup time
+	time.Sleep(100*time.Millisecond + params.IWantFollowupTime + params.HeartbeatInterval)
+
+	mx.Lock()
+	count := iwantCount
+	mx.Unlock()
+	if count != 3 {
+		t.Fatalf("expected 3 IWANTs, got %d", count)
+	}
+
+	// The attacker broke all its promises
+	if score := getScore(); score > -8 {
+		t.Fatalf("expected the attacker to be penalized for 3 broken promises, got score %f", score)
+	}
+}
@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 )
 
 func getGossipsub(ctx context.Context, h host.Host, opts ...Option) *PubSub {
@@ -982,3 +989,750 @@ func TestGossipsubStarTopology(t *testing.T) {
 		}
 	}
 }
+
+func TestGossipsubClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "pubsub-close")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tracer, err := NewJSONTracer(filepath.Join(dir, "trace.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := getNetHosts(t, ctx, 5)
+	psubs := []*PubSub{getGossipsub(ctx, hosts[0], WithEventTracer(tracer))}
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+	connectAll(t, hosts)
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		sub, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	// wait for the mesh to form
+	time.Sleep(2 * time.Second)
+
+	cctx, ccancel := context.WithTimeout(ctx, 5*time.Second)
+	defer ccancel()
+	if err := psubs[0].Close(cctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// our subscriptions have been cancelled
+	if _, err := subs[0].Next(ctx); err != ErrPubSubClosed {
+		t.Fatalf("expected ErrPubSubClosed, got %v", err)
+	}
+
+	// we can no longer publish
+	if err := psubs[0].Publish("test", []byte("hello")); err == nil {
+		t.Fatal("expected publish to fail after Close")
+	}
+
+	// our peers have seen us leave the topic and our mesh links are gone, while the
+	// connections are still open
+	time.Sleep(100 * time.Millisecond)
+	for _, ps := range psubs[1:] {
+		for _, pid := range ps.ListPeers("test") {
+			if pid == hosts[0].ID() {
+				t.Fatal("expected peer to have left the topic")
+			}
+		}
+
+		res := make(chan bool)
+		ps.eval <- func() {
+			_, ok := ps.rt.(*GossipSubRouter).mesh["test"][hosts[0].ID()]
+			res <- ok
+		}
+		if <-res {
+			t.Fatal("expected peer to have been pruned from the mesh")
+		}
+	}
+
+	// the remaining peers still work
+	if err := psubs[1].Publish("test", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range subs[1:] {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) != "hello" {
+			t.Fatal("unexpected message")
+		}
+	}
+
+	// the tracer has been flushed, but is still open
+	tracer.mx.Lock()
+	closed := tracer.closed
+	tracer.mx.Unlock()
+	if closed {
+		t.Fatal("expected the tracer to be left open")
+	}
+	defer tracer.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "trace.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"leave":{"topic":"test"}`)) {
+		t.Fatal("expected the LEAVE event to be traced")
+	}
+
+	// closing again is a no-op
+	if err := psubs[0].Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGossipsubParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	if err := params.validate(); err != nil {
+		t.Fatalf("invalid default parameters: %s", err)
+	}
+
+	hosts := getNetHosts(t, ctx, 2)
+
+	params.Dhi = params.D - 1
+	_, err := NewGossipSub(ctx, hosts[0], WithGossipSubParams(params))
+	if err == nil {
+		t.Fatal("expected invalid parameters to be rejected")
+	}
+
+	params = DefaultGossipSubParams()
+	params.HistoryGossip = params.HistoryLength + 1
+	_, err = NewGossipSub(ctx, hosts[1], WithGossipSubParams(params))
+	if err == nil {
+		t.Fatal("expected invalid parameters to be rejected")
+	}
+}
+
+func TestGossipsubPerInstanceParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 20)
+
+	// two routers in the same process with different mesh degrees
+	params := DefaultGossipSubParams()
+	params.D = 2
+	params.Dlo = 1
+	params.Dhi = 3
+	params.Dscore = 1
+	params.Dout = 0
+
+	psubs := []*PubSub{getGossipsub(ctx, hosts[0], WithGossipSubParams(params))}
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+
+	for _, ps := range psubs {
+		_, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	denseConnect(t, hosts)
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	meshSize := func(ps *PubSub) int {
+		res := make(chan int)
+		ps.eval <- func() {
+			res <- len(ps.rt.(*GossipSubRouter).mesh["test"])
+		}
+		return <-res
+	}
+
+	if n := meshSize(psubs[0]); n < params.Dlo || n > params.Dhi {
+		t.Fatalf("expected mesh degree between %d and %d, got %d", params.Dlo, params.Dhi, n)
+	}
+
+	for _, ps := range psubs[1:] {
+		if n := meshSize(ps); n < GossipSubDlo || n > GossipSubDhi {
+			t.Fatalf("expected mesh degree between %d and %d, got %d", GossipSubDlo, GossipSubDhi, n)
+		}
+	}
+}
+
+func TestGossipsubTopicParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 20)
+	psubs := getGossipsubs(ctx, hosts)
+
+	// a low degree mesh for one topic of the first router, with defaults for the other
+	params := GossipSubTopicParams{D: 2, Dlo: 1, Dhi: 3, Dscore: 1, Dlazy: 2, GossipFactor: 0.1}
+
+	_, err := psubs[0].Join("small", WithGossipSubTopicParams(GossipSubTopicParams{D: 2, Dlo: 3, Dhi: 1}))
+	if err == nil {
+		t.Fatal("expected error for invalid topic parameters")
+	}
+
+	var smallTopic *Topic
+	var smallSub *Subscription
+	for i, ps := range psubs {
+		var opts []TopicOpt
+		if i == 0 {
+			opts = append(opts, WithGossipSubTopicParams(params))
+		}
+
+		small, err := ps.Join("small", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub, err := small.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			smallTopic, smallSub = small, sub
+		}
+
+		_, err = ps.Subscribe("big")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	denseConnect(t, hosts)
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	meshSize := func(ps *PubSub, topic string) int {
+		res := make(chan int)
+		ps.eval <- func() {
+			res <- len(ps.rt.(*GossipSubRouter).mesh[topic])
+		}
+		return <-res
+	}
+
+	if n := meshSize(psubs[0], "small"); n < params.Dlo || n > params.Dhi {
+		t.Fatalf("expected mesh degree between %d and %d, got %d", params.Dlo, params.Dhi, n)
+	}
+
+	if n := meshSize(psubs[0], "big"); n < GossipSubDlo || n > GossipSubDhi {
+		t.Fatalf("expected mesh degree between %d and %d, got %d", GossipSubDlo, GossipSubDhi, n)
+	}
+
+	if !psubs[0].rt.EnoughPeers("small", 0) {
+		t.Fatal("expected enough peers in small topic")
+	}
+
+	gs := psubs[0].rt.(*GossipSubRouter)
+	topicParams := func(topic string) (GossipSubTopicParams, bool) {
+		type result struct {
+			params GossipSubTopicParams
+			ok     bool
+		}
+		res := make(chan result)
+		psubs[0].eval <- func() {
+			params, ok := gs.tparams[topic]
+			res <- result{params, ok}
+		}
+		r := <-res
+		return r.params, r.ok
+	}
+
+	// a failed join doesn't change the parameters of the topic
+	_, err = psubs[0].Join("small", WithGossipSubTopicParams(GossipSubTopicParams{D: 4, Dlo: 3, Dhi: 5}))
+	if err == nil {
+		t.Fatal("expected error joining an existing topic")
+	}
+	if p, ok := topicParams("small"); !ok || p != params {
+		t.Fatalf("expected the topic parameters to be unchanged, got %+v", p)
+	}
+
+	// and the parameters are dropped when the topic is closed
+	smallSub.Cancel()
+	time.Sleep(100 * time.Millisecond)
+	err = smallTopic.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := topicParams("small"); ok {
+		t.Fatal("expected the topic parameters to be dropped when the topic is closed")
+	}
+
+	// Dout defaults to the router's Dout, capped to the topic's degree
+	other, err := psubs[0].Join("other", WithGossipSubTopicParams(GossipSubTopicParams{D: 8, Dlo: 6, Dhi: 12}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := topicParams("other"); p.Dout != GossipSubDout {
+		t.Fatalf("expected Dout to default to %d, got %d", GossipSubDout, p.Dout)
+	}
+	other.Close()
+
+	_, err = psubs[0].Join("other", WithGossipSubTopicParams(GossipSubTopicParams{D: 4, Dlo: 2, Dhi: 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := topicParams("other"); p.Dout != 1 {
+		t.Fatalf("expected Dout to be capped to 1, got %d", p.Dout)
+	}
+}
+
+func TestGossipsubIDontWant(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+
+	params := DefaultGossipSubParams()
+	params.IDontWantMessageTTL = 2
+	msgID := func(pmsg *pb.Message) string {
+		return string(pmsg.GetData()[:8])
+	}
+	psubs := getGossipsubs(ctx, hosts, WithGossipSubParams(params), WithMessageIdFn(msgID))
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		sub, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	connectAll(t, hosts)
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	unwanted := func(ps *PubSub, p peer.ID, mid string) bool {
+		res := make(chan bool)
+		ps.eval <- func() {
+			_, ok := ps.rt.(*GossipSubRouter).unwanted[p][mid]
+			res <- ok
+		}
+		return <-res
+	}
+
+	publish := func(ps *PubSub, mid string, size int) {
+		data := make([]byte, size)
+		copy(data, mid)
+		err := ps.Publish("test", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receive := func(sub *Subscription, mid string) {
+		rctx, rcancel := context.WithTimeout(ctx, time.Second)
+		defer rcancel()
+
+		msg, err := sub.Next(rctx)
+		if err != nil {
+			t.Fatalf("expected message %s: %s", mid, err)
+		}
+		if got := msgID(msg.Message); got != mid {
+			t.Fatalf("expected message %s, got %s", mid, got)
+		}
+	}
+
+	// a large message: the first of the two other peers to receive it from the origin tells
+	// the other one not to send it
+	publish(psubs[0], "largemsg", 2*params.IDontWantMessageThreshold)
+	for _, sub := range subs {
+		receive(sub, "largemsg")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if !unwanted(psubs[1], hosts[2].ID(), "largemsg") && !unwanted(psubs[2], hosts[1].ID(), "largemsg") {
+		t.Fatal("expected IDONTWANT for large message")
+	}
+
+	// a small message is not worth an IDONTWANT
+	publish(psubs[0], "smallmsg", 100)
+	for _, sub := range subs {
+		receive(sub, "smallmsg")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if unwanted(psubs[1], hosts[2].ID(), "smallmsg") || unwanted(psubs[2], hosts[1].ID(), "smallmsg") {
+		t.Fatal("unexpected IDONTWANT for small message")
+	}
+
+	// the message ids expire after the TTL
+	time.Sleep(3 * time.Second)
+	if unwanted(psubs[1], hosts[2].ID(), "largemsg") || unwanted(psubs[2], hosts[1].ID(), "largemsg") {
+		t.Fatal("expected IDONTWANT to expire")
+	}
+
+	// we don't send messages to peers that don't want them
+	psubs[0].eval <- func() {
+		gs := psubs[0].rt.(*GossipSubRouter)
+		for _, h := range hosts[1:] {
+			gs.unwanted[h.ID()] = map[string]uint64{"skipmsg0": gs.heartbeatTicks + 10}
+		}
+	}
+	publish(psubs[0], "skipmsg0", 100)
+	publish(psubs[0], "sendmsg0", 100)
+	receive(subs[0], "skipmsg0")
+	receive(subs[0], "sendmsg0")
+	for _, sub := range subs[1:] {
+		receive(sub, "sendmsg0")
+	}
+
+	// the IDONTWANTs are sent before validation: the validators of the two other peers only
+	// accept the message once their IDONTWANT has reached the other one, well before the
+	// next heartbeat
+	validated := make(chan bool, 2)
+	for i := 1; i < 3; i++ {
+		self, other := hosts[i].ID(), psubs[3-i]
+		err := psubs[i].RegisterTopicValidator("test", func(ctx context.Context, _ peer.ID, msg *Message) bool {
+			if msgID(msg.Message) != "validate" {
+				return true
+			}
+
+			for start := time.Now(); time.Since(start) < 200*time.Millisecond; time.Sleep(10 * time.Millisecond) {
+				if unwanted(other, self, "validate") {
+					validated <- true
+					return true
+				}
+			}
+			validated <- false
+			return false
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish(psubs[0], "validate", 2*params.IDontWantMessageThreshold)
+	for i := 0; i < 2; i++ {
+		if !<-validated {
+			t.Fatal("expected the IDONTWANT to reach the mesh peer before validation completes")
+		}
+	}
+	for _, sub := range subs {
+		receive(sub, "validate")
+	}
+}
+
+func TestGossipsubOutboundQuota(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 11)
+
+	params := DefaultGossipSubParams()
+	params.D = 4
+	params.Dlo = 3
+	params.Dhi = 5
+	params.Dscore = 2
+	params.Dout = 2
+
+	psubs := []*PubSub{getGossipsub(ctx, hosts[0], WithGossipSubParams(params))}
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+
+	for _, ps := range psubs {
+		_, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first router dials two peers, while the rest dial it
+	for i, h := range hosts[1:] {
+		if i < params.Dout {
+			connect(t, h, hosts[0])
+		} else {
+			connect(t, hosts[0], h)
+		}
+	}
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(3 * time.Second)
+
+	res := make(chan []bool)
+	psubs[0].eval <- func() {
+		gs := psubs[0].rt.(*GossipSubRouter)
+		var mesh []bool
+		for p := range gs.mesh["test"] {
+			mesh = append(mesh, gs.outbound[p])
+		}
+		res <- mesh
+	}
+	mesh := <-res
+
+	if len(mesh) < params.Dlo || len(mesh) > params.Dhi {
+		t.Fatalf("expected mesh degree between %d and %d, got %d", params.Dlo, params.Dhi, len(mesh))
+	}
+
+	outbound := 0
+	for _, out := range mesh {
+		if out {
+			outbound++
+		}
+	}
+	if outbound < params.Dout {
+		t.Fatalf("expected at least %d outbound peers in the mesh, got %d", params.Dout, outbound)
+	}
+}
+
+func TestGossipsubPruneBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+
+	params := DefaultGossipSubParams()
+	params.UnsubscribeBackoff = 5 * time.Second
+
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithGossipSubParams(params)),
+		getGossipsub(ctx, hosts[1]),
+	}
+
+	sub, err := psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect(t, hosts[0], hosts[1])
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	inMesh := func(ps *PubSub, p peer.ID) bool {
+		res := make(chan bool)
+		ps.eval <- func() {
+			_, ok := ps.rt.(*GossipSubRouter).mesh["test"][p]
+			res <- ok
+		}
+		return <-res
+	}
+
+	if !inMesh(psubs[0], hosts[1].ID()) || !inMesh(psubs[1], hosts[0].ID()) {
+		t.Fatal("expected peers to be in each other's mesh")
+	}
+
+	// leave the topic; the PRUNE carries our unsubscribe backoff
+	start := time.Now()
+	sub.Cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	res := make(chan time.Time)
+	psubs[1].eval <- func() {
+		res <- psubs[1].rt.(*GossipSubRouter).backoff["test"][hosts[0].ID()]
+	}
+	expire := <-res
+
+	if expire.Before(start.Add(params.UnsubscribeBackoff)) || expire.After(time.Now().Add(params.UnsubscribeBackoff)) {
+		t.Fatalf("expected the peer to honor the unsubscribe backoff, got backoff until %s", expire)
+	}
+
+	// and we don't GRAFT the peer if we rejoin during the backoff
+	_, err = psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inMesh(psubs[0], hosts[1].ID()) {
+		t.Fatal("expected peer to be backed off when rejoining")
+	}
+}
+
+func TestGossipsubRuntimeDirectPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 4)
+
+	rt := DefaultGossipSubRouter()
+	if err := rt.AddDirectPeer(peer.AddrInfo{ID: hosts[1].ID()}); err == nil {
+		t.Fatal("expected error for router that is not attached")
+	}
+
+	psubs := []*PubSub{}
+	ps, err := NewGossipSubWithRouter(ctx, hosts[0], rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psubs = append(psubs, ps)
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+
+	for _, ps := range psubs {
+		_, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	state := func(p peer.ID) (inMesh, direct bool) {
+		done := make(chan struct{})
+		psubs[0].eval <- func() {
+			_, inMesh = rt.mesh["test"][p]
+			_, direct = rt.direct[p]
+			close(done)
+		}
+		<-done
+		return
+	}
+
+	if inMesh, direct := state(hosts[1].ID()); !inMesh || direct {
+		t.Fatal("expected peer to be in the mesh")
+	}
+
+	// make a mesh peer direct; it is pruned from the mesh
+	err = rt.AddDirectPeer(peer.AddrInfo{ID: hosts[1].ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inMesh, direct := state(hosts[1].ID()); inMesh || !direct {
+		t.Fatal("expected peer to be direct and not in the mesh")
+	}
+
+	// and its graft time is dropped
+	res := make(chan bool)
+	psubs[0].eval <- func() {
+		_, ok := rt.grafted["test"][hosts[1].ID()]
+		res <- ok
+	}
+	if <-res {
+		t.Fatal("expected the graft time of the pruned peer to be dropped")
+	}
+
+	// add a direct peer we are not connected to; we connect immediately
+	err = rt.AddDirectPeer(peer.AddrInfo{ID: hosts[3].ID(), Addrs: hosts[3].Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second)
+	if hosts[0].Network().Connectedness(hosts[3].ID()) != network.Connected {
+		t.Fatal("expected to be connected to the direct peer")
+	}
+	if inMesh, direct := state(hosts[3].ID()); inMesh || !direct {
+		t.Fatal("expected peer to be direct and not in the mesh")
+	}
+
+	// direct peers receive our messages
+	sub, err := psubs[3].Subscribe("direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = psubs[0].Publish("direct", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	_, err = sub.Next(rctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and demoted peers are regular peers again
+	err = rt.RemoveDirectPeer(hosts[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, direct := state(hosts[1].ID()); direct {
+		t.Fatal("expected peer to no longer be direct")
+	}
+}
+
+func TestGossipsubInspect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+
+	rt := DefaultGossipSubRouter()
+	ps, err := NewGossipSubWithRouter(ctx, hosts[0], rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psubs := append([]*PubSub{ps}, getGossipsubs(ctx, hosts[1:])...)
+
+	sub, err := psubs[0].Subscribe("mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ps := range psubs[1:] {
+		for _, topic := range []string{"mesh", "fanout"} {
+			_, err := ps.Subscribe(topic)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	connectAll(t, hosts)
+
+	// wait for heartbeats to build the mesh
+	time.Sleep(2 * time.Second)
+
+	start := time.Now()
+	err = psubs[0].Publish("fanout", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	state, err := rt.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mesh, ok := state["mesh"]
+	if !ok || len(mesh.Mesh) != 2 || len(mesh.Fanout) != 0 {
+		t.Fatalf("unexpected mesh topic state: %+v", mesh)
+	}
+	for _, h := range hosts[1:] {
+		grafted, ok := mesh.Mesh[h.ID()]
+		if !ok || grafted.IsZero() || grafted.After(start) {
+			t.Fatalf("unexpected graft time for %s: %s", h.ID(), grafted)
+		}
+	}
+
+	fanout, ok := state["fanout"]
+	if !ok || len(fanout.Mesh) != 0 || len(fanout.Fanout) != 2 || fanout.LastPublish.Before(start) {
+		t.Fatalf("unexpected fanout topic state: %+v", fanout)
+	}
+
+	// leaving the topic backs off the mesh peers
+	sub.Cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	mesh, err = rt.InspectTopic("mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Mesh) != 0 || len(mesh.Backoff) != 2 {
+		t.Fatalf("unexpected mesh topic state after leaving: %+v", mesh)
+	}
+}
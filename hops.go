@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"container/list"
+	"time"
+)
+
+// hopTracker tracks the hop counts of hop-limited messages by message ID.
+// The hop count travels in the RPC envelope rather than in the signed message, so we track it
+// from the time the message is received until it has been forwarded or served from the message
+// cache. Entries expire with the seen messages TTL, and expired entries are swept from the head
+// of the queue on every Add.
+// The tracker is only accessed from the event loop.
+type hopTracker struct {
+	ttl time.Duration
+
+	queue   *list.List
+	entries map[string]*list.Element
+}
+
+type hopEntry struct {
+	id     string
+	hops   uint32
+	expire time.Time
+}
+
+func newHopTracker(ttl time.Duration) *hopTracker {
+	return &hopTracker{
+		ttl:     ttl,
+		queue:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Add records the hop count of a message; if the message is already tracked, we keep the
+// smallest hop count, as it is the one the message will be forwarded with.
+func (ht *hopTracker) Add(id string, hops uint32) {
+	now := time.Now()
+	ht.sweep(now)
+
+	elt, ok := ht.entries[id]
+	if ok {
+		e := elt.Value.(*hopEntry)
+		if hops < e.hops {
+			e.hops = hops
+		}
+		return
+	}
+
+	ht.entries[id] = ht.queue.PushBack(&hopEntry{id: id, hops: hops, expire: now.Add(ht.ttl)})
+}
+
+// Get returns the hop count of a message, or 0 if the message is not tracked.
+func (ht *hopTracker) Get(id string) uint32 {
+	elt, ok := ht.entries[id]
+	if !ok {
+		return 0
+	}
+	return elt.Value.(*hopEntry).hops
+}
+
+func (ht *hopTracker) sweep(now time.Time) {
+	for elt := ht.queue.Front(); elt != nil; elt = ht.queue.Front() {
+		e := elt.Value.(*hopEntry)
+		if e.expire.After(now) {
+			return
+		}
+		ht.queue.Remove(elt)
+		delete(ht.entries, e.id)
+	}
+}
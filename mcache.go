@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"fmt"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
@@ -79,10 +80,16 @@ func (mc *MessageCache) GetForPeer(mid string, p peer.ID) (*pb.Message, int, boo
 	return m, tx[p], true
 }
 
+// GetGossipIDs returns the IDs of the messages in the gossip window for a topic, excluding
+// expired messages.
 func (mc *MessageCache) GetGossipIDs(topic string) []string {
 	var mids []string
+	now := time.Now()
 	for _, entries := range mc.history[:mc.gossip] {
 		for _, entry := range entries {
+			if messageExpired(mc.msgs[entry.mid], now) {
+				continue
+			}
 			for _, t := range entry.topics {
 				if t == topic {
 					mids = append(mids, entry.mid)
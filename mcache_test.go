@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"testing"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 )
@@ -164,3 +165,27 @@ func makeTestMessage(n int) *pb.Message {
 		Seqno:    seqno,
 	}
 }
+
+func TestMessageCacheExpiry(t *testing.T) {
+	mcache := NewMessageCache(3, 5)
+
+	expired := time.Now().Add(-time.Second).UnixNano()
+	fresh := time.Now().Add(time.Minute).UnixNano()
+
+	msgs := make([]*pb.Message, 10)
+	for i := range msgs {
+		msgs[i] = makeTestMessage(i)
+		switch i % 3 {
+		case 0:
+			msgs[i].Expiry = &expired
+		case 1:
+			msgs[i].Expiry = &fresh
+		}
+		mcache.Put(msgs[i])
+	}
+
+	gids := mcache.GetGossipIDs("test")
+	if len(gids) != 6 {
+		t.Fatalf("Expected 6 gossip IDs; got %d", len(gids))
+	}
+}
@@ -61,7 +61,7 @@ func (x *TopicDescriptor_AuthOpts_AuthMode) UnmarshalJSON(data []byte) error {
 }
 
 func (TopicDescriptor_AuthOpts_AuthMode) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8, 0, 0}
+	return fileDescriptor_77a6da22d6a3feb1, []int{10, 0, 0}
 }
 
 type TopicDescriptor_EncOpts_EncMode int32
@@ -104,13 +104,14 @@ func (x *TopicDescriptor_EncOpts_EncMode) UnmarshalJSON(data []byte) error {
 }
 
 func (TopicDescriptor_EncOpts_EncMode) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8, 1, 0}
+	return fileDescriptor_77a6da22d6a3feb1, []int{10, 1, 0}
 }
 
 type RPC struct {
 	Subscriptions        []*RPC_SubOpts  `protobuf:"bytes,1,rep,name=subscriptions" json:"subscriptions,omitempty"`
 	Publish              []*Message      `protobuf:"bytes,2,rep,name=publish" json:"publish,omitempty"`
 	Control              *ControlMessage `protobuf:"bytes,3,opt,name=control" json:"control,omitempty"`
+	Hops                 []uint32        `protobuf:"varint,4,rep,packed,name=hops" json:"hops,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
 	XXX_unrecognized     []byte          `json:"-"`
 	XXX_sizecache        int32           `json:"-"`
@@ -170,6 +171,13 @@ func (m *RPC) GetControl() *ControlMessage {
 	return nil
 }
 
+func (m *RPC) GetHops() []uint32 {
+	if m != nil {
+		return m.Hops
+	}
+	return nil
+}
+
 type RPC_SubOpts struct {
 	Subscribe            *bool    `protobuf:"varint,1,opt,name=subscribe" json:"subscribe,omitempty"`
 	Topicid              *string  `protobuf:"bytes,2,opt,name=topicid" json:"topicid,omitempty"`
@@ -226,15 +234,18 @@ func (m *RPC_SubOpts) GetTopicid() string {
 }
 
 type Message struct {
-	From                 []byte   `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
-	Data                 []byte   `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
-	Seqno                []byte   `protobuf:"bytes,3,opt,name=seqno" json:"seqno,omitempty"`
-	TopicIDs             []string `protobuf:"bytes,4,rep,name=topicIDs" json:"topicIDs,omitempty"`
-	Signature            []byte   `protobuf:"bytes,5,opt,name=signature" json:"signature,omitempty"`
-	Key                  []byte   `protobuf:"bytes,6,opt,name=key" json:"key,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	From                 []byte        `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	Data                 []byte        `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
+	Seqno                []byte        `protobuf:"bytes,3,opt,name=seqno" json:"seqno,omitempty"`
+	TopicIDs             []string      `protobuf:"bytes,4,rep,name=topicIDs" json:"topicIDs,omitempty"`
+	Signature            []byte        `protobuf:"bytes,5,opt,name=signature" json:"signature,omitempty"`
+	Key                  []byte        `protobuf:"bytes,6,opt,name=key" json:"key,omitempty"`
+	Expiry               *int64        `protobuf:"varint,7,opt,name=expiry" json:"expiry,omitempty"`
+	HopLimit             *uint32       `protobuf:"varint,8,opt,name=hopLimit" json:"hopLimit,omitempty"`
+	Chunk                *MessageChunk `protobuf:"bytes,10,opt,name=chunk" json:"chunk,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -312,21 +323,114 @@ func (m *Message) GetKey() []byte {
 	return nil
 }
 
+func (m *Message) GetExpiry() int64 {
+	if m != nil && m.Expiry != nil {
+		return *m.Expiry
+	}
+	return 0
+}
+
+func (m *Message) GetHopLimit() uint32 {
+	if m != nil && m.HopLimit != nil {
+		return *m.HopLimit
+	}
+	return 0
+}
+
+func (m *Message) GetChunk() *MessageChunk {
+	if m != nil {
+		return m.Chunk
+	}
+	return nil
+}
+
+type MessageChunk struct {
+	Root                 []byte   `protobuf:"bytes,1,opt,name=root" json:"root,omitempty"`
+	Index                *uint32  `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Count                *uint32  `protobuf:"varint,3,opt,name=count" json:"count,omitempty"`
+	Size_                *uint64  `protobuf:"varint,4,opt,name=size" json:"size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MessageChunk) Reset()         { *m = MessageChunk{} }
+func (m *MessageChunk) String() string { return proto.CompactTextString(m) }
+func (*MessageChunk) ProtoMessage()    {}
+func (*MessageChunk) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{2}
+}
+func (m *MessageChunk) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MessageChunk) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MessageChunk.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MessageChunk) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MessageChunk.Merge(m, src)
+}
+func (m *MessageChunk) XXX_Size() int {
+	return m.Size()
+}
+func (m *MessageChunk) XXX_DiscardUnknown() {
+	xxx_messageInfo_MessageChunk.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MessageChunk proto.InternalMessageInfo
+
+func (m *MessageChunk) GetRoot() []byte {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func (m *MessageChunk) GetIndex() uint32 {
+	if m != nil && m.Index != nil {
+		return *m.Index
+	}
+	return 0
+}
+
+func (m *MessageChunk) GetCount() uint32 {
+	if m != nil && m.Count != nil {
+		return *m.Count
+	}
+	return 0
+}
+
+func (m *MessageChunk) GetSize_() uint64 {
+	if m != nil && m.Size_ != nil {
+		return *m.Size_
+	}
+	return 0
+}
+
 type ControlMessage struct {
-	Ihave                []*ControlIHave `protobuf:"bytes,1,rep,name=ihave" json:"ihave,omitempty"`
-	Iwant                []*ControlIWant `protobuf:"bytes,2,rep,name=iwant" json:"iwant,omitempty"`
-	Graft                []*ControlGraft `protobuf:"bytes,3,rep,name=graft" json:"graft,omitempty"`
-	Prune                []*ControlPrune `protobuf:"bytes,4,rep,name=prune" json:"prune,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
-	XXX_unrecognized     []byte          `json:"-"`
-	XXX_sizecache        int32           `json:"-"`
+	Ihave                []*ControlIHave     `protobuf:"bytes,1,rep,name=ihave" json:"ihave,omitempty"`
+	Iwant                []*ControlIWant     `protobuf:"bytes,2,rep,name=iwant" json:"iwant,omitempty"`
+	Graft                []*ControlGraft     `protobuf:"bytes,3,rep,name=graft" json:"graft,omitempty"`
+	Prune                []*ControlPrune     `protobuf:"bytes,4,rep,name=prune" json:"prune,omitempty"`
+	Idontwant            []*ControlIDontWant `protobuf:"bytes,5,rep,name=idontwant" json:"idontwant,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
 }
 
 func (m *ControlMessage) Reset()         { *m = ControlMessage{} }
 func (m *ControlMessage) String() string { return proto.CompactTextString(m) }
 func (*ControlMessage) ProtoMessage()    {}
 func (*ControlMessage) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{2}
+	return fileDescriptor_77a6da22d6a3feb1, []int{3}
 }
 func (m *ControlMessage) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -383,6 +487,13 @@ func (m *ControlMessage) GetPrune() []*ControlPrune {
 	return nil
 }
 
+func (m *ControlMessage) GetIdontwant() []*ControlIDontWant {
+	if m != nil {
+		return m.Idontwant
+	}
+	return nil
+}
+
 type ControlIHave struct {
 	TopicID              *string  `protobuf:"bytes,1,opt,name=topicID" json:"topicID,omitempty"`
 	MessageIDs           []string `protobuf:"bytes,2,rep,name=messageIDs" json:"messageIDs,omitempty"`
@@ -395,7 +506,7 @@ func (m *ControlIHave) Reset()         { *m = ControlIHave{} }
 func (m *ControlIHave) String() string { return proto.CompactTextString(m) }
 func (*ControlIHave) ProtoMessage()    {}
 func (*ControlIHave) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{3}
+	return fileDescriptor_77a6da22d6a3feb1, []int{4}
 }
 func (m *ControlIHave) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -449,7 +560,7 @@ func (m *ControlIWant) Reset()         { *m = ControlIWant{} }
 func (m *ControlIWant) String() string { return proto.CompactTextString(m) }
 func (*ControlIWant) ProtoMessage()    {}
 func (*ControlIWant) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{4}
+	return fileDescriptor_77a6da22d6a3feb1, []int{5}
 }
 func (m *ControlIWant) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -496,7 +607,7 @@ func (m *ControlGraft) Reset()         { *m = ControlGraft{} }
 func (m *ControlGraft) String() string { return proto.CompactTextString(m) }
 func (*ControlGraft) ProtoMessage()    {}
 func (*ControlGraft) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{5}
+	return fileDescriptor_77a6da22d6a3feb1, []int{6}
 }
 func (m *ControlGraft) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -532,9 +643,57 @@ func (m *ControlGraft) GetTopicID() string {
 	return ""
 }
 
+type ControlIDontWant struct {
+	MessageIDs           []string `protobuf:"bytes,1,rep,name=messageIDs" json:"messageIDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ControlIDontWant) Reset()         { *m = ControlIDontWant{} }
+func (m *ControlIDontWant) String() string { return proto.CompactTextString(m) }
+func (*ControlIDontWant) ProtoMessage()    {}
+func (*ControlIDontWant) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{7}
+}
+func (m *ControlIDontWant) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ControlIDontWant) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ControlIDontWant.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ControlIDontWant) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ControlIDontWant.Merge(m, src)
+}
+func (m *ControlIDontWant) XXX_Size() int {
+	return m.Size()
+}
+func (m *ControlIDontWant) XXX_DiscardUnknown() {
+	xxx_messageInfo_ControlIDontWant.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ControlIDontWant proto.InternalMessageInfo
+
+func (m *ControlIDontWant) GetMessageIDs() []string {
+	if m != nil {
+		return m.MessageIDs
+	}
+	return nil
+}
+
 type ControlPrune struct {
 	TopicID              *string     `protobuf:"bytes,1,opt,name=topicID" json:"topicID,omitempty"`
 	Peers                []*PeerInfo `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+	Backoff              *uint64     `protobuf:"varint,3,opt,name=backoff" json:"backoff,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
 	XXX_unrecognized     []byte      `json:"-"`
 	XXX_sizecache        int32       `json:"-"`
@@ -544,7 +703,7 @@ func (m *ControlPrune) Reset()         { *m = ControlPrune{} }
 func (m *ControlPrune) String() string { return proto.CompactTextString(m) }
 func (*ControlPrune) ProtoMessage()    {}
 func (*ControlPrune) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{6}
+	return fileDescriptor_77a6da22d6a3feb1, []int{8}
 }
 func (m *ControlPrune) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -587,6 +746,13 @@ func (m *ControlPrune) GetPeers() []*PeerInfo {
 	return nil
 }
 
+func (m *ControlPrune) GetBackoff() uint64 {
+	if m != nil && m.Backoff != nil {
+		return *m.Backoff
+	}
+	return 0
+}
+
 type PeerInfo struct {
 	PeerID               []byte   `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
 	SignedPeerRecord     []byte   `protobuf:"bytes,2,opt,name=signedPeerRecord" json:"signedPeerRecord,omitempty"`
@@ -599,7 +765,7 @@ func (m *PeerInfo) Reset()         { *m = PeerInfo{} }
 func (m *PeerInfo) String() string { return proto.CompactTextString(m) }
 func (*PeerInfo) ProtoMessage()    {}
 func (*PeerInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{7}
+	return fileDescriptor_77a6da22d6a3feb1, []int{9}
 }
 func (m *PeerInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -655,7 +821,7 @@ func (m *TopicDescriptor) Reset()         { *m = TopicDescriptor{} }
 func (m *TopicDescriptor) String() string { return proto.CompactTextString(m) }
 func (*TopicDescriptor) ProtoMessage()    {}
 func (*TopicDescriptor) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8}
+	return fileDescriptor_77a6da22d6a3feb1, []int{10}
 }
 func (m *TopicDescriptor) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -717,7 +883,7 @@ func (m *TopicDescriptor_AuthOpts) Reset()         { *m = TopicDescriptor_AuthOp
 func (m *TopicDescriptor_AuthOpts) String() string { return proto.CompactTextString(m) }
 func (*TopicDescriptor_AuthOpts) ProtoMessage()    {}
 func (*TopicDescriptor_AuthOpts) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8, 0}
+	return fileDescriptor_77a6da22d6a3feb1, []int{10, 0}
 }
 func (m *TopicDescriptor_AuthOpts) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -772,7 +938,7 @@ func (m *TopicDescriptor_EncOpts) Reset()         { *m = TopicDescriptor_EncOpts
 func (m *TopicDescriptor_EncOpts) String() string { return proto.CompactTextString(m) }
 func (*TopicDescriptor_EncOpts) ProtoMessage()    {}
 func (*TopicDescriptor_EncOpts) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8, 1}
+	return fileDescriptor_77a6da22d6a3feb1, []int{10, 1}
 }
 func (m *TopicDescriptor_EncOpts) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -821,10 +987,12 @@ func init() {
 	proto.RegisterType((*RPC)(nil), "pubsub.pb.RPC")
 	proto.RegisterType((*RPC_SubOpts)(nil), "pubsub.pb.RPC.SubOpts")
 	proto.RegisterType((*Message)(nil), "pubsub.pb.Message")
+	proto.RegisterType((*MessageChunk)(nil), "pubsub.pb.MessageChunk")
 	proto.RegisterType((*ControlMessage)(nil), "pubsub.pb.ControlMessage")
 	proto.RegisterType((*ControlIHave)(nil), "pubsub.pb.ControlIHave")
 	proto.RegisterType((*ControlIWant)(nil), "pubsub.pb.ControlIWant")
 	proto.RegisterType((*ControlGraft)(nil), "pubsub.pb.ControlGraft")
+	proto.RegisterType((*ControlIDontWant)(nil), "pubsub.pb.ControlIDontWant")
 	proto.RegisterType((*ControlPrune)(nil), "pubsub.pb.ControlPrune")
 	proto.RegisterType((*PeerInfo)(nil), "pubsub.pb.PeerInfo")
 	proto.RegisterType((*TopicDescriptor)(nil), "pubsub.pb.TopicDescriptor")
@@ -835,48 +1003,52 @@ func init() {
 func init() { proto.RegisterFile("rpc.proto", fileDescriptor_77a6da22d6a3feb1) }
 
 var fileDescriptor_77a6da22d6a3feb1 = []byte{
-	// 655 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x93, 0xcf, 0x6e, 0xd3, 0x4e,
-	0x10, 0xc7, 0x7f, 0x1b, 0x27, 0x75, 0x3c, 0x75, 0xfb, 0x8b, 0x16, 0x54, 0x4c, 0x54, 0x45, 0x91,
-	0x91, 0x50, 0x28, 0xc5, 0x87, 0x80, 0xc4, 0x05, 0x21, 0x4a, 0x13, 0x91, 0x08, 0xb5, 0x8d, 0xb6,
-	0x95, 0x2a, 0x8e, 0xb6, 0xb3, 0x6d, 0xac, 0x36, 0x5e, 0xe3, 0x3f, 0x45, 0x7d, 0x03, 0xee, 0xf0,
-	0x2c, 0x3c, 0x03, 0x07, 0x0e, 0x3c, 0x02, 0xea, 0x8d, 0xb7, 0x40, 0x3b, 0xde, 0x38, 0x4e, 0xd3,
-	0x16, 0x4e, 0x9e, 0x1d, 0x7f, 0xbe, 0x33, 0xdf, 0x19, 0x7b, 0xc1, 0x88, 0x23, 0xdf, 0x89, 0x62,
-	0x91, 0x0a, 0x6a, 0x44, 0x99, 0x97, 0x64, 0x9e, 0x13, 0x79, 0xf6, 0x6f, 0x02, 0x1a, 0x1b, 0xed,
-	0xd2, 0x57, 0xb0, 0x96, 0x64, 0x5e, 0xe2, 0xc7, 0x41, 0x94, 0x06, 0x22, 0x4c, 0x2c, 0xd2, 0xd6,
-	0x3a, 0xab, 0xdd, 0x0d, 0xa7, 0x40, 0x1d, 0x36, 0xda, 0x75, 0x0e, 0x33, 0xef, 0x20, 0x4a, 0x13,
-	0xb6, 0x08, 0xd3, 0x6d, 0xd0, 0xa3, 0xcc, 0x3b, 0x0f, 0x92, 0x89, 0x55, 0x41, 0x1d, 0x2d, 0xe9,
-	0xf6, 0x78, 0x92, 0xb8, 0xa7, 0x9c, 0xcd, 0x10, 0xfa, 0x1c, 0x74, 0x5f, 0x84, 0x69, 0x2c, 0xce,
-	0x2d, 0xad, 0x4d, 0x3a, 0xab, 0xdd, 0x87, 0x25, 0x7a, 0x37, 0x7f, 0x53, 0x88, 0x14, 0xd9, 0xdc,
-	0x01, 0x5d, 0x35, 0xa7, 0x9b, 0x60, 0xa8, 0xf6, 0x1e, 0xb7, 0x48, 0x9b, 0x74, 0xea, 0x6c, 0x9e,
-	0xa0, 0x16, 0xe8, 0xa9, 0x88, 0x02, 0x3f, 0x18, 0x5b, 0x95, 0x36, 0xe9, 0x18, 0x6c, 0x76, 0xb4,
-	0xbf, 0x10, 0xd0, 0x55, 0x5d, 0x4a, 0xa1, 0x7a, 0x12, 0x8b, 0x29, 0xca, 0x4d, 0x86, 0xb1, 0xcc,
-	0x8d, 0xdd, 0xd4, 0x45, 0x99, 0xc9, 0x30, 0xa6, 0xf7, 0xa1, 0x96, 0xf0, 0x8f, 0xa1, 0x40, 0xa7,
-	0x26, 0xcb, 0x0f, 0xb4, 0x09, 0x75, 0x2c, 0x3a, 0xec, 0x25, 0x56, 0xb5, 0xad, 0x75, 0x0c, 0x56,
-	0x9c, 0xd1, 0x5d, 0x70, 0x1a, 0xba, 0x69, 0x16, 0x73, 0xab, 0x86, 0xaa, 0x79, 0x82, 0x36, 0x40,
-	0x3b, 0xe3, 0x97, 0xd6, 0x0a, 0xe6, 0x65, 0x68, 0xff, 0x20, 0xb0, 0xbe, 0x38, 0x34, 0x7d, 0x06,
-	0xb5, 0x60, 0xe2, 0x5e, 0x70, 0xf5, 0x11, 0x1e, 0x2c, 0xaf, 0x67, 0x38, 0x70, 0x2f, 0x38, 0xcb,
-	0x29, 0xc4, 0x3f, 0xb9, 0x61, 0xaa, 0x76, 0x7f, 0x13, 0x7e, 0xec, 0x86, 0x29, 0xcb, 0x29, 0x89,
-	0x9f, 0xc6, 0xee, 0x49, 0x6a, 0x69, 0xb7, 0xe1, 0xef, 0xe4, 0x6b, 0x96, 0x53, 0x12, 0x8f, 0xe2,
-	0x2c, 0xe4, 0x38, 0xe8, 0x8d, 0xf8, 0x48, 0xbe, 0x66, 0x39, 0x65, 0x0f, 0xc0, 0x2c, 0x7b, 0x2c,
-	0x3e, 0xc7, 0xb0, 0x87, 0xbb, 0x9e, 0x7d, 0x8e, 0x61, 0x8f, 0xb6, 0x00, 0xa6, 0xf9, 0xc0, 0x72,
-	0x8d, 0x15, 0x5c, 0x63, 0x29, 0x63, 0x3b, 0xf3, 0x4a, 0xd2, 0xfe, 0x35, 0x9e, 0x2c, 0xf1, 0x9d,
-	0x82, 0x47, 0xff, 0xb7, 0x77, 0xb6, 0x0f, 0x0b, 0x12, 0xad, 0xdf, 0xe1, 0xf1, 0x09, 0xd4, 0x22,
-	0xce, 0xe3, 0x44, 0xad, 0xf6, 0x5e, 0x69, 0xf8, 0x11, 0xe7, 0xf1, 0x30, 0x3c, 0x11, 0x2c, 0x27,
-	0xec, 0x7d, 0xa8, 0xcf, 0x52, 0x74, 0x03, 0x56, 0x64, 0x52, 0xd5, 0x33, 0x99, 0x3a, 0xd1, 0x2d,
-	0x68, 0xc8, 0x5f, 0x81, 0x8f, 0x25, 0xc9, 0xb8, 0x2f, 0xe2, 0xb1, 0xfa, 0xdb, 0x96, 0xf2, 0xf6,
-	0x37, 0x0d, 0xfe, 0x3f, 0x92, 0x36, 0x7a, 0x3c, 0xbf, 0x69, 0x22, 0x96, 0x7f, 0x68, 0xe8, 0x4e,
-	0xb9, 0x72, 0x89, 0x31, 0x7d, 0x09, 0x55, 0x37, 0x4b, 0x27, 0x58, 0x67, 0xb5, 0xfb, 0xa8, 0xe4,
-	0xf0, 0x9a, 0xda, 0xd9, 0xc9, 0xd2, 0x09, 0xde, 0x5e, 0x14, 0xd0, 0x17, 0xa0, 0xf1, 0xd0, 0x57,
-	0x57, 0xd0, 0xbe, 0x43, 0xd7, 0x0f, 0x7d, 0x94, 0x49, 0xbc, 0xf9, 0x99, 0x40, 0x7d, 0x56, 0x88,
-	0xbe, 0x81, 0xea, 0x54, 0x8c, 0x73, 0x3f, 0xeb, 0xdd, 0xed, 0x7f, 0xe8, 0x8d, 0xc1, 0x9e, 0x18,
-	0x73, 0x86, 0x4a, 0x39, 0xd1, 0x19, 0xbf, 0xcc, 0xf7, 0x6b, 0x32, 0x8c, 0xed, 0xc7, 0x79, 0x07,
-	0x49, 0xd1, 0x3a, 0x54, 0xf7, 0x0f, 0xf6, 0xfb, 0x8d, 0xff, 0xa8, 0x0e, 0xda, 0xfb, 0xfe, 0x87,
-	0x06, 0x91, 0xc1, 0xf1, 0xc1, 0x51, 0xa3, 0xd2, 0xfc, 0x4a, 0x40, 0x57, 0xde, 0xe8, 0xeb, 0x05,
-	0x27, 0x5b, 0x7f, 0x9f, 0x46, 0x3e, 0x4b, 0x3e, 0x36, 0xc1, 0x38, 0xe3, 0x97, 0x03, 0x37, 0x99,
-	0xf0, 0x99, 0x99, 0x79, 0xc2, 0x7e, 0x8a, 0x8d, 0xae, 0x19, 0x5a, 0x03, 0xe3, 0x70, 0xb0, 0xc3,
-	0xfa, 0xbd, 0x45, 0x5b, 0x6f, 0xcd, 0xef, 0x57, 0x2d, 0xf2, 0xf3, 0xaa, 0x45, 0x7e, 0x5d, 0xb5,
-	0xc8, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x58, 0xd6, 0x7d, 0x1f, 0x77, 0x05, 0x00, 0x00,
+	// 706 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x93, 0xc1, 0x6e, 0xd3, 0x4c,
+	0x10, 0xc7, 0xbf, 0x8d, 0x9d, 0x3a, 0x9e, 0xd8, 0xa9, 0xeb, 0x4f, 0xfa, 0xea, 0xaf, 0x48, 0xc5,
+	0x72, 0xa5, 0xc8, 0x2a, 0x34, 0x88, 0xc0, 0x01, 0x71, 0x6b, 0x93, 0x88, 0x44, 0xd0, 0x36, 0x4a,
+	0x2b, 0x55, 0x1c, 0x6d, 0x67, 0x53, 0x5b, 0x69, 0x76, 0x8d, 0xbd, 0x2e, 0x0d, 0xe2, 0xc6, 0x81,
+	0xd7, 0xe1, 0x29, 0x10, 0x47, 0x1e, 0xa1, 0xea, 0x93, 0xa0, 0x5d, 0x3b, 0x69, 0x92, 0xb6, 0xc0,
+	0xc9, 0x5e, 0xcd, 0x6f, 0xe6, 0xff, 0x9f, 0xd9, 0x1d, 0x50, 0x93, 0x38, 0x68, 0xc4, 0x09, 0x65,
+	0xd4, 0x54, 0xe3, 0xcc, 0x4f, 0x33, 0xbf, 0x11, 0xfb, 0xce, 0x77, 0x04, 0xd2, 0xa0, 0xdf, 0x32,
+	0xf7, 0x40, 0x4f, 0x33, 0x3f, 0x0d, 0x92, 0x28, 0x66, 0x11, 0x25, 0xa9, 0x85, 0x6c, 0xc9, 0xad,
+	0x36, 0xff, 0x6b, 0xcc, 0xd1, 0xc6, 0xa0, 0xdf, 0x6a, 0x9c, 0x64, 0xfe, 0x71, 0xcc, 0x52, 0x73,
+	0x07, 0x94, 0x38, 0xf3, 0x2f, 0xa2, 0x34, 0xb4, 0x4a, 0x02, 0x34, 0x17, 0xc0, 0x43, 0x9c, 0xa6,
+	0xde, 0x39, 0x36, 0x77, 0x41, 0x09, 0x28, 0x61, 0x09, 0xbd, 0xb0, 0x24, 0x1b, 0xb9, 0xd5, 0xe6,
+	0xff, 0x0b, 0x50, 0x2b, 0x8f, 0xcc, 0x58, 0x03, 0xe4, 0x90, 0xc6, 0xa9, 0x25, 0xdb, 0x92, 0xab,
+	0x1f, 0x94, 0x0c, 0xb4, 0xb5, 0x07, 0xca, 0x4c, 0x6d, 0x03, 0xd4, 0xc2, 0x9c, 0x8f, 0x2d, 0x64,
+	0x23, 0xb7, 0x62, 0xae, 0x83, 0xc2, 0x68, 0x1c, 0x05, 0xd1, 0xd0, 0x2a, 0xd9, 0xc8, 0x55, 0x9d,
+	0x6f, 0x08, 0x94, 0x59, 0x31, 0x0d, 0xe4, 0x51, 0x42, 0x27, 0x02, 0xd5, 0xf8, 0x69, 0xe8, 0x31,
+	0x4f, 0x70, 0x9a, 0xa9, 0x43, 0x39, 0xc5, 0x1f, 0x08, 0x15, 0x96, 0x34, 0xd3, 0x80, 0x8a, 0xa8,
+	0xd3, 0x6b, 0xe7, 0xda, 0xaa, 0x10, 0x8b, 0xce, 0x89, 0xc7, 0xb2, 0x04, 0x5b, 0x65, 0x01, 0x55,
+	0x41, 0x1a, 0xe3, 0xa9, 0xb5, 0x26, 0x0e, 0x35, 0x58, 0xc3, 0x57, 0x71, 0x94, 0x4c, 0x2d, 0xc5,
+	0x46, 0xae, 0xc4, 0x2b, 0x84, 0x34, 0x7e, 0x17, 0x4d, 0x22, 0x66, 0x55, 0x6c, 0xe4, 0xea, 0x66,
+	0x1d, 0xca, 0x41, 0x98, 0x91, 0xb1, 0x05, 0xa2, 0xeb, 0xcd, 0xbb, 0xa3, 0x69, 0xf1, 0xb0, 0xd3,
+	0x05, 0x6d, 0xf1, 0xcc, 0x8d, 0x26, 0x94, 0xb2, 0xc2, 0xb6, 0x0e, 0xe5, 0x88, 0x0c, 0xf1, 0x95,
+	0xf0, 0xad, 0xf3, 0x63, 0x40, 0x33, 0xc2, 0x84, 0x6f, 0x9d, 0xb3, 0x69, 0xf4, 0x09, 0x5b, 0xb2,
+	0x8d, 0x5c, 0xd9, 0xb9, 0x46, 0x50, 0x5b, 0x19, 0x68, 0x1d, 0xca, 0x51, 0xe8, 0x5d, 0xe2, 0xe2,
+	0x22, 0x37, 0xef, 0x8e, 0xbe, 0xd7, 0xf5, 0x2e, 0x73, 0xee, 0xa3, 0x47, 0x98, 0x55, 0x7a, 0x90,
+	0x3b, 0xf3, 0x08, 0xe3, 0xdc, 0x79, 0xe2, 0x8d, 0xb8, 0xfe, 0x03, 0xdc, 0x1b, 0x1e, 0xe6, 0x5c,
+	0x9c, 0x64, 0x04, 0x5b, 0xf2, 0x43, 0x5c, 0x9f, 0x87, 0xcd, 0x06, 0xa8, 0xd1, 0x90, 0x12, 0x26,
+	0xb4, 0xcb, 0x82, 0x7d, 0x74, 0x8f, 0x76, 0x9b, 0x12, 0xc6, 0xf5, 0x9d, 0x17, 0xa0, 0x2d, 0xf9,
+	0x9e, 0x3d, 0x80, 0x5e, 0x5b, 0xcc, 0x4b, 0x35, 0x4d, 0x80, 0x49, 0xde, 0x3b, 0xbf, 0x4b, 0xde,
+	0x8d, 0xea, 0x38, 0xb7, 0x49, 0xa2, 0x89, 0x65, 0x06, 0x09, 0xe6, 0x31, 0x68, 0x4b, 0x0d, 0xac,
+	0x16, 0x76, 0xea, 0x60, 0xac, 0xba, 0xb9, 0xb7, 0xd0, 0x29, 0x68, 0x4b, 0x1d, 0xde, 0x71, 0xe8,
+	0x40, 0x39, 0xc6, 0x38, 0x49, 0x8b, 0x51, 0xff, 0xbb, 0xd0, 0x6e, 0x1f, 0xe3, 0xa4, 0x47, 0x46,
+	0x94, 0x27, 0xf9, 0x5e, 0x30, 0xa6, 0xa3, 0x91, 0xb8, 0x68, 0xd9, 0x79, 0x09, 0x95, 0x79, 0xb0,
+	0x06, 0x6b, 0xbc, 0x40, 0x51, 0x50, 0x33, 0x2d, 0x30, 0xf8, 0x53, 0xc5, 0x43, 0x4e, 0x0c, 0x70,
+	0x40, 0x93, 0x7c, 0x1b, 0x34, 0xe7, 0xab, 0x04, 0xeb, 0xa7, 0x5c, 0xbc, 0x8d, 0xf3, 0x9d, 0xa6,
+	0x09, 0x7f, 0x32, 0xc4, 0x9b, 0xe0, 0xc2, 0xcc, 0x73, 0x90, 0xbd, 0x8c, 0x85, 0x82, 0xaf, 0x36,
+	0x77, 0x16, 0xbc, 0xac, 0xe4, 0x35, 0xf6, 0x33, 0x16, 0x8a, 0x35, 0x7c, 0x06, 0x12, 0x26, 0x41,
+	0xb1, 0xcb, 0xce, 0x6f, 0x32, 0x3a, 0x24, 0xe0, 0x09, 0x5b, 0x9f, 0xa1, 0x32, 0x4f, 0x7e, 0x0d,
+	0xf2, 0x84, 0x0e, 0x73, 0xf5, 0x5a, 0xf3, 0xe9, 0x5f, 0xe8, 0x89, 0x9f, 0x43, 0x3a, 0x14, 0xfb,
+	0x3c, 0xc6, 0xd3, 0x7c, 0x6e, 0x9a, 0x53, 0x87, 0xca, 0x3c, 0x52, 0x01, 0xf9, 0xe8, 0xf8, 0xa8,
+	0x63, 0xfc, 0x63, 0x2a, 0x20, 0xbd, 0xed, 0xbc, 0x37, 0x10, 0xff, 0x39, 0x3b, 0x3e, 0x35, 0x4a,
+	0x5b, 0x5f, 0x10, 0x28, 0x85, 0x13, 0xf3, 0xd5, 0x92, 0xfa, 0xee, 0x9f, 0xbd, 0xf3, 0xaf, 0x50,
+	0xd8, 0x00, 0x75, 0x8c, 0xa7, 0x5d, 0x2f, 0x0d, 0xf1, 0xcc, 0xc0, 0x13, 0x50, 0x66, 0xd1, 0x5b,
+	0x7d, 0x1d, 0xd4, 0x93, 0xee, 0xfe, 0xa0, 0xd3, 0x5e, 0x76, 0x71, 0xa0, 0xfd, 0xb8, 0xd9, 0x46,
+	0x3f, 0x6f, 0xb6, 0xd1, 0xf5, 0xcd, 0x36, 0xfa, 0x35, 0x00, 0xaa, 0x11, 0x9e, 0x3a, 0x85, 0x05,
+	0x00, 0x00,
 }
 
 func (m *RPC) Marshal() (dAtA []byte, err error) {
@@ -928,6 +1100,23 @@ func (m *RPC) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i += n1
 	}
+	if len(m.Hops) > 0 {
+		dAtA3 := make([]byte, len(m.Hops)*10)
+		var j2 int
+		for _, num := range m.Hops {
+			for num >= 1<<7 {
+				dAtA3[j2] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j2++
+			}
+			dAtA3[j2] = uint8(num)
+			j2++
+		}
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(j2))
+		i += copy(dAtA[i:], dAtA3[:j2])
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -1031,6 +1220,68 @@ func (m *Message) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintRpc(dAtA, i, uint64(len(m.Key)))
 		i += copy(dAtA[i:], m.Key)
 	}
+	if m.Expiry != nil {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Expiry))
+	}
+	if m.HopLimit != nil {
+		dAtA[i] = 0x40
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.HopLimit))
+	}
+	if m.Chunk != nil {
+		dAtA[i] = 0x52
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(m.Chunk.Size()))
+		n4, err4 := m.Chunk.MarshalTo(dAtA[i:])
+		if err4 != nil {
+			return 0, err4
+		}
+		i += n4
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *MessageChunk) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MessageChunk) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Root != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Root)))
+		i += copy(dAtA[i:], m.Root)
+	}
+	if m.Index != nil {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Index))
+	}
+	if m.Count != nil {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Count))
+	}
+	if m.Size_ != nil {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Size_))
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -1100,6 +1351,18 @@ func (m *ControlMessage) MarshalTo(dAtA []byte) (int, error) {
 			i += n
 		}
 	}
+	if len(m.Idontwant) > 0 {
+		for _, msg := range m.Idontwant {
+			dAtA[i] = 0x2a
+			i++
+			i = encodeVarintRpc(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -1211,6 +1474,42 @@ func (m *ControlGraft) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *ControlIDontWant) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ControlIDontWant) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.MessageIDs) > 0 {
+		for _, s := range m.MessageIDs {
+			dAtA[i] = 0xa
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				dAtA[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			dAtA[i] = uint8(l)
+			i++
+			i += copy(dAtA[i:], s)
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
 func (m *ControlPrune) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1244,6 +1543,11 @@ func (m *ControlPrune) MarshalTo(dAtA []byte) (int, error) {
 			i += n
 		}
 	}
+	if m.Backoff != nil {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Backoff))
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -1308,21 +1612,21 @@ func (m *TopicDescriptor) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x12
 		i++
 		i = encodeVarintRpc(dAtA, i, uint64(m.Auth.Size()))
-		n2, err2 := m.Auth.MarshalTo(dAtA[i:])
-		if err2 != nil {
-			return 0, err2
+		n5, err5 := m.Auth.MarshalTo(dAtA[i:])
+		if err5 != nil {
+			return 0, err5
 		}
-		i += n2
+		i += n5
 	}
 	if m.Enc != nil {
 		dAtA[i] = 0x1a
 		i++
 		i = encodeVarintRpc(dAtA, i, uint64(m.Enc.Size()))
-		n3, err3 := m.Enc.MarshalTo(dAtA[i:])
-		if err3 != nil {
-			return 0, err3
+		n6, err6 := m.Enc.MarshalTo(dAtA[i:])
+		if err6 != nil {
+			return 0, err6
 		}
-		i += n3
+		i += n6
 	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
@@ -1429,6 +1733,13 @@ func (m *RPC) Size() (n int) {
 		l = m.Control.Size()
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if len(m.Hops) > 0 {
+		l = 0
+		for _, e := range m.Hops {
+			l += sovRpc(uint64(e))
+		}
+		n += 1 + sovRpc(uint64(l)) + l
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -1486,6 +1797,41 @@ func (m *Message) Size() (n int) {
 		l = len(m.Key)
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if m.Expiry != nil {
+		n += 1 + sovRpc(uint64(*m.Expiry))
+	}
+	if m.HopLimit != nil {
+		n += 1 + sovRpc(uint64(*m.HopLimit))
+	}
+	if m.Chunk != nil {
+		l = m.Chunk.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *MessageChunk) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Root != nil {
+		l = len(m.Root)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.Index != nil {
+		n += 1 + sovRpc(uint64(*m.Index))
+	}
+	if m.Count != nil {
+		n += 1 + sovRpc(uint64(*m.Count))
+	}
+	if m.Size_ != nil {
+		n += 1 + sovRpc(uint64(*m.Size_))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -1522,6 +1868,12 @@ func (m *ControlMessage) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if len(m.Idontwant) > 0 {
+		for _, e := range m.Idontwant {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -1584,6 +1936,24 @@ func (m *ControlGraft) Size() (n int) {
 	return n
 }
 
+func (m *ControlIDontWant) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.MessageIDs) > 0 {
+		for _, s := range m.MessageIDs {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func (m *ControlPrune) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1600,6 +1970,9 @@ func (m *ControlPrune) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.Backoff != nil {
+		n += 1 + sovRpc(uint64(*m.Backoff))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -1838,22 +2211,98 @@ func (m *RPC) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipRpc(dAtA[iNdEx:])
-			if err != nil {
-				return err
-			}
-			if skippy < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if (iNdEx + skippy) < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if (iNdEx + skippy) > l {
-				return io.ErrUnexpectedEOF
-			}
-			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+		case 4:
+			if wireType == 0 {
+				var v uint32
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowRpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= uint32(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Hops = append(m.Hops, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowRpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthRpc
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthRpc
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.Hops) == 0 {
+					m.Hops = make([]uint32, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v uint32
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowRpc
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= uint32(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Hops = append(m.Hops, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hops", wireType)
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
 			iNdEx += skippy
 		}
 	}
@@ -2202,6 +2651,230 @@ func (m *Message) Unmarshal(dAtA []byte) error {
 				m.Key = []byte{}
 			}
 			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Expiry", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Expiry = &v
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HopLimit", wireType)
+			}
+			var v uint32
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.HopLimit = &v
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Chunk", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Chunk == nil {
+				m.Chunk = &MessageChunk{}
+			}
+			if err := m.Chunk.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *MessageChunk) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MessageChunk: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MessageChunk: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Root", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Root = append(m.Root[:0], dAtA[iNdEx:postIndex]...)
+			if m.Root == nil {
+				m.Root = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Index", wireType)
+			}
+			var v uint32
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Index = &v
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Count", wireType)
+			}
+			var v uint32
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Count = &v
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Size_", wireType)
+			}
+			var v uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Size_ = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2392,6 +3065,40 @@ func (m *ControlMessage) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Idontwant", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Idontwant = append(m.Idontwant, &ControlIDontWant{})
+			if err := m.Idontwant[len(m.Idontwant)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2709,6 +3416,92 @@ func (m *ControlGraft) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ControlIDontWant) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ControlIDontWant: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ControlIDontWant: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MessageIDs", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.MessageIDs = append(m.MessageIDs, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *ControlPrune) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -2805,6 +3598,26 @@ func (m *ControlPrune) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Backoff", wireType)
+			}
+			var v uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Backoff = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
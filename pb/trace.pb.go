@@ -37,6 +37,7 @@ const (
 	TraceEvent_LEAVE             TraceEvent_Type = 10
 	TraceEvent_GRAFT             TraceEvent_Type = 11
 	TraceEvent_PRUNE             TraceEvent_Type = 12
+	TraceEvent_SHAPE_RPC         TraceEvent_Type = 13
 )
 
 var TraceEvent_Type_name = map[int32]string{
@@ -53,6 +54,7 @@ var TraceEvent_Type_name = map[int32]string{
 	10: "LEAVE",
 	11: "GRAFT",
 	12: "PRUNE",
+	13: "SHAPE_RPC",
 }
 
 var TraceEvent_Type_value = map[string]int32{
@@ -69,6 +71,7 @@ var TraceEvent_Type_value = map[string]int32{
 	"LEAVE":             10,
 	"GRAFT":             11,
 	"PRUNE":             12,
+	"SHAPE_RPC":         13,
 }
 
 func (x TraceEvent_Type) Enum() *TraceEvent_Type {
@@ -111,6 +114,7 @@ type TraceEvent struct {
 	Leave                *TraceEvent_Leave            `protobuf:"bytes,14,opt,name=leave" json:"leave,omitempty"`
 	Graft                *TraceEvent_Graft            `protobuf:"bytes,15,opt,name=graft" json:"graft,omitempty"`
 	Prune                *TraceEvent_Prune            `protobuf:"bytes,16,opt,name=prune" json:"prune,omitempty"`
+	ShapeRPC             *TraceEvent_ShapeRPC         `protobuf:"bytes,17,opt,name=shapeRPC" json:"shapeRPC,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
 	XXX_unrecognized     []byte                       `json:"-"`
 	XXX_sizecache        int32                        `json:"-"`
@@ -261,6 +265,13 @@ func (m *TraceEvent) GetPrune() *TraceEvent_Prune {
 	return nil
 }
 
+func (m *TraceEvent) GetShapeRPC() *TraceEvent_ShapeRPC {
+	if m != nil {
+		return m.ShapeRPC
+	}
+	return nil
+}
+
 type TraceEvent_PublishMessage struct {
 	MessageID            []byte   `protobuf:"bytes,1,opt,name=messageID" json:"messageID,omitempty"`
 	Topics               []string `protobuf:"bytes,2,rep,name=topics" json:"topics,omitempty"`
@@ -748,6 +759,69 @@ func (m *TraceEvent_DropRPC) GetMeta() *TraceEvent_RPCMeta {
 	return nil
 }
 
+type TraceEvent_ShapeRPC struct {
+	SendTo               []byte              `protobuf:"bytes,1,opt,name=sendTo" json:"sendTo,omitempty"`
+	Meta                 *TraceEvent_RPCMeta `protobuf:"bytes,2,opt,name=meta" json:"meta,omitempty"`
+	QueueDelay           *int64              `protobuf:"varint,3,opt,name=queueDelay" json:"queueDelay,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *TraceEvent_ShapeRPC) Reset()         { *m = TraceEvent_ShapeRPC{} }
+func (m *TraceEvent_ShapeRPC) String() string { return proto.CompactTextString(m) }
+func (*TraceEvent_ShapeRPC) ProtoMessage()    {}
+func (*TraceEvent_ShapeRPC) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0571941a1d628a80, []int{0, 9}
+}
+func (m *TraceEvent_ShapeRPC) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TraceEvent_ShapeRPC) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TraceEvent_ShapeRPC.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TraceEvent_ShapeRPC) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TraceEvent_ShapeRPC.Merge(m, src)
+}
+func (m *TraceEvent_ShapeRPC) XXX_Size() int {
+	return m.Size()
+}
+func (m *TraceEvent_ShapeRPC) XXX_DiscardUnknown() {
+	xxx_messageInfo_TraceEvent_ShapeRPC.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TraceEvent_ShapeRPC proto.InternalMessageInfo
+
+func (m *TraceEvent_ShapeRPC) GetSendTo() []byte {
+	if m != nil {
+		return m.SendTo
+	}
+	return nil
+}
+
+func (m *TraceEvent_ShapeRPC) GetMeta() *TraceEvent_RPCMeta {
+	if m != nil {
+		return m.Meta
+	}
+	return nil
+}
+
+func (m *TraceEvent_ShapeRPC) GetQueueDelay() int64 {
+	if m != nil && m.QueueDelay != nil {
+		return *m.QueueDelay
+	}
+	return 0
+}
+
 type TraceEvent_Join struct {
 	Topic                *string  `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -759,7 +833,7 @@ func (m *TraceEvent_Join) Reset()         { *m = TraceEvent_Join{} }
 func (m *TraceEvent_Join) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_Join) ProtoMessage()    {}
 func (*TraceEvent_Join) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 9}
+	return fileDescriptor_0571941a1d628a80, []int{0, 10}
 }
 func (m *TraceEvent_Join) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -806,7 +880,7 @@ func (m *TraceEvent_Leave) Reset()         { *m = TraceEvent_Leave{} }
 func (m *TraceEvent_Leave) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_Leave) ProtoMessage()    {}
 func (*TraceEvent_Leave) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 10}
+	return fileDescriptor_0571941a1d628a80, []int{0, 11}
 }
 func (m *TraceEvent_Leave) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -854,7 +928,7 @@ func (m *TraceEvent_Graft) Reset()         { *m = TraceEvent_Graft{} }
 func (m *TraceEvent_Graft) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_Graft) ProtoMessage()    {}
 func (*TraceEvent_Graft) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 11}
+	return fileDescriptor_0571941a1d628a80, []int{0, 12}
 }
 func (m *TraceEvent_Graft) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -909,7 +983,7 @@ func (m *TraceEvent_Prune) Reset()         { *m = TraceEvent_Prune{} }
 func (m *TraceEvent_Prune) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_Prune) ProtoMessage()    {}
 func (*TraceEvent_Prune) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 12}
+	return fileDescriptor_0571941a1d628a80, []int{0, 13}
 }
 func (m *TraceEvent_Prune) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -965,7 +1039,7 @@ func (m *TraceEvent_RPCMeta) Reset()         { *m = TraceEvent_RPCMeta{} }
 func (m *TraceEvent_RPCMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_RPCMeta) ProtoMessage()    {}
 func (*TraceEvent_RPCMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 13}
+	return fileDescriptor_0571941a1d628a80, []int{0, 14}
 }
 func (m *TraceEvent_RPCMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1027,7 +1101,7 @@ func (m *TraceEvent_MessageMeta) Reset()         { *m = TraceEvent_MessageMeta{}
 func (m *TraceEvent_MessageMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_MessageMeta) ProtoMessage()    {}
 func (*TraceEvent_MessageMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 14}
+	return fileDescriptor_0571941a1d628a80, []int{0, 15}
 }
 func (m *TraceEvent_MessageMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1082,7 +1156,7 @@ func (m *TraceEvent_SubMeta) Reset()         { *m = TraceEvent_SubMeta{} }
 func (m *TraceEvent_SubMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_SubMeta) ProtoMessage()    {}
 func (*TraceEvent_SubMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 15}
+	return fileDescriptor_0571941a1d628a80, []int{0, 16}
 }
 func (m *TraceEvent_SubMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1139,7 +1213,7 @@ func (m *TraceEvent_ControlMeta) Reset()         { *m = TraceEvent_ControlMeta{}
 func (m *TraceEvent_ControlMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 16}
+	return fileDescriptor_0571941a1d628a80, []int{0, 17}
 }
 func (m *TraceEvent_ControlMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1208,7 +1282,7 @@ func (m *TraceEvent_ControlIHaveMeta) Reset()         { *m = TraceEvent_ControlI
 func (m *TraceEvent_ControlIHaveMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlIHaveMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlIHaveMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 17}
+	return fileDescriptor_0571941a1d628a80, []int{0, 18}
 }
 func (m *TraceEvent_ControlIHaveMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1262,7 +1336,7 @@ func (m *TraceEvent_ControlIWantMeta) Reset()         { *m = TraceEvent_ControlI
 func (m *TraceEvent_ControlIWantMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlIWantMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlIWantMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 18}
+	return fileDescriptor_0571941a1d628a80, []int{0, 19}
 }
 func (m *TraceEvent_ControlIWantMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1309,7 +1383,7 @@ func (m *TraceEvent_ControlGraftMeta) Reset()         { *m = TraceEvent_ControlG
 func (m *TraceEvent_ControlGraftMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlGraftMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlGraftMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 19}
+	return fileDescriptor_0571941a1d628a80, []int{0, 20}
 }
 func (m *TraceEvent_ControlGraftMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1357,7 +1431,7 @@ func (m *TraceEvent_ControlPruneMeta) Reset()         { *m = TraceEvent_ControlP
 func (m *TraceEvent_ControlPruneMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlPruneMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlPruneMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 20}
+	return fileDescriptor_0571941a1d628a80, []int{0, 21}
 }
 func (m *TraceEvent_ControlPruneMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1459,6 +1533,7 @@ func init() {
 	proto.RegisterType((*TraceEvent_RecvRPC)(nil), "pubsub.pb.TraceEvent.RecvRPC")
 	proto.RegisterType((*TraceEvent_SendRPC)(nil), "pubsub.pb.TraceEvent.SendRPC")
 	proto.RegisterType((*TraceEvent_DropRPC)(nil), "pubsub.pb.TraceEvent.DropRPC")
+	proto.RegisterType((*TraceEvent_ShapeRPC)(nil), "pubsub.pb.TraceEvent.ShapeRPC")
 	proto.RegisterType((*TraceEvent_Join)(nil), "pubsub.pb.TraceEvent.Join")
 	proto.RegisterType((*TraceEvent_Leave)(nil), "pubsub.pb.TraceEvent.Leave")
 	proto.RegisterType((*TraceEvent_Graft)(nil), "pubsub.pb.TraceEvent.Graft")
@@ -1477,70 +1552,66 @@ func init() {
 func init() { proto.RegisterFile("trace.proto", fileDescriptor_0571941a1d628a80) }
 
 var fileDescriptor_0571941a1d628a80 = []byte{
-	// 993 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x96, 0xdb, 0x6e, 0xdb, 0x46,
-	0x10, 0x86, 0x4b, 0x1d, 0x2c, 0x69, 0x24, 0xcb, 0xec, 0xb6, 0x2e, 0x08, 0x36, 0x31, 0x54, 0x37,
-	0x08, 0x04, 0x14, 0x10, 0x10, 0x03, 0x45, 0x2e, 0x9a, 0x04, 0x95, 0x45, 0xda, 0x96, 0x21, 0xdb,
-	0xc4, 0x48, 0x76, 0x2f, 0x5d, 0x4a, 0xda, 0xc6, 0x0c, 0x24, 0x92, 0x20, 0x57, 0x2a, 0xf2, 0x00,
-	0x7d, 0xb7, 0xdc, 0xb5, 0x8f, 0x50, 0xf8, 0x41, 0x8a, 0x62, 0x77, 0x49, 0xea, 0x60, 0x92, 0x49,
-	0xdd, 0xdc, 0x71, 0x96, 0xff, 0x37, 0x3b, 0xbb, 0x9c, 0x7f, 0x40, 0xa8, 0xb3, 0xc0, 0x9e, 0xd0,
-	0x8e, 0x1f, 0x78, 0xcc, 0x23, 0x35, 0x7f, 0x31, 0x0e, 0x17, 0xe3, 0x8e, 0x3f, 0x3e, 0xfc, 0x67,
-	0x1f, 0x60, 0xc4, 0x5f, 0x99, 0x4b, 0xea, 0x32, 0xd2, 0x81, 0x12, 0x7b, 0xef, 0x53, 0x4d, 0x69,
-	0x29, 0xed, 0xe6, 0x91, 0xde, 0x49, 0x84, 0x9d, 0x95, 0xa8, 0x33, 0x7a, 0xef, 0x53, 0x14, 0x3a,
-	0xf2, 0x0d, 0xec, 0xf8, 0x94, 0x06, 0x7d, 0x43, 0x2b, 0xb4, 0x94, 0x76, 0x03, 0xa3, 0x88, 0x3c,
-	0x81, 0x1a, 0x73, 0xe6, 0x34, 0x64, 0xf6, 0xdc, 0xd7, 0x8a, 0x2d, 0xa5, 0x5d, 0xc4, 0xd5, 0x02,
-	0x19, 0x40, 0xd3, 0x5f, 0x8c, 0x67, 0x4e, 0x78, 0x77, 0x41, 0xc3, 0xd0, 0x7e, 0x4b, 0xb5, 0x52,
-	0x4b, 0x69, 0xd7, 0x8f, 0x9e, 0xa5, 0xef, 0x67, 0x6d, 0x68, 0x71, 0x8b, 0x25, 0x7d, 0xd8, 0x0d,
-	0xe8, 0x3b, 0x3a, 0x61, 0x71, 0xb2, 0xb2, 0x48, 0xf6, 0x7d, 0x7a, 0x32, 0x5c, 0x97, 0xe2, 0x26,
-	0x49, 0x10, 0xd4, 0xe9, 0xc2, 0x9f, 0x39, 0x13, 0x9b, 0xd1, 0x38, 0xdb, 0x8e, 0xc8, 0xf6, 0x3c,
-	0x3d, 0x9b, 0xb1, 0xa5, 0xc6, 0x07, 0x3c, 0x3f, 0xec, 0x94, 0xce, 0x9c, 0x25, 0x0d, 0xe2, 0x8c,
-	0x95, 0xbc, 0xc3, 0x1a, 0x1b, 0x5a, 0xdc, 0x62, 0xc9, 0x4b, 0xa8, 0xd8, 0xd3, 0xa9, 0x45, 0x69,
-	0xa0, 0x55, 0x45, 0x9a, 0xa7, 0xe9, 0x69, 0xba, 0x52, 0x84, 0xb1, 0x9a, 0xfc, 0x0c, 0x10, 0xd0,
-	0xb9, 0xb7, 0xa4, 0x82, 0xad, 0x09, 0xb6, 0x95, 0x75, 0x45, 0xb1, 0x0e, 0xd7, 0x18, 0xbe, 0x75,
-	0x40, 0x27, 0x4b, 0xb4, 0x7a, 0x1a, 0xe4, 0x6d, 0x8d, 0x52, 0x84, 0xb1, 0x9a, 0x83, 0x21, 0x75,
-	0xa7, 0x1c, 0xac, 0xe7, 0x81, 0x43, 0x29, 0xc2, 0x58, 0xcd, 0xc1, 0x69, 0xe0, 0xf9, 0x1c, 0x6c,
-	0xe4, 0x81, 0x86, 0x14, 0x61, 0xac, 0xe6, 0x6d, 0xfc, 0xce, 0x73, 0x5c, 0x6d, 0x57, 0x50, 0x19,
-	0x6d, 0x7c, 0xee, 0x39, 0x2e, 0x0a, 0x1d, 0x79, 0x01, 0xe5, 0x19, 0xb5, 0x97, 0x54, 0x6b, 0x0a,
-	0xe0, 0xdb, 0x74, 0x60, 0xc0, 0x25, 0x28, 0x95, 0x1c, 0x79, 0x1b, 0xd8, 0xbf, 0x31, 0x6d, 0x2f,
-	0x0f, 0x39, 0xe5, 0x12, 0x94, 0x4a, 0x8e, 0xf8, 0xc1, 0xc2, 0xa5, 0x9a, 0x9a, 0x87, 0x58, 0x5c,
-	0x82, 0x52, 0xa9, 0x9f, 0x40, 0x73, 0xb3, 0xfb, 0xb9, 0xb3, 0xe6, 0xf2, 0xb1, 0x6f, 0x08, 0x9b,
-	0x36, 0x70, 0xb5, 0xc0, 0xfd, 0xc8, 0x3c, 0xdf, 0x99, 0x84, 0x5a, 0xa1, 0x55, 0x6c, 0xd7, 0x30,
-	0x8a, 0x74, 0x07, 0x76, 0x37, 0x1a, 0xff, 0x23, 0x69, 0x0e, 0xa1, 0x11, 0xd0, 0x09, 0x75, 0x96,
-	0x74, 0x7a, 0x12, 0x78, 0xf3, 0xc8, 0xdc, 0x1b, 0x6b, 0x7c, 0xab, 0x80, 0xda, 0xa1, 0xe7, 0x0a,
-	0x7f, 0xd7, 0x30, 0x8a, 0xf4, 0x11, 0xa8, 0xdb, 0xae, 0xf8, 0xff, 0xbb, 0xe9, 0x1d, 0x68, 0x6e,
-	0x3a, 0x23, 0x3f, 0xa7, 0xfe, 0x12, 0x2a, 0x91, 0x05, 0xd6, 0x66, 0x94, 0xb2, 0x31, 0xa3, 0xbe,
-	0xe6, 0x9f, 0xc3, 0x63, 0x9e, 0xd8, 0xaf, 0x86, 0x32, 0xd0, 0x9f, 0x01, 0xac, 0xfa, 0x3f, 0x8b,
-	0xd5, 0x7f, 0x85, 0x4a, 0xd4, 0xe6, 0x0f, 0xaa, 0x57, 0x52, 0xee, 0xea, 0x05, 0x94, 0xe6, 0x94,
-	0xd9, 0x62, 0xa7, 0x6c, 0xdf, 0x58, 0xbd, 0x0b, 0xca, 0x6c, 0x14, 0x52, 0x7d, 0x04, 0x95, 0xc8,
-	0x0f, 0xbc, 0x08, 0xee, 0x88, 0x91, 0x17, 0x17, 0x21, 0xa3, 0x47, 0x66, 0x8d, 0xcc, 0xf2, 0x39,
-	0xb3, 0x3e, 0x81, 0x12, 0x37, 0x13, 0xbf, 0x51, 0xd1, 0x6f, 0x22, 0x63, 0x0d, 0x65, 0xa0, 0x3f,
-	0x85, 0xb2, 0x70, 0xce, 0xea, 0x75, 0x61, 0xfd, 0xf5, 0x8f, 0x50, 0x16, 0x2e, 0xc9, 0xfb, 0x4e,
-	0xe9, 0x98, 0x70, 0xca, 0x7f, 0xc4, 0x3e, 0x28, 0x50, 0x89, 0x8a, 0x27, 0xaf, 0xa1, 0x1a, 0x35,
-	0x4c, 0xa8, 0x29, 0xad, 0x62, 0xbb, 0x7e, 0xf4, 0x5d, 0xfa, 0x69, 0xa3, 0x96, 0x13, 0x27, 0x4e,
-	0x10, 0xd2, 0x85, 0x46, 0xb8, 0x18, 0x87, 0x93, 0xc0, 0xf1, 0x99, 0xe3, 0xb9, 0xc2, 0x71, 0xd9,
-	0xb3, 0x6d, 0x31, 0x16, 0xf8, 0x06, 0x42, 0x7e, 0x82, 0xca, 0xc4, 0x73, 0x59, 0xe0, 0xcd, 0x84,
-	0x89, 0x32, 0x0b, 0xe8, 0x49, 0x91, 0xc8, 0x10, 0x13, 0x7a, 0x0f, 0xea, 0x6b, 0x85, 0x3d, 0x72,
-	0x30, 0xbc, 0x86, 0x4a, 0x54, 0x1a, 0x4f, 0x10, 0x15, 0x37, 0x96, 0x3f, 0x00, 0x55, 0x5c, 0x2d,
-	0x64, 0x5c, 0xe7, 0x1f, 0x05, 0xa8, 0xaf, 0x15, 0x47, 0x5e, 0x41, 0xd9, 0xb9, 0xe3, 0x83, 0x54,
-	0xde, 0xe7, 0xf3, 0xdc, 0xe3, 0xf4, 0xcf, 0xec, 0xa5, 0xbc, 0x54, 0x09, 0x09, 0xfa, 0x77, 0xdb,
-	0x65, 0xd1, 0x55, 0x7e, 0x84, 0xfe, 0xc5, 0x76, 0x59, 0x44, 0x73, 0x88, 0xd3, 0x72, 0x22, 0x17,
-	0x3f, 0x81, 0x16, 0x2d, 0x27, 0x69, 0x39, 0x9c, 0x5f, 0xc5, 0xc3, 0xb9, 0xf4, 0x09, 0xb4, 0xe8,
-	0x3c, 0x49, 0xcb, 0x39, 0x7d, 0x06, 0xea, 0xf6, 0xa1, 0xd2, 0xdd, 0x40, 0x0e, 0x00, 0x92, 0xaf,
-	0x22, 0x3f, 0x46, 0x03, 0xd7, 0x56, 0xf4, 0xa3, 0x55, 0xa6, 0xf8, 0x80, 0x5b, 0x8c, 0xf2, 0x80,
-	0x69, 0x27, 0x4c, 0x72, 0xac, 0x0c, 0x2f, 0xbe, 0x49, 0x94, 0xc9, 0x11, 0x32, 0xea, 0xe4, 0xd3,
-	0x91, 0xd2, 0x20, 0x2e, 0x51, 0x06, 0x87, 0x7f, 0x2a, 0x50, 0xe2, 0xbf, 0x7f, 0xe4, 0x2b, 0xd8,
-	0xb3, 0xae, 0x8f, 0x07, 0xfd, 0xe1, 0xd9, 0xed, 0x85, 0x39, 0x1c, 0x76, 0x4f, 0x4d, 0xf5, 0x0b,
-	0x42, 0xa0, 0x89, 0xe6, 0xb9, 0xd9, 0x1b, 0x25, 0x6b, 0x0a, 0xd9, 0x87, 0x2f, 0x8d, 0x6b, 0x6b,
-	0xd0, 0xef, 0x75, 0x47, 0x66, 0xb2, 0x5c, 0xe0, 0xbc, 0x61, 0x0e, 0xfa, 0x37, 0x26, 0x26, 0x8b,
-	0x45, 0xd2, 0x80, 0x6a, 0xd7, 0x30, 0x6e, 0x2d, 0xd3, 0x44, 0xb5, 0x44, 0xf6, 0xa0, 0x8e, 0xe6,
-	0xc5, 0xd5, 0x8d, 0x29, 0x17, 0xca, 0xfc, 0x35, 0x9a, 0xbd, 0x9b, 0x5b, 0xb4, 0x7a, 0xea, 0x0e,
-	0x8f, 0x86, 0xe6, 0xa5, 0x21, 0xa2, 0x0a, 0x8f, 0x0c, 0xbc, 0xb2, 0x44, 0x54, 0x25, 0x55, 0x28,
-	0x9d, 0x5f, 0xf5, 0x2f, 0xd5, 0x1a, 0xa9, 0x41, 0x79, 0x60, 0x76, 0x6f, 0x4c, 0x15, 0xf8, 0xe3,
-	0x29, 0x76, 0x4f, 0x46, 0x6a, 0x9d, 0x3f, 0x5a, 0x78, 0x7d, 0x69, 0xaa, 0x8d, 0xc3, 0x37, 0xb0,
-	0xb7, 0xfa, 0xbe, 0xc7, 0x36, 0x9b, 0xdc, 0x91, 0x1f, 0xa0, 0x3c, 0xe6, 0x0f, 0x51, 0x13, 0xef,
-	0xa7, 0xb6, 0x02, 0x4a, 0xcd, 0x71, 0xe3, 0xc3, 0xfd, 0x81, 0xf2, 0xd7, 0xfd, 0x81, 0xf2, 0xf7,
-	0xfd, 0x81, 0xf2, 0x6f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x05, 0x62, 0xa3, 0xb7, 0x67, 0x0b, 0x00,
-	0x00,
+	// 944 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x96, 0xdd, 0x6e, 0xe3, 0x44,
+	0x14, 0xc7, 0x71, 0xf3, 0xe9, 0x93, 0x8f, 0x3a, 0xb3, 0x14, 0x59, 0x06, 0xaa, 0x6c, 0x77, 0x55,
+	0x45, 0xac, 0x14, 0x55, 0x5d, 0x56, 0x48, 0xc0, 0x05, 0x69, 0x3c, 0x6d, 0x53, 0xa5, 0xad, 0xe5,
+	0xa4, 0xe5, 0x82, 0x8b, 0xca, 0x49, 0x0e, 0x5b, 0xaf, 0x12, 0xdb, 0xd8, 0x93, 0xa0, 0xbe, 0x08,
+	0xaf, 0xc0, 0xab, 0x70, 0xc9, 0x13, 0x20, 0xd4, 0x3b, 0xde, 0x02, 0xcd, 0x4c, 0x9c, 0x36, 0x8e,
+	0x13, 0x22, 0xf6, 0x6e, 0x66, 0xf2, 0xfb, 0x9f, 0x73, 0x7c, 0xe6, 0x7f, 0xa6, 0x85, 0x12, 0x0b,
+	0x9d, 0x21, 0x36, 0x83, 0xd0, 0x67, 0x3e, 0x51, 0x83, 0xe9, 0x20, 0x9a, 0x0e, 0x9a, 0xc1, 0xe0,
+	0xe0, 0xb7, 0x17, 0x00, 0x7d, 0xfe, 0x13, 0x9d, 0xa1, 0xc7, 0x48, 0x03, 0xb2, 0xec, 0x21, 0x40,
+	0x5d, 0xa9, 0x2b, 0x8d, 0xea, 0xb1, 0xd1, 0x5c, 0x80, 0xcd, 0x27, 0xa8, 0xd9, 0x7f, 0x08, 0x90,
+	0x54, 0x21, 0x1f, 0x20, 0x86, 0x1d, 0x53, 0xdf, 0xa9, 0x2b, 0x8d, 0x32, 0xa9, 0x81, 0xca, 0xdc,
+	0x09, 0x46, 0xcc, 0x99, 0x04, 0x7a, 0xa6, 0xae, 0x34, 0x32, 0xe4, 0x7b, 0xa8, 0x06, 0xd3, 0xc1,
+	0xd8, 0x8d, 0xee, 0x2f, 0x31, 0x8a, 0x9c, 0xf7, 0xa8, 0x67, 0xeb, 0x4a, 0xa3, 0x74, 0xfc, 0x3a,
+	0x3d, 0xac, 0xb5, 0xc4, 0x92, 0x6f, 0xa1, 0x12, 0xe2, 0x07, 0x1c, 0xb2, 0x58, 0x9c, 0x13, 0xe2,
+	0x57, 0xe9, 0x62, 0xfb, 0x39, 0x4a, 0x7e, 0x00, 0x6d, 0x34, 0x0d, 0xc6, 0xee, 0xd0, 0x61, 0x18,
+	0xcb, 0xf3, 0x42, 0x7e, 0x98, 0x2e, 0x37, 0x13, 0x34, 0xaf, 0x7d, 0x84, 0x63, 0x77, 0x86, 0x61,
+	0xac, 0x2f, 0x6c, 0xaa, 0xdd, 0x5c, 0x62, 0x49, 0x13, 0x0a, 0xce, 0x68, 0x64, 0x21, 0x86, 0x7a,
+	0x51, 0xc8, 0xbe, 0x4c, 0x97, 0xb5, 0x24, 0x44, 0xbe, 0x06, 0x08, 0x71, 0xe2, 0xcf, 0x50, 0x48,
+	0x54, 0x21, 0xa9, 0xaf, 0xfb, 0xd0, 0x98, 0xe3, 0x59, 0x42, 0x1c, 0xce, 0x6c, 0xab, 0xad, 0xc3,
+	0xa6, 0x2c, 0xb6, 0x84, 0x38, 0x1f, 0xa1, 0x37, 0xe2, 0x7c, 0x69, 0x13, 0xdf, 0x93, 0x10, 0xe7,
+	0x47, 0xa1, 0x1f, 0x70, 0xbe, 0xbc, 0x89, 0x37, 0x25, 0xc4, 0xcd, 0xf3, 0xc1, 0x77, 0x3d, 0xbd,
+	0x22, 0xe0, 0x35, 0xe6, 0xb9, 0xf0, 0x5d, 0x8f, 0x7c, 0x05, 0xb9, 0x31, 0x3a, 0x33, 0xd4, 0xab,
+	0x02, 0xfd, 0x3c, 0x1d, 0xed, 0x72, 0x84, 0xb3, 0xef, 0x43, 0xe7, 0x67, 0xa6, 0xef, 0x6e, 0x62,
+	0xcf, 0x38, 0xc2, 0xd9, 0x20, 0x9c, 0x7a, 0xa8, 0x6b, 0x9b, 0x58, 0x8b, 0x23, 0xe4, 0x08, 0x8a,
+	0xd1, 0xbd, 0x13, 0x20, 0xff, 0xbc, 0x9a, 0xc0, 0xf7, 0xd7, 0xb4, 0x63, 0x4e, 0x19, 0x6f, 0xa1,
+	0x9a, 0xf0, 0x68, 0x0d, 0xd4, 0x89, 0x5c, 0x76, 0x4c, 0x31, 0x33, 0x65, 0x3e, 0x17, 0xcc, 0x0f,
+	0xdc, 0x61, 0xa4, 0xef, 0xd4, 0x33, 0x0d, 0xd5, 0x38, 0x87, 0xca, 0xb2, 0x37, 0x53, 0x34, 0x9f,
+	0x42, 0x39, 0xc4, 0x21, 0xba, 0x33, 0x1c, 0x9d, 0x86, 0xfe, 0x64, 0x3e, 0x51, 0x55, 0xc8, 0x87,
+	0xe8, 0x44, 0xbe, 0x27, 0xc6, 0x49, 0x35, 0xbe, 0x03, 0x6d, 0xc5, 0xa6, 0xdb, 0x06, 0x33, 0x5e,
+	0x41, 0x35, 0xe1, 0xd1, 0x55, 0xa9, 0xd1, 0x80, 0x42, 0xec, 0xc8, 0xa7, 0xf1, 0x96, 0x51, 0x2b,
+	0xbc, 0xb3, 0x3e, 0xf3, 0x45, 0x38, 0xd5, 0xf8, 0x02, 0xe0, 0x99, 0x11, 0x13, 0xb0, 0xd1, 0x85,
+	0x42, 0xec, 0xb9, 0x64, 0x35, 0x32, 0xda, 0x1b, 0xc8, 0x4e, 0x90, 0x39, 0xfa, 0xce, 0x26, 0x5b,
+	0xd9, 0x56, 0xfb, 0x12, 0x99, 0x63, 0x9c, 0x42, 0x21, 0x76, 0x64, 0x15, 0xf2, 0xdc, 0xc1, 0x7d,
+	0xff, 0x7f, 0xc6, 0x89, 0x9d, 0xfa, 0x51, 0x71, 0x7e, 0x82, 0x62, 0x6c, 0x89, 0x8f, 0x0a, 0x44,
+	0x08, 0xc0, 0x2f, 0x53, 0x9c, 0xa2, 0x89, 0x63, 0xe7, 0x41, 0xbe, 0x99, 0xc6, 0x1e, 0x64, 0xc5,
+	0x84, 0x54, 0x20, 0x27, 0x6c, 0x24, 0xe2, 0xaa, 0xc6, 0x67, 0x90, 0x93, 0xd3, 0xb0, 0x38, 0x97,
+	0xf7, 0x70, 0x08, 0x39, 0xe9, 0xfc, 0x94, 0xfb, 0x4a, 0x70, 0xd2, 0xf5, 0xff, 0xc1, 0xfd, 0xae,
+	0x40, 0x21, 0x2e, 0xef, 0x2d, 0x14, 0xe7, 0x06, 0x89, 0x74, 0xa5, 0x9e, 0x69, 0x94, 0x8e, 0x5f,
+	0xa6, 0x7f, 0xcf, 0xdc, 0x51, 0x73, 0x51, 0x39, 0x9a, 0x0e, 0xa2, 0x61, 0xe8, 0x06, 0xcc, 0xf5,
+	0x3d, 0x31, 0x04, 0xeb, 0x1f, 0x9a, 0xe9, 0x40, 0x88, 0x8e, 0xa1, 0x30, 0xf4, 0x3d, 0x16, 0xfa,
+	0x63, 0xd1, 0x85, 0xb5, 0x89, 0xda, 0x12, 0x12, 0xb7, 0x70, 0x04, 0xa5, 0xe7, 0x79, 0xb7, 0x98,
+	0xc4, 0x37, 0x50, 0x88, 0x13, 0xd6, 0x40, 0x9d, 0x57, 0x39, 0x90, 0x7f, 0xeb, 0x8a, 0xc9, 0x46,
+	0xfc, 0xa3, 0x40, 0xe9, 0x59, 0x3a, 0xf2, 0x0e, 0x72, 0xee, 0x3d, 0x7f, 0xb1, 0x64, 0x27, 0x0e,
+	0x37, 0x16, 0xd8, 0x39, 0x77, 0x66, 0xb8, 0x90, 0xfd, 0xea, 0x78, 0x4c, 0xdf, 0xd9, 0x46, 0xf6,
+	0xa3, 0xe3, 0xb1, 0x58, 0x26, 0xdf, 0xbc, 0xcc, 0x16, 0x32, 0x61, 0x80, 0x58, 0x26, 0x9f, 0xbf,
+	0xec, 0x16, 0x32, 0xe1, 0x07, 0xd1, 0xca, 0x77, 0xa0, 0xad, 0x14, 0xbe, 0xec, 0x3f, 0x6e, 0xd5,
+	0x45, 0x7b, 0x65, 0x3f, 0xcb, 0xc6, 0x21, 0x68, 0x2b, 0x85, 0x2f, 0x73, 0x8a, 0xe0, 0x5e, 0x82,
+	0xb6, 0x52, 0x69, 0xc2, 0xde, 0x47, 0xa0, 0x25, 0xab, 0x4a, 0x56, 0xc0, 0x1f, 0x20, 0xc4, 0x70,
+	0x9e, 0xfc, 0xe0, 0x2f, 0x05, 0xb2, 0xe2, 0xff, 0x90, 0x17, 0xb0, 0x6b, 0xdd, 0x9c, 0x74, 0x3b,
+	0xbd, 0xf3, 0xbb, 0x4b, 0xda, 0xeb, 0xb5, 0xce, 0xa8, 0xf6, 0x09, 0x21, 0x50, 0xb5, 0xe9, 0x05,
+	0x6d, 0xf7, 0x17, 0x67, 0x0a, 0xd9, 0x83, 0x9a, 0x79, 0x63, 0x75, 0x3b, 0xed, 0x56, 0x9f, 0x2e,
+	0x8e, 0x77, 0xb8, 0xde, 0xa4, 0xdd, 0xce, 0x2d, 0xb5, 0x17, 0x87, 0x19, 0x52, 0x86, 0x62, 0xcb,
+	0x34, 0xef, 0x2c, 0x4a, 0x6d, 0x2d, 0x4b, 0x76, 0xa1, 0x64, 0xd3, 0xcb, 0xeb, 0x5b, 0x2a, 0x0f,
+	0x72, 0xfc, 0x67, 0x9b, 0xb6, 0x6f, 0xef, 0x6c, 0xab, 0xad, 0xe5, 0xf9, 0xae, 0x47, 0xaf, 0x4c,
+	0xb1, 0x2b, 0xf0, 0x9d, 0x69, 0x5f, 0x5b, 0x62, 0x57, 0x24, 0x45, 0xc8, 0x5e, 0x5c, 0x77, 0xae,
+	0x34, 0x95, 0xa8, 0x90, 0xeb, 0xd2, 0xd6, 0x2d, 0xd5, 0x80, 0x2f, 0xcf, 0xec, 0xd6, 0x69, 0x5f,
+	0x2b, 0xf1, 0xa5, 0x65, 0xdf, 0x5c, 0x51, 0x8d, 0x4f, 0xa2, 0xda, 0x3b, 0x6f, 0x59, 0x54, 0x28,
+	0x2b, 0x07, 0xdf, 0xc0, 0xee, 0xd3, 0x9d, 0x9d, 0x38, 0x6c, 0x78, 0x4f, 0x5e, 0x43, 0x6e, 0xc0,
+	0x17, 0x73, 0x0f, 0xee, 0xa5, 0x5e, 0xef, 0x49, 0xf9, 0x8f, 0xc7, 0x7d, 0xe5, 0xcf, 0xc7, 0x7d,
+	0xe5, 0xef, 0xc7, 0x7d, 0xe5, 0xdf, 0x01, 0x00, 0x1a, 0x0d, 0x49, 0xb1, 0xf8, 0x09, 0x00, 0x00,
 }
 
 func (m *TraceEvent) Marshal() (dAtA []byte, err error) {
@@ -1706,6 +1777,18 @@ func (m *TraceEvent) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i += n13
 	}
+	if m.ShapeRPC != nil {
+		dAtA[i] = 0x8a
+		i++
+		dAtA[i] = 0x1
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.ShapeRPC.Size()))
+		n14, err14 := m.ShapeRPC.MarshalTo(dAtA[i:])
+		if err14 != nil {
+			return 0, err14
+		}
+		i += n14
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -1938,11 +2021,11 @@ func (m *TraceEvent_RecvRPC) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x12
 		i++
 		i = encodeVarintTrace(dAtA, i, uint64(m.Meta.Size()))
-		n14, err14 := m.Meta.MarshalTo(dAtA[i:])
-		if err14 != nil {
-			return 0, err14
+		n15, err15 := m.Meta.MarshalTo(dAtA[i:])
+		if err15 != nil {
+			return 0, err15
 		}
-		i += n14
+		i += n15
 	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
@@ -1975,11 +2058,11 @@ func (m *TraceEvent_SendRPC) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x12
 		i++
 		i = encodeVarintTrace(dAtA, i, uint64(m.Meta.Size()))
-		n15, err15 := m.Meta.MarshalTo(dAtA[i:])
-		if err15 != nil {
-			return 0, err15
+		n16, err16 := m.Meta.MarshalTo(dAtA[i:])
+		if err16 != nil {
+			return 0, err16
 		}
-		i += n15
+		i += n16
 	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
@@ -2012,11 +2095,53 @@ func (m *TraceEvent_DropRPC) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x12
 		i++
 		i = encodeVarintTrace(dAtA, i, uint64(m.Meta.Size()))
-		n16, err16 := m.Meta.MarshalTo(dAtA[i:])
-		if err16 != nil {
-			return 0, err16
+		n17, err17 := m.Meta.MarshalTo(dAtA[i:])
+		if err17 != nil {
+			return 0, err17
 		}
-		i += n16
+		i += n17
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *TraceEvent_ShapeRPC) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TraceEvent_ShapeRPC) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.SendTo != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.SendTo)))
+		i += copy(dAtA[i:], m.SendTo)
+	}
+	if m.Meta != nil {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Meta.Size()))
+		n18, err18 := m.Meta.MarshalTo(dAtA[i:])
+		if err18 != nil {
+			return 0, err18
+		}
+		i += n18
+	}
+	if m.QueueDelay != nil {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(*m.QueueDelay))
 	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
@@ -2187,11 +2312,11 @@ func (m *TraceEvent_RPCMeta) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x1a
 		i++
 		i = encodeVarintTrace(dAtA, i, uint64(m.Control.Size()))
-		n17, err17 := m.Control.MarshalTo(dAtA[i:])
-		if err17 != nil {
-			return 0, err17
+		n19, err19 := m.Control.MarshalTo(dAtA[i:])
+		if err19 != nil {
+			return 0, err19
 		}
-		i += n17
+		i += n19
 	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
@@ -2583,6 +2708,10 @@ func (m *TraceEvent) Size() (n int) {
 		l = m.Prune.Size()
 		n += 2 + l + sovTrace(uint64(l))
 	}
+	if m.ShapeRPC != nil {
+		l = m.ShapeRPC.Size()
+		n += 2 + l + sovTrace(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -2767,6 +2896,29 @@ func (m *TraceEvent_DropRPC) Size() (n int) {
 	return n
 }
 
+func (m *TraceEvent_ShapeRPC) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.SendTo != nil {
+		l = len(m.SendTo)
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.Meta != nil {
+		l = m.Meta.Size()
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.QueueDelay != nil {
+		n += 1 + sovTrace(uint64(*m.QueueDelay))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func (m *TraceEvent_Join) Size() (n int) {
 	if m == nil {
 		return 0
@@ -3624,6 +3776,42 @@ func (m *TraceEvent) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 17:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShapeRPC", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.ShapeRPC == nil {
+				m.ShapeRPC = &TraceEvent_ShapeRPC{}
+			}
+			if err := m.ShapeRPC.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTrace(dAtA[iNdEx:])
@@ -4715,6 +4903,150 @@ func (m *TraceEvent_DropRPC) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *TraceEvent_ShapeRPC) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ShapeRPC: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ShapeRPC: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SendTo", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SendTo = append(m.SendTo[:0], dAtA[iNdEx:postIndex]...)
+			if m.SendTo == nil {
+				m.SendTo = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Meta", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Meta == nil {
+				m.Meta = &TraceEvent_RPCMeta{}
+			}
+			if err := m.Meta.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueueDelay", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.QueueDelay = &v
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *TraceEvent_Join) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -0,0 +1,140 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PeerCandidate is a peer eligible for grafting in a topic mesh, as presented to a PeerSelector.
+type PeerCandidate struct {
+	// ID is the peer ID of the candidate.
+	ID peer.ID
+	// Protocol is the gossipsub protocol spoken by the candidate.
+	Protocol protocol.ID
+	// Score is the current score of the candidate; it is 0 when peer scoring is disabled.
+	Score float64
+	// Outbound is true if we have an outbound connection to the candidate.
+	Outbound bool
+	// Addrs are the remote addresses of our open connections to the candidate.
+	Addrs []ma.Multiaddr
+}
+
+// PeerSelector is the strategy used by the gossipsub router to select peers when grafting them
+// in a topic mesh; this happens when joining a topic, when the heartbeat fills up an
+// undersubscribed mesh or the outbound quota, and with opportunistic grafting.
+//
+// The candidates have already passed the router's checks (score, backoff, direct peers, etc.)
+// and are presented in random order; with bandwidth shaping, peers with lower outbound queue
+// delay come first. SelectPeers must return at most count peers from the candidates; it is called
+// from the event loop and must not block.
+type PeerSelector interface {
+	SelectPeers(topic string, candidates []PeerCandidate, count int) []peer.ID
+}
+
+// WithPeerSelector is a gossipsub router option that sets the strategy for selecting the peers
+// to graft in topic meshes. The default is the RandomPeerSelector, which is also used if selector
+// is nil.
+func WithPeerSelector(selector PeerSelector) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		if selector == nil {
+			selector = RandomPeerSelector{}
+		}
+
+		gs.selector = selector
+
+		return nil
+	}
+}
+
+// RandomPeerSelector selects peers at random; this is the default selection strategy.
+type RandomPeerSelector struct{}
+
+var _ PeerSelector = RandomPeerSelector{}
+
+func (RandomPeerSelector) SelectPeers(topic string, candidates []PeerCandidate, count int) []peer.ID {
+	// the candidates are already shuffled by the router
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+
+	peers := make([]peer.ID, 0, len(candidates))
+	for _, c := range candidates {
+		peers = append(peers, c.ID)
+	}
+
+	return peers
+}
+
+// LatencyPeerSelector prefers peers with lower latency, as measured by the peerstore metrics.
+// Latencies are truncated to the configured granularity, so that peers with similar latencies
+// are selected at random; peers without a latency measurement are selected last.
+type LatencyPeerSelector struct {
+	metrics     peerstore.Metrics
+	granularity time.Duration
+}
+
+var _ PeerSelector = (*LatencyPeerSelector)(nil)
+
+// NewLatencyPeerSelector creates a LatencyPeerSelector that uses the latency metrics of the
+// host's peerstore, with a granularity of 10ms.
+func NewLatencyPeerSelector(h host.Host) *LatencyPeerSelector {
+	return &LatencyPeerSelector{
+		metrics:     h.Peerstore(),
+		granularity: 10 * time.Millisecond,
+	}
+}
+
+// SetGranularity sets the granularity of latency comparisons.
+func (ls *LatencyPeerSelector) SetGranularity(granularity time.Duration) {
+	ls.granularity = granularity
+}
+
+func (ls *LatencyPeerSelector) SelectPeers(topic string, candidates []PeerCandidate, count int) []peer.ID {
+	// peers without a latency measurement are marked with a negative latency
+	latency := make(map[peer.ID]time.Duration, len(candidates))
+	for _, c := range candidates {
+		l := ls.metrics.LatencyEWMA(c.ID)
+		if l == 0 {
+			latency[c.ID] = -1
+		} else {
+			latency[c.ID] = l.Truncate(ls.granularity)
+		}
+	}
+
+	peers := make([]peer.ID, 0, len(candidates))
+	for _, c := range candidates {
+		peers = append(peers, c.ID)
+	}
+
+	// stable sort to preserve the random order of peers with the same latency
+	sort.SliceStable(peers, func(i, j int) bool {
+		li, lj := latency[peers[i]], latency[peers[j]]
+		switch {
+		case li < 0:
+			return false
+		case lj < 0:
+			return true
+		default:
+			return li < lj
+		}
+	})
+
+	if len(peers) > count {
+		peers = peers[:count]
+	}
+
+	return peers
+}
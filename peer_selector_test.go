@@ -0,0 +1,244 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	tnet "github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestLatencyPeerSelector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := getNetHosts(t, ctx, 1)[0]
+
+	peerA := tnet.RandPeerIDFatal(t)
+	peerB := tnet.RandPeerIDFatal(t)
+	peerC := tnet.RandPeerIDFatal(t)
+	peerD := tnet.RandPeerIDFatal(t)
+
+	h.Peerstore().RecordLatency(peerA, 50*time.Millisecond)
+	h.Peerstore().RecordLatency(peerB, 5*time.Millisecond)
+	h.Peerstore().RecordLatency(peerD, 20*time.Millisecond)
+
+	candidates := []PeerCandidate{{ID: peerA}, {ID: peerB}, {ID: peerC}, {ID: peerD}}
+
+	ls := NewLatencyPeerSelector(h)
+
+	// peers are selected by latency
+	peers := ls.SelectPeers("test", candidates, 3)
+	expected := []peer.ID{peerB, peerD, peerA}
+	if len(peers) != len(expected) {
+		t.Fatalf("expected %d peers, got %d", len(expected), len(peers))
+	}
+	for i, p := range expected {
+		if peers[i] != p {
+			t.Fatalf("expected peer %s at position %d, got %s", p, i, peers[i])
+		}
+	}
+
+	// peers without a latency measurement come last
+	peers = ls.SelectPeers("test", candidates, 10)
+	if len(peers) != 4 || peers[3] != peerC {
+		t.Fatalf("expected the peer without latency last, got %v", peers)
+	}
+
+	// peers with latencies within the granularity keep their order
+	ls.SetGranularity(100 * time.Millisecond)
+	peers = ls.SelectPeers("test", candidates, 10)
+	expected = []peer.ID{peerA, peerB, peerD, peerC}
+	for i, p := range expected {
+		if peers[i] != p {
+			t.Fatalf("expected peer %s at position %d, got %s", p, i, peers[i])
+		}
+	}
+}
+
+type testPeerSelector struct {
+	sync.Mutex
+	calls      int
+	candidates map[peer.ID]PeerCandidate
+	extra      []peer.ID
+}
+
+func (ts *testPeerSelector) SelectPeers(topic string, candidates []PeerCandidate, count int) []peer.ID {
+	ts.Lock()
+	defer ts.Unlock()
+
+	ts.calls++
+
+	// ignore the count and select junk, the router should sanitize the selection
+	var peers []peer.ID
+	for _, c := range candidates {
+		ts.candidates[c.ID] = c
+		peers = append(peers, c.ID, c.ID)
+	}
+
+	return append(peers, ts.extra...)
+}
+
+func TestGossipsubPeerSelector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 10)
+
+	ts := &testPeerSelector{
+		candidates: make(map[peer.ID]PeerCandidate),
+		extra:      []peer.ID{tnet.RandPeerIDFatal(t)},
+	}
+
+	psubs := []*PubSub{getGossipsub(ctx, hosts[0], WithPeerSelector(ts))}
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+
+	// the first half of the peers dial us, and we dial the second half
+	for _, h := range hosts[1:6] {
+		connect(t, hosts[0], h)
+	}
+	for _, h := range hosts[6:] {
+		connect(t, h, hosts[0])
+	}
+
+	for _, ps := range psubs[1:] {
+		_, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(time.Second)
+
+	_, err := psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ts.Lock()
+	if ts.calls == 0 {
+		t.Fatal("expected the peer selector to be called on join")
+	}
+	if len(ts.candidates) != 9 {
+		t.Fatalf("expected 9 candidates, got %d", len(ts.candidates))
+	}
+	for _, h := range hosts[1:] {
+		c, ok := ts.candidates[h.ID()]
+		if !ok {
+			t.Fatalf("expected peer %s to be a candidate", h.ID())
+		}
+		if c.Protocol != GossipSubID_v12 {
+			t.Fatalf("expected candidate protocol %s, got %s", GossipSubID_v12, c.Protocol)
+		}
+		if len(c.Addrs) == 0 {
+			t.Fatal("expected candidate connection addresses")
+		}
+
+		outbound := false
+		for _, conn := range hosts[0].Network().ConnsToPeer(h.ID()) {
+			if conn.Stat().Direction == network.DirOutbound {
+				outbound = true
+			}
+		}
+		if c.Outbound != outbound {
+			t.Fatalf("expected candidate %s outbound to be %t, got %t", h.ID(), outbound, c.Outbound)
+		}
+	}
+	ts.Unlock()
+
+	// the selection was capped at D and only includes candidates
+	gs := psubs[0].rt.(*GossipSubRouter)
+	res := make(chan []peer.ID, 1)
+	psubs[0].eval <- func() {
+		res <- peerMapToList(gs.mesh["test"])
+	}
+	mesh := <-res
+
+	if len(mesh) > GossipSubDhi {
+		t.Fatalf("expected at most %d mesh peers, got %d", GossipSubDhi, len(mesh))
+	}
+	for _, p := range mesh {
+		if p == ts.extra[0] {
+			t.Fatal("expected the selection to only include candidates")
+		}
+	}
+
+	psubs[0].eval <- func() {
+		res <- gs.selectPeers("test", 3, func(peer.ID) bool { return true })
+	}
+	selected := <-res
+
+	if len(selected) != 3 {
+		t.Fatalf("expected 3 selected peers, got %d", len(selected))
+	}
+	seen := make(map[peer.ID]struct{})
+	for _, p := range selected {
+		if _, ok := seen[p]; ok {
+			t.Fatal("expected no duplicate selected peers")
+		}
+		seen[p] = struct{}{}
+		if p == ts.extra[0] {
+			t.Fatal("expected the selection to only include candidates")
+		}
+	}
+
+	// in the heartbeat, the candidates are built once and reused across selections
+	cached := make(chan int, 1)
+	psubs[0].eval <- func() {
+		gs.candidates = make(map[peer.ID]PeerCandidate)
+		gs.selectPeers("test", 3, func(peer.ID) bool { return true })
+		gs.selectPeers("test", 3, func(peer.ID) bool { return true })
+		cached <- len(gs.candidates)
+		gs.candidates = nil
+	}
+	if n := <-cached; n != 9 {
+		t.Fatalf("expected 9 cached candidates, got %d", n)
+	}
+}
+
+func TestGossipsubRandomPeerSelection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 10)
+	psubs := getGossipsubs(ctx, hosts)
+
+	for _, ps := range psubs {
+		_, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, h := range hosts[1:] {
+		connect(t, hosts[0], h)
+	}
+
+	time.Sleep(time.Second)
+
+	// the default selector only enumerates the filtered peers it needs, without candidates
+	gs := psubs[0].rt.(*GossipSubRouter)
+	res := make(chan []peer.ID, 1)
+	psubs[0].eval <- func() {
+		gs.candidates = make(map[peer.ID]PeerCandidate)
+		res <- gs.selectPeers("test", 3, func(p peer.ID) bool { return p != hosts[1].ID() })
+		if len(gs.candidates) != 0 {
+			t.Error("expected no candidates to be built for the default selector")
+		}
+		gs.candidates = nil
+	}
+	selected := <-res
+
+	if len(selected) != 3 {
+		t.Fatalf("expected 3 selected peers, got %d", len(selected))
+	}
+	for _, p := range selected {
+		if p == hosts[1].ID() {
+			t.Fatal("expected the selection to only include peers passing the filter")
+		}
+	}
+}
@@ -12,7 +12,6 @@ import (
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
-	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/discovery"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -20,18 +19,24 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 
 	logging "github.com/ipfs/go-log"
-	timecache "github.com/whyrusleeping/timecache"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // DefaultMaximumMessageSize is 1mb.
 const DefaultMaxMessageSize = 1 << 20
 
 var (
+	// TimeCacheDuration is the default TTL for entries in the seen messages cache; it can be
+	// set per instance with WithSeenMessagesTTL.
 	TimeCacheDuration = 120 * time.Second
 )
 
 var log = logging.Logger("pubsub")
 
+// ErrPubSubClosed is the error returned by subscriptions that have been cancelled because the
+// PubSub has been closed.
+var ErrPubSubClosed = errors.New("pubsub has been closed")
+
 // PubSub is the implementation of the pubsub system.
 type PubSub struct {
 	// atomic counter for seqnos
@@ -55,9 +60,17 @@ type PubSub struct {
 	// topics.
 	maxMessageSize int
 
-	// size of the outbound message channel that we maintain for each peer
+	// size of the outbound message queue lanes that we maintain for each peer
 	peerOutboundQueueSize int
 
+	// compression for RPC frames, negotiated per peer; nil if compression is disabled
+	compression Compression
+
+	// global outbound bandwidth limit; nil if there is no global limit
+	shaper *tokenBucket
+	// per peer outbound bandwidth limit in bytes per second; 0 if there is no per peer limit
+	peerRate int
+
 	// incoming messages from other peers
 	incoming chan *RPC
 
@@ -116,25 +129,56 @@ type PubSub struct {
 	eval chan func()
 
 	// peer blacklist
-	blacklist     Blacklist
-	blacklistPeer chan peer.ID
+	blacklist       Blacklist
+	blacklistPeer   chan blacklistReq
+	unblacklistPeer chan peer.ID
+	// whether to close the connections to blacklisted peers
+	blacklistDisconnect bool
 
-	peers map[peer.ID]chan *RPC
+	peers map[peer.ID]*rpcQueue
 
 	seenMessagesMx sync.Mutex
-	seenMessages   *timecache.TimeCache
+	seenMessages   SeenMessagesCache
+	// seenMsgTTL and seenMsgStrategy configure the built-in seen messages cache
+	seenMsgTTL      time.Duration
+	seenMsgStrategy SeenMessagesStrategy
 
 	// function used to compute the ID for a message
 	msgID MsgIdFunction
 
-	// key for signing messages; nil when signing is disabled (default for now)
-	signKey crypto.PrivKey
-	// source ID for signed messages; corresponds to signKey
+	// signer for messages; nil when signing is disabled
+	signer Signer
+	// source ID for signed messages; corresponds to the signer key
 	signID peer.ID
 	// strict mode rejects all unsigned messages prior to validation
 	signStrict bool
+	// the signing configuration of the options, which is resolved once all the options have
+	// been applied, so that it doesn't depend on their order
+	customSigner bool
+	customAuthor bool
+	signDisabled bool
+
+	// hop counts of hop-limited messages
+	hops *hopTracker
+
+	// encodings of recent messages, for forwarding them without encoding them for every peer
+	encodings *encodingCache
+
+	// persistent sequence number tracking; nil if there is no seqno store
+	seqnos *seqnoTracker
+
+	// filter for admitting new peers; nil if all peers are admitted
+	peerFilter PeerFilter
 
-	ctx context.Context
+	// set when a graceful shutdown has started; see Close
+	closing bool
+	// tracks the peer writers, so that Close can wait for the outbound queues to drain
+	writers sync.WaitGroup
+	// closed when the event loop exits
+	done chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // PubSubRouter is the message router component of PubSub.
@@ -169,6 +213,14 @@ type PubSubRouter interface {
 	Leave(topic string)
 }
 
+// PreValidationRouter is an optional interface for routers that need to see messages before
+// they are validated.
+type PreValidationRouter interface {
+	// PreValidation is invoked on messages we haven't seen before, before pushing them to the
+	// validation pipeline.
+	PreValidation(*Message)
+}
+
 type Message struct {
 	*pb.Message
 	ReceivedFrom  peer.ID
@@ -184,22 +236,29 @@ type RPC struct {
 
 	// unexported on purpose, not sending this over the wire
 	from peer.ID
+
+	// cached encodings of the messages in Publish, by index; the encoding of the first message
+	// is kept inline, as most RPCs carry a single message. Entries may be missing or nil, in
+	// which case the message is encoded when the RPC is written
+	encoded0 []byte
+	encoded  [][]byte
 }
 
 type Option func(*PubSub) error
 
 // NewPubSub returns a new PubSub management object.
 func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option) (*PubSub, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	ps := &PubSub{
 		host:                  h,
 		ctx:                   ctx,
+		cancel:                cancel,
 		rt:                    rt,
 		val:                   newValidation(),
 		disc:                  &discover{},
 		maxMessageSize:        DefaultMaxMessageSize,
 		peerOutboundQueueSize: 32,
 		signID:                h.ID(),
-		signKey:               h.Peerstore().PrivKey(h.ID()),
 		signStrict:            true,
 		incoming:              make(chan *RPC, 32),
 		publish:               make(chan *Message),
@@ -220,32 +279,69 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 		myTopics:              make(map[string]*Topic),
 		mySubs:                make(map[string]map[*Subscription]struct{}),
 		topics:                make(map[string]map[peer.ID]struct{}),
-		peers:                 make(map[peer.ID]chan *RPC),
+		peers:                 make(map[peer.ID]*rpcQueue),
 		blacklist:             NewMapBlacklist(),
-		blacklistPeer:         make(chan peer.ID),
-		seenMessages:          timecache.NewTimeCache(TimeCacheDuration),
+		blacklistPeer:         make(chan blacklistReq),
+		unblacklistPeer:       make(chan peer.ID),
+		seenMsgTTL:            TimeCacheDuration,
+		seenMsgStrategy:       SeenMessagesFirstSeen,
 		msgID:                 DefaultMsgIdFn,
 		counter:               uint64(time.Now().UnixNano()),
+		done:                  make(chan struct{}),
 	}
 
 	for _, opt := range opts {
 		err := opt(ps)
 		if err != nil {
+			cancel()
 			return nil, err
 		}
 	}
 
-	if ps.signStrict && ps.signKey == nil {
+	// sign with the private key of the author, unless a custom signer was provided
+	if !ps.signDisabled && !ps.customSigner {
+		ps.signer = h.Peerstore().PrivKey(ps.signID)
+		if ps.signer == nil && ps.signID != h.ID() {
+			cancel()
+			return nil, fmt.Errorf("can't sign for peer %s: no private key", ps.signID)
+		}
+	}
+
+	if ps.signStrict && ps.signer == nil {
+		cancel()
 		return nil, fmt.Errorf("strict signature verification enabled but message signing is disabled")
 	}
 
+	if ps.seqnos != nil {
+		counter, err := ps.seqnos.Start(ps.signID, ps.counter)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		ps.counter = counter
+		go ps.seqnos.background(ps)
+	}
+
+	if ps.seenMessages == nil {
+		switch ps.seenMsgStrategy {
+		case SeenMessagesLastSeen:
+			ps.seenMessages = NewLastSeenCache(ps.seenMsgTTL)
+		default:
+			ps.seenMessages = NewFirstSeenCache(ps.seenMsgTTL)
+		}
+	}
+
+	ps.hops = newHopTracker(ps.seenMsgTTL)
+	ps.encodings = newEncodingCache(encodingCacheTTL)
+
 	if err := ps.disc.Start(ps); err != nil {
+		cancel()
 		return nil, err
 	}
 
 	rt.Attach(ps)
 
-	for _, id := range rt.Protocols() {
+	for _, id := range ps.protocols() {
 		h.SetStreamHandler(id, ps.handleNewStream)
 	}
 	h.Network().Notify((*PubSubNotif)(ps))
@@ -277,6 +373,8 @@ func WithMessageIdFn(fn MsgIdFunction) Option {
 
 // WithPeerOutboundQueueSize is an option to set the buffer size for outbound messages to a peer
 // We start dropping messages to a peer if the outbound queue if full
+// The outbound queue has separate lanes for control, published, forwarded and gossip traffic,
+// and the size applies to each lane.
 func WithPeerOutboundQueueSize(size int) Option {
 	return func(p *PubSub) error {
 		if size <= 0 {
@@ -288,16 +386,19 @@ func WithPeerOutboundQueueSize(size int) Option {
 }
 
 // WithMessageSigning enables or disables message signing (enabled by default).
+// Enabling signing keeps a signer set with WithMessageSigner, while disabling signing
+// conflicts with it.
 func WithMessageSigning(enabled bool) Option {
 	return func(p *PubSub) error {
 		if enabled {
-			p.signKey = p.host.Peerstore().PrivKey(p.signID)
-			if p.signKey == nil {
-				return fmt.Errorf("can't sign for peer %s: no private key", p.signID)
-			}
+			p.signDisabled = false
 		} else {
-			p.signKey = nil
+			if p.customSigner {
+				return fmt.Errorf("can't disable message signing with a custom message signer")
+			}
+			p.signer = nil
 			p.signStrict = false
+			p.signDisabled = true
 		}
 		return nil
 	}
@@ -305,20 +406,66 @@ func WithMessageSigning(enabled bool) Option {
 
 // WithMessageAuthor sets the author for outbound messages to the given peer ID
 // (defaults to the host's ID). If message signing is enabled, the private key
-// must be available in the host's peerstore.
+// must be available in the host's peerstore. With a signer set with WithMessageSigner,
+// the author must be the signer's peer ID.
 func WithMessageAuthor(author peer.ID) Option {
 	return func(p *PubSub) error {
 		if author == "" {
 			author = p.host.ID()
 		}
-		if p.signKey != nil {
-			newSignKey := p.host.Peerstore().PrivKey(author)
-			if newSignKey == nil {
-				return fmt.Errorf("can't sign for peer %s: no private key", p.signID)
-			}
-			p.signKey = newSignKey
+		if p.customSigner && author != p.signID {
+			return fmt.Errorf("message author %s conflicts with the message signer for %s", author, p.signID)
+		}
+		p.signID = author
+		p.customAuthor = true
+		return nil
+	}
+}
+
+// getSigner returns the signer for messages authored by the given peer; this is the configured
+// signer for the default author, and the private key in the peerstore for any other author.
+// The signer is nil if message signing is disabled.
+func (p *PubSub) getSigner(author peer.ID) (Signer, error) {
+	if p.signer == nil {
+		return nil, nil
+	}
+
+	if author == p.signID {
+		return p.signer, nil
+	}
+
+	signKey := p.host.Peerstore().PrivKey(author)
+	if signKey == nil {
+		return nil, fmt.Errorf("can't sign for peer %s: no private key", author)
+	}
+
+	return signKey, nil
+}
+
+// WithMessageSigner sets a custom signer for outbound messages, enabling message signing
+// without the private key being available in the peerstore. The author of outbound messages
+// is set to the peer ID corresponding to the signer's public key.
+// The signer is kept by WithMessageSigning and WithMessageAuthor in any order; disabling
+// signing or setting a different author conflicts with it.
+func WithMessageSigner(signer Signer) Option {
+	return func(p *PubSub) error {
+		if signer == nil {
+			return fmt.Errorf("message signer must not be nil")
+		}
+
+		author, err := peer.IDFromPublicKey(signer.GetPublic())
+		if err != nil {
+			return fmt.Errorf("can't derive author from signer public key: %w", err)
+		}
+		if p.signDisabled {
+			return fmt.Errorf("can't set a custom message signer with message signing disabled")
 		}
+		if p.customAuthor && author != p.signID {
+			return fmt.Errorf("message signer for %s conflicts with the message author %s", author, p.signID)
+		}
+		p.signer = signer
 		p.signID = author
+		p.customSigner = true
 		return nil
 	}
 }
@@ -333,7 +480,8 @@ func WithStrictSignatureVerification(required bool) Option {
 }
 
 // WithBlacklist provides an implementation of the blacklist; the default is a
-// MapBlacklist
+// MapBlacklist. When the blacklist is shared with a BlacklistConnectionGater, provide the
+// blacklist returned by the Blacklist method of the gater.
 func WithBlacklist(b Blacklist) Option {
 	return func(p *PubSub) error {
 		p.blacklist = b
@@ -341,6 +489,33 @@ func WithBlacklist(b Blacklist) Option {
 	}
 }
 
+// PeerFilter decides whether to admit a peer to pubsub, given its peer ID, the negotiated
+// router protocol and the remote multiaddrs of its connections.
+// The filter is invoked from the stream handling goroutines and must be safe for
+// concurrent use.
+type PeerFilter func(pid peer.ID, proto protocol.ID, addrs []ma.Multiaddr) bool
+
+// WithPeerFilter is an option to filter the peers admitted to pubsub, eg to restrict a
+// private network to an allowlist. Our stream to a peer that is not admitted is reset before
+// anything is sent, and so are its streams to us. Peers that keep reconnecting should be dealt
+// with by the filter or a connection gater.
+func WithPeerFilter(filter PeerFilter) Option {
+	return func(p *PubSub) error {
+		p.peerFilter = filter
+		return nil
+	}
+}
+
+// WithBlacklistDisconnect is an option to close the connections to blacklisted peers, when a
+// peer is blacklisted and when a blacklisted peer connects, rather than just ignoring them.
+// Use a BlacklistConnectionGater in the host to refuse the connections altogether.
+func WithBlacklistDisconnect(disconnect bool) Option {
+	return func(p *PubSub) error {
+		p.blacklistDisconnect = disconnect
+		return nil
+	}
+}
+
 // WithDiscovery provides a discovery mechanism used to bootstrap and provide peers into PubSub
 func WithDiscovery(d discovery.Discovery, opts ...DiscoverOpt) Option {
 	return func(p *PubSub) error {
@@ -398,15 +573,55 @@ func WithMaxMessageSize(maxMessageSize int) Option {
 	}
 }
 
+// WithSeenMessagesTTL sets the TTL of entries in the seen messages cache; the default is
+// TimeCacheDuration.
+// Note that peers may forward messages to us for as long as they remain in their own
+// caches, so this should not be set lower than the TTL used by the rest of the network.
+func WithSeenMessagesTTL(ttl time.Duration) Option {
+	return func(ps *PubSub) error {
+		if ttl <= 0 {
+			return fmt.Errorf("seen messages TTL must be positive")
+		}
+		ps.seenMsgTTL = ttl
+		return nil
+	}
+}
+
+// WithSeenMessagesStrategy sets the expiry strategy of the seen messages cache; the default
+// is SeenMessagesFirstSeen.
+func WithSeenMessagesStrategy(strategy SeenMessagesStrategy) Option {
+	return func(ps *PubSub) error {
+		switch strategy {
+		case SeenMessagesFirstSeen, SeenMessagesLastSeen:
+		default:
+			return fmt.Errorf("unknown seen messages strategy %d", strategy)
+		}
+		ps.seenMsgStrategy = strategy
+		return nil
+	}
+}
+
+// WithSeenMessagesCache provides a custom implementation of the seen messages cache, eg one
+// created with NewBoundedSeenCache; it takes precedence over WithSeenMessagesStrategy.
+// The TTL set with WithSeenMessagesTTL should match the expiry of the cache, as it is also
+// used to track message deliveries for peer scoring.
+func WithSeenMessagesCache(cache SeenMessagesCache) Option {
+	return func(ps *PubSub) error {
+		ps.seenMessages = cache
+		return nil
+	}
+}
+
 // processLoop handles all inputs arriving on the channels
 func (p *PubSub) processLoop(ctx context.Context) {
 	defer func() {
 		// Clean up go routines.
-		for _, ch := range p.peers {
-			close(ch)
+		for _, q := range p.peers {
+			q.Close()
 		}
 		p.peers = nil
 		p.topics = nil
+		close(p.done)
 	}()
 
 	for {
@@ -419,18 +634,25 @@ func (p *PubSub) processLoop(ctx context.Context) {
 
 			if p.blacklist.Contains(pid) {
 				log.Warning("ignoring connection from blacklisted peer: ", pid)
+				p.disconnectBlacklisted(pid)
+				continue
+			}
+
+			if p.closing {
+				log.Debug("ignoring connection while shutting down: ", pid)
 				continue
 			}
 
-			messages := make(chan *RPC, p.peerOutboundQueueSize)
-			messages <- p.getHelloPacket()
+			messages := newRPCQueue(p.peerOutboundQueueSize)
+			messages.Push(p.getHelloPacket(), rpcPriorityControl)
+			p.writers.Add(1)
 			go p.handleNewPeer(ctx, pid, messages)
 			p.peers[pid] = messages
 
 		case s := <-p.newPeerStream:
 			pid := s.Conn().RemotePeer()
 
-			ch, ok := p.peers[pid]
+			q, ok := p.peers[pid]
 			if !ok {
 				log.Warning("new stream for unknown peer: ", pid)
 				s.Reset()
@@ -439,30 +661,32 @@ func (p *PubSub) processLoop(ctx context.Context) {
 
 			if p.blacklist.Contains(pid) {
 				log.Warning("closing stream for blacklisted peer: ", pid)
-				close(ch)
+				q.Close()
 				s.Reset()
+				p.disconnectBlacklisted(pid)
 				continue
 			}
 
-			p.rt.AddPeer(pid, s.Protocol())
+			p.rt.AddPeer(pid, p.routerProtocol(s.Protocol()))
 
 		case pid := <-p.newPeerError:
 			delete(p.peers, pid)
 
 		case pid := <-p.peerDead:
-			ch, ok := p.peers[pid]
+			q, ok := p.peers[pid]
 			if !ok {
 				continue
 			}
 
-			close(ch)
+			q.Close()
 
-			if p.host.Network().Connectedness(pid) == network.Connected {
+			if !p.closing && p.host.Network().Connectedness(pid) == network.Connected {
 				// still connected, must be a duplicate connection being closed.
 				// we respawn the writer as we need to ensure there is a stream active
 				log.Warning("peer declared dead but still connected; respawning writer: ", pid)
-				messages := make(chan *RPC, p.peerOutboundQueueSize)
-				messages <- p.getHelloPacket()
+				messages := newRPCQueue(p.peerOutboundQueueSize)
+				messages.Push(p.getHelloPacket(), rpcPriorityControl)
+				p.writers.Add(1)
 				go p.handleNewPeer(ctx, pid, messages)
 				p.peers[pid] = messages
 				continue
@@ -513,8 +737,13 @@ func (p *PubSub) processLoop(ctx context.Context) {
 			p.handleIncomingRPC(rpc)
 
 		case msg := <-p.publish:
+			if p.closing {
+				log.Debug("dropping message published while shutting down")
+				continue
+			}
+
 			p.tracer.PublishMessage(msg)
-			p.pushMsg(msg)
+			p.pushMsg(msg, 0, nil)
 
 		case msg := <-p.sendMsg:
 			p.publishMessage(msg)
@@ -528,13 +757,19 @@ func (p *PubSub) processLoop(ctx context.Context) {
 		case thunk := <-p.eval:
 			thunk()
 
-		case pid := <-p.blacklistPeer:
-			log.Infof("Blacklisting peer %s", pid)
-			p.blacklist.Add(pid)
+		case req := <-p.blacklistPeer:
+			pid := req.pid
+			if req.ttl > 0 {
+				log.Infof("Blacklisting peer %s for %s", pid, req.ttl)
+				p.blacklist.(ExpiringBlacklist).AddWithTTL(pid, req.ttl)
+			} else {
+				log.Infof("Blacklisting peer %s", pid)
+				p.blacklist.Add(pid)
+			}
 
-			ch, ok := p.peers[pid]
+			q, ok := p.peers[pid]
 			if ok {
-				close(ch)
+				q.Close()
 				delete(p.peers, pid)
 				for t, tmap := range p.topics {
 					if _, ok := tmap[pid]; ok {
@@ -545,6 +780,22 @@ func (p *PubSub) processLoop(ctx context.Context) {
 				p.rt.RemovePeer(pid)
 			}
 
+			p.disconnectBlacklisted(pid)
+
+		case pid := <-p.unblacklistPeer:
+			log.Infof("Unblacklisting peer %s", pid)
+			p.blacklist.Remove(pid)
+
+			// readmit the peer if it is still connected
+			_, ok := p.peers[pid]
+			if !ok && !p.closing && p.host.Network().Connectedness(pid) == network.Connected {
+				messages := newRPCQueue(p.peerOutboundQueueSize)
+				messages.Push(p.getHelloPacket(), rpcPriorityControl)
+				p.writers.Add(1)
+				go p.handleNewPeer(ctx, pid, messages)
+				p.peers[pid] = messages
+			}
+
 		case <-ctx.Done():
 			log.Info("pubsub processloop shutting down")
 			return
@@ -552,6 +803,20 @@ func (p *PubSub) processLoop(ctx context.Context) {
 	}
 }
 
+// disconnectBlacklisted closes the connections to a blacklisted peer, if enabled.
+func (p *PubSub) disconnectBlacklisted(pid peer.ID) {
+	if !p.blacklistDisconnect {
+		return
+	}
+
+	go func() {
+		err := p.host.Network().ClosePeer(pid)
+		if err != nil {
+			log.Warningf("error closing connections to blacklisted peer %s: %s", pid, err)
+		}
+	}()
+}
+
 // handleAddTopic adds a tracker for a particular topic.
 // Only called from processLoop.
 func (p *PubSub) handleAddTopic(req *addTopicReq) {
@@ -565,6 +830,9 @@ func (p *PubSub) handleAddTopic(req *addTopicReq) {
 	}
 
 	p.myTopics[topicID] = topic
+	for _, fn := range topic.onAdd {
+		fn()
+	}
 	req.resp <- topic
 }
 
@@ -580,6 +848,9 @@ func (p *PubSub) handleRemoveTopic(req *rmTopicReq) {
 
 	if len(topic.evtHandlers) == 0 && len(p.mySubs[req.topic.topic]) == 0 {
 		delete(p.myTopics, topic.topic)
+		for _, fn := range topic.onRemove {
+			fn()
+		}
 		req.resp <- nil
 		return
 	}
@@ -618,6 +889,13 @@ func (p *PubSub) handleAddSubscription(req *addSubReq) {
 	sub := req.sub
 	subs := p.mySubs[sub.topic]
 
+	if p.closing {
+		sub.err = ErrPubSubClosed
+		sub.close()
+		req.resp <- sub
+		return
+	}
+
 	// announce we want this topic
 	if len(subs) == 0 {
 		p.disc.Advertise(sub.topic)
@@ -646,11 +924,10 @@ func (p *PubSub) announce(topic string, sub bool) {
 	}
 
 	out := rpcWithSubs(subopt)
-	for pid, peer := range p.peers {
-		select {
-		case peer <- out:
+	for pid, q := range p.peers {
+		if q.Push(out, rpcPriorityControl) {
 			p.tracer.SendRPC(out, pid)
-		default:
+		} else {
 			log.Infof("Can't send announce message to peer %s: queue full; scheduling retry", pid)
 			p.tracer.DropRPC(out, pid)
 			go p.announceRetry(pid, topic, sub)
@@ -675,7 +952,7 @@ func (p *PubSub) announceRetry(pid peer.ID, topic string, sub bool) {
 }
 
 func (p *PubSub) doAnnounceRetry(pid peer.ID, topic string, sub bool) {
-	peer, ok := p.peers[pid]
+	q, ok := p.peers[pid]
 	if !ok {
 		return
 	}
@@ -686,10 +963,9 @@ func (p *PubSub) doAnnounceRetry(pid peer.ID, topic string, sub bool) {
 	}
 
 	out := rpcWithSubs(subopt)
-	select {
-	case peer <- out:
+	if q.Push(out, rpcPriorityControl) {
 		p.tracer.SendRPC(out, pid)
-	default:
+	} else {
 		log.Infof("Can't send announce message to peer %s: queue full; scheduling retry", pid)
 		p.tracer.DropRPC(out, pid)
 		go p.announceRetry(pid, topic, sub)
@@ -723,12 +999,7 @@ func (p *PubSub) seenMessage(id string) bool {
 func (p *PubSub) markSeen(id string) bool {
 	p.seenMessagesMx.Lock()
 	defer p.seenMessagesMx.Unlock()
-	if p.seenMessages.Has(id) {
-		return false
-	}
-
-	p.seenMessages.Add(id)
-	return true
+	return p.seenMessages.Add(id)
 }
 
 // subscribedToMessage returns whether we are subscribed to one of the topics
@@ -755,7 +1026,15 @@ func (p *PubSub) notifyLeave(topic string, pid peer.ID) {
 func (p *PubSub) handleIncomingRPC(rpc *RPC) {
 	p.tracer.RecvRPC(rpc)
 
-	for _, subopt := range rpc.GetSubscriptions() {
+	// discard the subscriptions of blacklisted peers, which are not readmitted until they are
+	// unblacklisted; their messages are rejected below
+	subs := rpc.GetSubscriptions()
+	if len(subs) > 0 && p.blacklist.Contains(rpc.from) {
+		log.Debugf("ignoring subscriptions from blacklisted peer %s", rpc.from)
+		subs = nil
+	}
+
+	for _, subopt := range subs {
 		t := subopt.GetTopicid()
 		if subopt.GetSubscribe() {
 			tmap, ok := p.topics[t]
@@ -790,14 +1069,15 @@ func (p *PubSub) handleIncomingRPC(rpc *RPC) {
 		return
 	}
 
-	for _, pmsg := range rpc.GetPublish() {
+	for i, pmsg := range rpc.GetPublish() {
 		if !p.subscribedToMsg(pmsg) {
 			log.Warning("received message we didn't subscribe to. Dropping.")
 			continue
 		}
 
-		msg := &Message{pmsg, rpc.from, nil}
-		p.pushMsg(msg)
+		msg := &Message{Message: pmsg, ReceivedFrom: rpc.from}
+		// account for the hop the message just travelled
+		p.pushMsg(msg, rpc.messageHops(i)+1, rpc.encodedMessage(i))
 	}
 
 	p.rt.HandleRPC(rpc)
@@ -808,8 +1088,9 @@ func DefaultMsgIdFn(pmsg *pb.Message) string {
 	return string(pmsg.GetFrom()) + string(pmsg.GetSeqno())
 }
 
-// pushMsg pushes a message performing validation as necessary
-func (p *PubSub) pushMsg(msg *Message) {
+// pushMsg pushes a message performing validation as necessary; hops is the number of hops the
+// message has travelled to reach us.
+func (p *PubSub) pushMsg(msg *Message, hops uint32, enc []byte) {
 	src := msg.ReceivedFrom
 	// reject messages from blacklisted peers
 	if p.blacklist.Contains(src) {
@@ -832,6 +1113,20 @@ func (p *PubSub) pushMsg(msg *Message) {
 		return
 	}
 
+	// reject messages that have travelled more hops than allowed; honest peers don't forward those
+	if msg.HopLimit != nil && hops > msg.GetHopLimit() {
+		log.Debugf("dropping message from %s exceeding its hop limit", src)
+		p.tracer.RejectMessage(msg, rejectHopLimitExceeded)
+		return
+	}
+
+	// reject expired messages
+	if messageExpired(msg.Message, time.Now()) {
+		log.Debugf("dropping expired message from %s", src)
+		p.tracer.RejectMessage(msg, rejectMessageExpired)
+		return
+	}
+
 	// reject messages claiming to be from ourselves but not locally published
 	self := p.host.ID()
 	if peer.ID(msg.GetFrom()) == self && src != self {
@@ -847,6 +1142,19 @@ func (p *PubSub) pushMsg(msg *Message) {
 		return
 	}
 
+	if msg.HopLimit != nil {
+		p.hops.Add(id, hops)
+	}
+
+	// keep the encoding the message was received with, for forwarding it
+	if enc != nil {
+		p.encodings.Add(id, enc)
+	}
+
+	if rt, ok := p.rt.(PreValidationRouter); ok {
+		rt.PreValidation(msg)
+	}
+
 	if !p.val.Push(src, msg) {
 		return
 	}
@@ -857,9 +1165,47 @@ func (p *PubSub) pushMsg(msg *Message) {
 }
 
 func (p *PubSub) publishMessage(msg *Message) {
+	// the message may have expired while in the validation pipeline
+	if messageExpired(msg.Message, time.Now()) {
+		log.Debugf("dropping message from %s that expired during validation", msg.ReceivedFrom)
+		p.tracer.RejectMessage(msg, rejectMessageExpired)
+		return
+	}
+
+	// messages that have reached their hop limit are delivered but not forwarded
+	forward := msg.HopLimit == nil || p.messageHops(msg.Message) < msg.GetHopLimit()
+
+	// encode our own messages once for all the peers we forward them to, before they are
+	// handed to subscribers; received messages keep their wire encoding
+	if forward {
+		id := p.msgID(msg.Message)
+		if p.encodings.Get(id) == nil {
+			enc, err := msg.Marshal()
+			if err == nil {
+				p.encodings.Add(id, enc)
+			}
+		}
+	}
+
 	p.tracer.DeliverMessage(msg)
 	p.notifySubs(msg)
-	p.rt.Publish(msg)
+
+	if forward {
+		p.rt.Publish(msg)
+	}
+}
+
+// messageHops returns the number of hops a hop-limited message has travelled to reach us.
+func (p *PubSub) messageHops(m *pb.Message) uint32 {
+	if m.HopLimit == nil {
+		return 0
+	}
+	return p.hops.Get(p.msgID(m))
+}
+
+// messageExpired returns true if the message carries an expiration time that has passed.
+func messageExpired(m *pb.Message, now time.Time) bool {
+	return m.Expiry != nil && now.UnixNano() > m.GetExpiry()
 }
 
 type addTopicReq struct {
@@ -994,11 +1340,21 @@ func (p *PubSub) Publish(topic string, data []byte, opts ...PubOpt) error {
 	return t.Publish(context.TODO(), data, opts...)
 }
 
-func (p *PubSub) nextSeqno() []byte {
+func (p *PubSub) nextSeqno() ([]byte, error) {
 	seqno := make([]byte, 8)
 	counter := atomic.AddUint64(&p.counter, 1)
+	if p.seqnos != nil {
+		err := p.seqnos.Advance(counter)
+		if err != nil {
+			return nil, err
+		}
+	}
 	binary.BigEndian.PutUint64(seqno, counter)
-	return seqno
+	return seqno, nil
+}
+
+func (p *PubSub) currentSeqno() uint64 {
+	return atomic.LoadUint64(&p.counter)
 }
 
 type listPeerReq struct {
@@ -1020,10 +1376,137 @@ func (p *PubSub) ListPeers(topic string) []peer.ID {
 	return <-out
 }
 
+// Close shuts down the PubSub gracefully: it cancels all subscriptions, announces to our peers
+// that we have left our topics and PRUNEs our mesh peers, drains the outbound queues of our
+// peers and closes the streams, and finally stops the event loop, validators and discovery,
+// waits for any pending persistence of sequence numbers and flushes the event tracer.
+// It returns once everything has drained, or when the context is done, in which case the
+// shutdown is completed without waiting for the outbound queues.
+//
+// The event tracer is flushed but not closed, as it may be shared; closing it remains up to
+// the caller.
+func (p *PubSub) Close(ctx context.Context) error {
+	closing := make(chan struct{})
+	select {
+	case p.eval <- func() {
+		p.handleClose()
+		close(closing)
+	}:
+		<-closing
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+		return ctx.Err()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		p.writers.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	p.cancel()
+	<-p.done
+
+	if p.seqnos != nil {
+		select {
+		case <-p.seqnos.done:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+		}
+	}
+
+	if err == nil {
+		err = p.tracer.flush(ctx)
+	}
+
+	return err
+}
+
+// handleClose starts the graceful shutdown, leaving all our topics and closing the outbound
+// queues of our peers, which are drained by the writers before closing the streams.
+// Only called from processLoop.
+func (p *PubSub) handleClose() {
+	if p.closing {
+		return
+	}
+
+	log.Info("pubsub shutting down")
+	p.closing = true
+
+	for _, id := range p.protocols() {
+		p.host.RemoveStreamHandler(id)
+	}
+	p.host.Network().StopNotify((*PubSubNotif)(p))
+
+	for topic, subs := range p.mySubs {
+		for sub := range subs {
+			sub.err = ErrPubSubClosed
+			sub.close()
+		}
+
+		delete(p.mySubs, topic)
+		p.disc.StopAdvertise(topic)
+		p.announce(topic, false)
+		p.rt.Leave(topic)
+	}
+
+	for pid, q := range p.peers {
+		q.Close()
+		delete(p.peers, pid)
+	}
+}
+
 // BlacklistPeer blacklists a peer; all messages from this peer will be unconditionally dropped.
 func (p *PubSub) BlacklistPeer(pid peer.ID) {
 	select {
-	case p.blacklistPeer <- pid:
+	case p.blacklistPeer <- blacklistReq{pid: pid}:
+	case <-p.ctx.Done():
+	}
+}
+
+// BlacklistPeerWithTTL blacklists a peer for the given duration, like BlacklistPeer; the
+// blacklist must be an ExpiringBlacklist, such as a TimeCachedBlacklist.
+// Once the entry expires, the peer is admitted again when it reconnects.
+func (p *PubSub) BlacklistPeerWithTTL(pid peer.ID, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("blacklist TTL must be positive")
+	}
+	if _, ok := p.blacklist.(ExpiringBlacklist); !ok {
+		return fmt.Errorf("blacklist does not support expiry")
+	}
+
+	select {
+	case p.blacklistPeer <- blacklistReq{pid: pid, ttl: ttl}:
+	case <-p.ctx.Done():
+	}
+	return nil
+}
+
+type blacklistReq struct {
+	pid peer.ID
+	ttl time.Duration
+}
+
+// UnblacklistPeer removes a peer from the blacklist. If the peer is still connected, it is
+// readmitted and we open a new stream to it, announcing our subscriptions.
+// Note that the subscriptions the peer announced while blacklisted have been discarded, and the
+// protocol has no way to ask for them: we only learn of its existing subscriptions if it
+// reconnects, and of new ones as it announces them.
+func (p *PubSub) UnblacklistPeer(pid peer.ID) {
+	select {
+	case p.unblacklistPeer <- pid:
 	case <-p.ctx.Done():
 	}
 }
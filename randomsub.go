@@ -131,17 +131,17 @@ func (rs *RandomSubRouter) Publish(msg *Message) {
 		}
 	}
 
-	out := rpcWithMessages(msg.Message)
+	out := rs.p.rpcWithMessage(msg)
+	prio := rs.p.messagePriority(msg)
 	for p := range tosend {
-		mch, ok := rs.p.peers[p]
+		q, ok := rs.p.peers[p]
 		if !ok {
 			continue
 		}
 
-		select {
-		case mch <- out:
+		if q.Push(out, prio) {
 			rs.tracer.SendRPC(out, p)
-		default:
+		} else {
 			log.Infof("dropping message to peer %s: queue full", p)
 			rs.tracer.DropRPC(out, p)
 		}
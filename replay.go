@@ -0,0 +1,205 @@
+package pubsub
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// DefaultReplayWindow is the default size of the per author and topic sliding window of
+	// sequence numbers used for replay protection.
+	DefaultReplayWindow = 1024
+
+	// DefaultReplayCapacity is the default number of (author, topic) windows tracked for
+	// replay protection.
+	DefaultReplayCapacity = 65536
+)
+
+// WithReplayProtection enables sequence number replay protection in the validation pipeline.
+// For every author and topic we track a sliding window of the last `window` sequence numbers
+// following the highest sequence number accepted, and reject signed messages whose sequence
+// number has already been accepted or precedes the window; this prevents peers from replaying
+// old signed messages after they have expired from the seen messages cache.
+//
+// At most `capacity` windows are tracked, with the least recently used evicted first; a
+// message from an evicted author is accepted as if the author had never been seen before.
+// Note that the window is expressed in sequence numbers; as authors share their counter
+// across topics, the window should account for the publishing rate of authors in other
+// topics as well as reordering in the network.
+//
+// Unsigned messages are not subject to replay protection, as their sequence numbers are
+// not authenticated.
+func WithReplayProtection(window uint64, capacity int) Option {
+	return func(ps *PubSub) error {
+		if window == 0 {
+			return fmt.Errorf("replay window must be positive")
+		}
+		if capacity <= 0 {
+			return fmt.Errorf("replay capacity must be positive")
+		}
+
+		ps.val.replay = newReplayFilter(window, capacity)
+		return nil
+	}
+}
+
+// replayFilter tracks accepted sequence numbers per author and topic.
+type replayFilter struct {
+	sync.Mutex
+
+	window   uint64
+	capacity int
+
+	// LRU of tracked windows
+	lru     *list.List
+	windows map[replayKey]*list.Element
+}
+
+type replayKey struct {
+	author peer.ID
+	topic  string
+}
+
+// seqnoWindow is a sliding window of sequence numbers; bit i of the bitmap marks whether
+// the sequence number max-i has been accepted.
+type seqnoWindow struct {
+	key    replayKey
+	max    uint64
+	bitmap []uint64
+}
+
+func newReplayFilter(window uint64, capacity int) *replayFilter {
+	return &replayFilter{
+		window:   window,
+		capacity: capacity,
+		lru:      list.New(),
+		windows:  make(map[replayKey]*list.Element),
+	}
+}
+
+// Check checks whether a message is a replay, without recording its sequence number.
+func (r *replayFilter) Check(msg *Message) bool {
+	if len(msg.Seqno) != 8 {
+		// not a sequence number we generate; we can't reason about the ordering
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.check(binary.BigEndian.Uint64(msg.Seqno), msg.GetFrom(), msg.GetTopicIDs())
+}
+
+// Accept checks whether a message is a replay, and records its sequence number if it isn't.
+// This should only be called for messages that have passed validation, so that invalid
+// messages don't advance the window.
+func (r *replayFilter) Accept(msg *Message) bool {
+	if len(msg.Seqno) != 8 {
+		return false
+	}
+
+	seqno := binary.BigEndian.Uint64(msg.Seqno)
+	author := msg.GetFrom()
+	topics := msg.GetTopicIDs()
+
+	r.Lock()
+	defer r.Unlock()
+
+	// check all topics before recording, so that a rejected message leaves no trace
+	if !r.check(seqno, author, topics) {
+		return false
+	}
+
+	for _, topic := range topics {
+		r.getWindow(replayKey{author, topic}).add(seqno, r.window)
+	}
+
+	return true
+}
+
+// check checks the sequence number against the windows of all topics; the caller must hold
+// the lock.
+func (r *replayFilter) check(seqno uint64, author peer.ID, topics []string) bool {
+	for _, topic := range topics {
+		elt, ok := r.windows[replayKey{author, topic}]
+		if ok && !elt.Value.(*seqnoWindow).check(seqno, r.window) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *replayFilter) getWindow(key replayKey) *seqnoWindow {
+	elt, ok := r.windows[key]
+	if ok {
+		r.lru.MoveToBack(elt)
+		return elt.Value.(*seqnoWindow)
+	}
+
+	if len(r.windows) >= r.capacity {
+		oldest := r.lru.Front()
+		r.lru.Remove(oldest)
+		delete(r.windows, oldest.Value.(*seqnoWindow).key)
+	}
+
+	w := &seqnoWindow{key: key, bitmap: make([]uint64, (r.window+63)/64)}
+	r.windows[key] = r.lru.PushBack(w)
+	return w
+}
+
+// check returns true if the sequence number is new and within the window.
+func (w *seqnoWindow) check(seqno, window uint64) bool {
+	if seqno > w.max {
+		return true
+	}
+
+	offset := w.max - seqno
+	if offset >= window {
+		return false
+	}
+
+	return w.bitmap[offset/64]&(1<<(offset%64)) == 0
+}
+
+// add records a sequence number that has passed the check.
+func (w *seqnoWindow) add(seqno, window uint64) {
+	if seqno > w.max {
+		w.shift(seqno - w.max)
+		w.max = seqno
+	}
+
+	offset := w.max - seqno
+	w.bitmap[offset/64] |= 1 << (offset % 64)
+}
+
+// shift slides the window forward by n sequence numbers.
+func (w *seqnoWindow) shift(n uint64) {
+	words := uint64(len(w.bitmap))
+	if n >= words*64 {
+		for i := range w.bitmap {
+			w.bitmap[i] = 0
+		}
+		return
+	}
+
+	wshift, bshift := n/64, n%64
+	for i := words - 1; ; i-- {
+		var v uint64
+		if i >= wshift {
+			v = w.bitmap[i-wshift] << bshift
+			if bshift > 0 && i > wshift {
+				v |= w.bitmap[i-wshift-1] >> (64 - bshift)
+			}
+		}
+		w.bitmap[i] = v
+
+		if i == 0 {
+			break
+		}
+	}
+}
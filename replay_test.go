@@ -0,0 +1,204 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func makeReplayTestMessage(from string, seqno uint64, topics ...string) *Message {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seqno)
+	return &Message{Message: &pb.Message{From: []byte(from), Seqno: buf, TopicIDs: topics}}
+}
+
+func TestReplayFilterWindow(t *testing.T) {
+	r := newReplayFilter(100, 10)
+
+	accept := func(seqno uint64, expected bool) {
+		t.Helper()
+		if r.Accept(makeReplayTestMessage("a", seqno, "test")) != expected {
+			t.Fatalf("unexpected replay filter result for seqno %d; expected %v", seqno, expected)
+		}
+	}
+
+	accept(1000, true)
+	accept(1000, false)
+	accept(1001, true)
+	accept(950, true)
+	accept(950, false)
+	accept(901, false)
+	accept(902, true)
+
+	// sliding the window forward across multiple words preserves the accepted seqnos
+	accept(1070, true)
+	accept(1001, false)
+	accept(1000, false)
+	accept(999, true)
+	accept(970, false)
+
+	// and a large jump clears the window
+	accept(5000, true)
+	accept(4999, true)
+	accept(1070, false)
+
+	// other topics and authors have their own windows
+	if !r.Accept(makeReplayTestMessage("a", 1000, "other")) {
+		t.Fatal("expected message in another topic to be accepted")
+	}
+	if !r.Accept(makeReplayTestMessage("b", 1000, "test")) {
+		t.Fatal("expected message from another author to be accepted")
+	}
+
+	// checking a message doesn't record its seqno
+	if !r.Check(makeReplayTestMessage("a", 6000, "test")) || !r.Check(makeReplayTestMessage("a", 6000, "test")) {
+		t.Fatal("expected check to not record the seqno")
+	}
+	if r.Check(makeReplayTestMessage("a", 5000, "test")) {
+		t.Fatal("expected check to reject a replay")
+	}
+
+	// a multi-topic message is rejected if it is a replay in any of its topics
+	if r.Accept(makeReplayTestMessage("a", 1000, "test2", "other")) {
+		t.Fatal("expected multi-topic replay to be rejected")
+	}
+	if !r.Accept(makeReplayTestMessage("a", 1000, "test2")) {
+		t.Fatal("expected rejected multi-topic message to leave no trace")
+	}
+}
+
+func TestReplayFilterCapacity(t *testing.T) {
+	r := newReplayFilter(100, 2)
+
+	r.Accept(makeReplayTestMessage("a", 1000, "test"))
+	r.Accept(makeReplayTestMessage("b", 1000, "test"))
+	r.Accept(makeReplayTestMessage("c", 1000, "test"))
+
+	if len(r.windows) != 2 {
+		t.Fatalf("expected 2 tracked windows, got %d", len(r.windows))
+	}
+
+	// a was evicted
+	if !r.Accept(makeReplayTestMessage("a", 1000, "test")) {
+		t.Fatal("expected message from evicted author to be accepted")
+	}
+	if r.Accept(makeReplayTestMessage("c", 1000, "test")) {
+		t.Fatal("expected replay to be rejected")
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts,
+		WithSeenMessagesTTL(100*time.Millisecond),
+		WithReplayProtection(DefaultReplayWindow, DefaultReplayCapacity))
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = psubs[0].Publish("test", []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the message to expire from the seen cache and replay it
+	time.Sleep(200 * time.Millisecond)
+	psubs[0].eval <- func() {
+		psubs[0].peers[hosts[1].ID()].Push(rpcWithMessages(msg.Message), rpcPriorityForward)
+	}
+
+	wctx, wcancel := context.WithTimeout(ctx, time.Second)
+	defer wcancel()
+	_, err = sub.Next(wctx)
+	if err == nil {
+		t.Fatal("replayed message was delivered")
+	}
+}
+
+func TestReplayProtectionRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts,
+		WithSeenMessagesTTL(100*time.Millisecond),
+		WithReplayProtection(DefaultReplayWindow, DefaultReplayCapacity))
+	connect(t, hosts[0], hosts[1])
+
+	var accept int32
+	err := psubs[1].RegisterTopicValidator("test", func(context.Context, peer.ID, *Message) bool {
+		return atomic.LoadInt32(&accept) == 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	seqno, err := psubs[0].nextSeqno()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &pb.Message{
+		Data:     []byte("message"),
+		TopicIDs: []string{"test"},
+		From:     []byte(hosts[0].ID()),
+		Seqno:    seqno,
+	}
+	err = signMessage(psubs[0].signID, psubs[0].signer, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := func() {
+		psubs[0].eval <- func() {
+			psubs[0].peers[hosts[1].ID()].Push(rpcWithMessages(m), rpcPriorityForward)
+		}
+	}
+
+	// the message is rejected by the validator
+	push()
+
+	wctx, wcancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer wcancel()
+	_, err = sub.Next(wctx)
+	if err == nil {
+		t.Fatal("rejected message was delivered")
+	}
+
+	// the rejected message didn't advance the replay window, so it is accepted once it
+	// passes validation
+	atomic.StoreInt32(&accept, 1)
+	push()
+
+	wctx, wcancel = context.WithTimeout(ctx, time.Second)
+	defer wcancel()
+	_, err = sub.Next(wctx)
+	if err != nil {
+		t.Fatal("expected message to be delivered after passing validation")
+	}
+}
@@ -0,0 +1,533 @@
+package pubsub
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"io"
+	"time"
+
+	ggio "github.com/gogo/protobuf/io"
+	proto "github.com/gogo/protobuf/proto"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// RPC field tags, for fields of wire type 2 (length-delimited).
+const (
+	rpcSubscriptionsTag = byte(1<<3 | 2)
+	rpcPublishTag       = byte(2<<3 | 2)
+	rpcControlTag       = byte(3<<3 | 2)
+)
+
+// encodingCacheTTL is the default time the encodings of messages are kept for forwarding them
+// and serving IWANT requests; the gossipsub router extends it to its message cache window.
+const encodingCacheTTL = 10 * time.Second
+
+// encodingCache holds the encodings of recent messages by message ID, so that messages are
+// forwarded and served from the message cache without being encoded for every peer.
+// Received messages keep the encoding they were received with, while our own messages are
+// encoded once when published. Entries expire with the TTL, and expired entries are swept from
+// the head of the queue on every Add; a message whose encoding has expired is encoded when
+// the RPC is written. The cache is only accessed from the event loop.
+type encodingCache struct {
+	ttl time.Duration
+
+	queue   *list.List
+	entries map[string]*list.Element
+}
+
+type encodingEntry struct {
+	id     string
+	enc    []byte
+	expire time.Time
+}
+
+func newEncodingCache(ttl time.Duration) *encodingCache {
+	return &encodingCache{
+		ttl:     ttl,
+		queue:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Add caches the encoding of a message, unless it is already cached.
+func (ec *encodingCache) Add(id string, enc []byte) {
+	now := time.Now()
+	ec.sweep(now)
+
+	if _, ok := ec.entries[id]; ok {
+		return
+	}
+
+	ec.entries[id] = ec.queue.PushBack(&encodingEntry{id: id, enc: enc, expire: now.Add(ec.ttl)})
+}
+
+// Get returns the cached encoding of a message, or nil if there is none.
+func (ec *encodingCache) Get(id string) []byte {
+	elt, ok := ec.entries[id]
+	if !ok {
+		return nil
+	}
+	return elt.Value.(*encodingEntry).enc
+}
+
+func (ec *encodingCache) sweep(now time.Time) {
+	for elt := ec.queue.Front(); elt != nil; elt = ec.queue.Front() {
+		e := elt.Value.(*encodingEntry)
+		if e.expire.After(now) {
+			return
+		}
+		ec.queue.Remove(elt)
+		delete(ec.entries, e.id)
+	}
+}
+
+// rpcWithMessage returns an RPC for forwarding msg, carrying its cached encoding and hop count.
+func (p *PubSub) rpcWithMessage(msg *Message) *RPC {
+	out := new(RPC)
+	out.appendMessage(msg.Message, p.encodings.Get(p.msgID(msg.Message)), p.messageHops(msg.Message))
+	return out
+}
+
+// appendMessage appends a message to the RPC, along with its cached encoding if not nil and
+// its hop count.
+func (rpc *RPC) appendMessage(m *pb.Message, enc []byte, hops uint32) {
+	if enc != nil {
+		rpc.setEncoded(len(rpc.Publish), enc)
+	}
+	if hops != 0 {
+		if pad := len(rpc.Publish) - len(rpc.Hops); pad > 0 {
+			rpc.Hops = append(rpc.Hops, make([]uint32, pad)...)
+		}
+		rpc.Hops = append(rpc.Hops, hops)
+	}
+	rpc.Publish = append(rpc.Publish, m)
+}
+
+// setEncoded sets the cached encoding of the i-th message; encodings must be set in order.
+func (rpc *RPC) setEncoded(i int, enc []byte) {
+	if i == 0 {
+		rpc.encoded0 = enc
+		return
+	}
+	if pad := i - 1 - len(rpc.encoded); pad > 0 {
+		rpc.encoded = append(rpc.encoded, make([][]byte, pad)...)
+	}
+	rpc.encoded = append(rpc.encoded, enc)
+}
+
+// unmarshal decodes an RPC frame, keeping the wire encodings of the published messages; the
+// encodings alias data, which must not be reused.
+func (rpc *RPC) unmarshal(data []byte) error {
+	err := rpc.RPC.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	// the frame is well-formed, so we can walk its fields to find the published messages
+	n := 0
+	for i := 0; i < len(data); {
+		if data[i] != rpcPublishTag {
+			l := skipField(data[i:])
+			if l <= 0 {
+				return io.ErrUnexpectedEOF
+			}
+			i += l
+			continue
+		}
+
+		i++
+		size, l := binary.Uvarint(data[i:])
+		i += l
+		rpc.setEncoded(n, data[i:i+int(size)])
+		i += int(size)
+		n++
+	}
+
+	return nil
+}
+
+// messageHops returns the hop count of the i-th message, as sent by the peer.
+func (rpc *RPC) messageHops(i int) uint32 {
+	if i < len(rpc.Hops) {
+		return rpc.Hops[i]
+	}
+	return 0
+}
+
+// hopsField returns an RPC with just the hop counts, for encoding the hop counts field on its
+// own; it returns nil if there are no hop counts.
+func (rpc *RPC) hopsField() *pb.RPC {
+	if len(rpc.Hops) == 0 {
+		return nil
+	}
+	return &pb.RPC{Hops: rpc.Hops}
+}
+
+// encodedMessage returns the cached encoding of the i-th message, or nil if there is none.
+func (rpc *RPC) encodedMessage(i int) []byte {
+	if i == 0 {
+		return rpc.encoded0
+	}
+	if i-1 < len(rpc.encoded) {
+		return rpc.encoded[i-1]
+	}
+	return nil
+}
+
+// messageSize returns the encoded size of the i-th message.
+func (rpc *RPC) messageSize(i int) int {
+	if enc := rpc.encodedMessage(i); enc != nil {
+		return len(enc)
+	}
+	return rpc.Publish[i].Size()
+}
+
+// size returns the encoded size of the RPC, using the cached message encodings.
+func (rpc *RPC) size() int {
+	n := 0
+	for _, sub := range rpc.Subscriptions {
+		l := sub.Size()
+		n += 1 + sovRPC(l) + l
+	}
+	for i := range rpc.Publish {
+		l := rpc.messageSize(i)
+		n += 1 + sovRPC(l) + l
+	}
+	if rpc.Control != nil {
+		l := rpc.Control.Size()
+		n += 1 + sovRPC(l) + l
+	}
+	if h := rpc.hopsField(); h != nil {
+		n += h.Size()
+	}
+	n += len(rpc.XXX_unrecognized)
+	return n
+}
+
+// marshalTo encodes the RPC into buf, which must be at least size() bytes, splicing in the
+// cached message encodings.
+func (rpc *RPC) marshalTo(buf []byte) (int, error) {
+	i := 0
+	for _, sub := range rpc.Subscriptions {
+		buf[i] = rpcSubscriptionsTag
+		i++
+		i += binary.PutUvarint(buf[i:], uint64(sub.Size()))
+		n, err := sub.MarshalTo(buf[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+
+	for j, m := range rpc.Publish {
+		buf[i] = rpcPublishTag
+		i++
+		i += binary.PutUvarint(buf[i:], uint64(rpc.messageSize(j)))
+		if enc := rpc.encodedMessage(j); enc != nil {
+			i += copy(buf[i:], enc)
+			continue
+		}
+		n, err := m.MarshalTo(buf[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+
+	if rpc.Control != nil {
+		buf[i] = rpcControlTag
+		i++
+		i += binary.PutUvarint(buf[i:], uint64(rpc.Control.Size()))
+		n, err := rpc.Control.MarshalTo(buf[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+
+	if h := rpc.hopsField(); h != nil {
+		n, err := h.MarshalTo(buf[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+
+	i += copy(buf[i:], rpc.XXX_unrecognized)
+	return i, nil
+}
+
+// writeTo writes the encoding of the RPC to w, writing the cached message encodings directly
+// and encoding the rest of the RPC in buf.
+func (rpc *RPC) writeTo(w io.Writer, buf *frameBuffer) error {
+	var err error
+
+	b := (*buf)[:0]
+	for _, sub := range rpc.Subscriptions {
+		b, err = appendField(b, rpcSubscriptionsTag, sub.Size(), sub)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, m := range rpc.Publish {
+		enc := rpc.encodedMessage(i)
+		if enc == nil {
+			b, err = appendField(b, rpcPublishTag, m.Size(), m)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		b = appendFieldHeader(b, rpcPublishTag, len(enc))
+		_, err = w.Write(b)
+		if err != nil {
+			return err
+		}
+		b = b[:0]
+
+		_, err = w.Write(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rpc.Control != nil {
+		b, err = appendField(b, rpcControlTag, rpc.Control.Size(), rpc.Control)
+		if err != nil {
+			return err
+		}
+	}
+
+	if h := rpc.hopsField(); h != nil {
+		b, err = appendMarshal(b, h.Size(), h)
+		if err != nil {
+			return err
+		}
+	}
+
+	b = append(b, rpc.XXX_unrecognized...)
+	*buf = b[:0]
+
+	_, err = w.Write(b)
+	return err
+}
+
+type marshaler interface {
+	Size() int
+	MarshalTo([]byte) (int, error)
+}
+
+func appendFieldHeader(b []byte, tag byte, l int) []byte {
+	var lbuf [binary.MaxVarintLen64]byte
+	b = append(b, tag)
+	return append(b, lbuf[:binary.PutUvarint(lbuf[:], uint64(l))]...)
+}
+
+// appendField appends a length-delimited field with the encoding of m, whose size is l.
+func appendField(b []byte, tag byte, l int, m marshaler) ([]byte, error) {
+	return appendMarshal(appendFieldHeader(b, tag, l), l, m)
+}
+
+// appendMarshal appends the encoding of m, whose size is l.
+func appendMarshal(b []byte, l int, m marshaler) ([]byte, error) {
+	off := len(b)
+	if cap(b)-off < l {
+		nb := make([]byte, off, 2*cap(b)+l)
+		copy(nb, b)
+		b = nb
+	}
+	b = b[:off+l]
+
+	_, err := m.MarshalTo(b[off:])
+	return b, err
+}
+
+// rpcFrame is the proto.Message written for an RPC by the peer writer; it implements the
+// sizer and marshaler interfaces used by the writers, so that the cached message encodings
+// are spliced into the frame rather than re-encoding the messages.
+type rpcFrame struct {
+	rpc *RPC
+}
+
+func (f rpcFrame) Reset()         {}
+func (f rpcFrame) String() string { return f.rpc.RPC.String() }
+func (f rpcFrame) ProtoMessage()  {}
+
+func (f rpcFrame) Size() int {
+	return f.rpc.size()
+}
+
+func (f rpcFrame) MarshalTo(buf []byte) (int, error) {
+	return f.rpc.marshalTo(buf)
+}
+
+func (f rpcFrame) Marshal() ([]byte, error) {
+	buf := make([]byte, f.rpc.size())
+	n, err := f.rpc.marshalTo(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// frameBuffer is a reusable buffer for encoding outgoing frames.
+type frameBuffer []byte
+
+// marshal encodes msg, reusing the buffer if msg supports it.
+func (b *frameBuffer) marshal(msg proto.Message) ([]byte, error) {
+	m, ok := msg.(marshaler)
+	if !ok {
+		return proto.Marshal(msg)
+	}
+
+	n := m.Size()
+	if cap(*b) < n {
+		*b = make([]byte, n)
+	}
+
+	n, err := m.MarshalTo((*b)[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	return (*b)[:n], nil
+}
+
+// delimitedWriter writes uvarint length-delimited protobuf frames, like the gogo delimited
+// writer, but reuses its encoding buffer across frames and writes the cached message
+// encodings of RPC frames directly.
+type delimitedWriter struct {
+	w   io.Writer
+	raw frameBuffer
+	len [binary.MaxVarintLen64]byte
+}
+
+func newDelimitedWriter(w io.Writer) *delimitedWriter {
+	return &delimitedWriter{w: w}
+}
+
+func (w *delimitedWriter) WriteMsg(msg proto.Message) error {
+	if f, ok := msg.(rpcFrame); ok {
+		n := binary.PutUvarint(w.len[:], uint64(f.rpc.size()))
+		_, err := w.w.Write(w.len[:n])
+		if err != nil {
+			return err
+		}
+
+		return f.rpc.writeTo(w.w, &w.raw)
+	}
+
+	data, err := w.raw.marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	n := binary.PutUvarint(w.len[:], uint64(len(data)))
+	_, err = w.w.Write(w.len[:n])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(data)
+	return err
+}
+
+// skipField returns the length of the field at the start of data, including its key, or 0 if
+// the field is malformed.
+func skipField(data []byte) int {
+	key, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0
+	}
+
+	switch key & 7 {
+	case 0:
+		_, l := binary.Uvarint(data[n:])
+		if l <= 0 {
+			return 0
+		}
+		n += l
+	case 1:
+		n += 8
+	case 2:
+		size, l := binary.Uvarint(data[n:])
+		if l <= 0 || size > uint64(len(data)) {
+			return 0
+		}
+		n += l + int(size)
+	case 5:
+		n += 4
+	default:
+		return 0
+	}
+
+	if n > len(data) {
+		return 0
+	}
+	return n
+}
+
+// rpcReader reads RPC frames; ReadRPC keeps the wire encodings of the published messages, so
+// that they can be forwarded without being encoded again.
+type rpcReader interface {
+	ggio.Reader
+	ReadRPC(*RPC) error
+}
+
+// delimitedReader reads uvarint length-delimited protobuf frames, like the gogo delimited
+// reader; RPC frames are read in a buffer of their own, which is retained by the encodings.
+type delimitedReader struct {
+	r       *bufio.Reader
+	maxSize int
+	buf     []byte
+}
+
+func newDelimitedReader(r io.Reader, maxSize int) *delimitedReader {
+	return &delimitedReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// readFrame reads a frame into buf, or a new buffer if buf is too small.
+func (r *delimitedReader) readFrame(buf []byte) ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > uint64(r.maxSize) {
+		return nil, io.ErrShortBuffer
+	}
+
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+
+	_, err = io.ReadFull(r.r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (r *delimitedReader) ReadMsg(msg proto.Message) error {
+	buf, err := r.readFrame(r.buf)
+	if err != nil {
+		return err
+	}
+	r.buf = buf
+
+	return proto.Unmarshal(buf, msg)
+}
+
+func (r *delimitedReader) ReadRPC(rpc *RPC) error {
+	buf, err := r.readFrame(nil)
+	if err != nil {
+		return err
+	}
+
+	return rpc.unmarshal(buf)
+}
@@ -0,0 +1,308 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	ggio "github.com/gogo/protobuf/io"
+)
+
+func makeForwardMessage(i, size int) *Message {
+	return &Message{
+		Message: &pb.Message{
+			From:      make([]byte, 38),
+			Data:      make([]byte, size),
+			Signature: make([]byte, 64),
+			Key:       make([]byte, 36),
+			Seqno:     []byte(fmt.Sprintf("seqno-%d", i)),
+			TopicIDs:  []string{"test"},
+		},
+	}
+}
+
+func checkRPCEncoding(t *testing.T, rpc *RPC) {
+	t.Helper()
+
+	expected, err := rpc.RPC.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rpc.size() != len(expected) {
+		t.Fatalf("expected size %d, got %d", len(expected), rpc.size())
+	}
+
+	enc, err := rpcFrame{rpc}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(enc, expected) {
+		t.Fatal("spliced encoding differs from the protobuf encoding")
+	}
+}
+
+func TestRPCEncoding(t *testing.T) {
+	// a mix of messages with and without cached encodings and hop counts
+	rpc := new(RPC)
+	hops := make(map[string]uint32)
+	for i := 0; i < 6; i++ {
+		msg := makeForwardMessage(i, 100*i)
+		var enc []byte
+		if i%3 != 0 {
+			enc, _ = msg.Marshal()
+		}
+		hops[string(msg.Seqno)] = uint32(i % 2)
+		rpc.appendMessage(msg.Message, enc, uint32(i%2))
+	}
+
+	topic := "test"
+	subscribe := true
+	rpc.Subscriptions = []*pb.RPC_SubOpts{{Subscribe: &subscribe, Topicid: &topic}}
+	rpc.Control = &pb.ControlMessage{
+		Ihave: []*pb.ControlIHave{{TopicID: &topic, MessageIDs: []string{"a", "b"}}},
+	}
+
+	checkRPCEncoding(t, rpc)
+
+	checkHops := func(rpc *RPC) {
+		t.Helper()
+		for i, m := range rpc.Publish {
+			if rpc.messageHops(i) != hops[string(m.Seqno)] {
+				t.Fatalf("expected hop count %d for message %d, got %d", hops[string(m.Seqno)], i, rpc.messageHops(i))
+			}
+		}
+	}
+
+	// the encodings and hop counts are carried over when merging
+	merged := new(RPC)
+	merged.appendMessage(makeForwardMessage(6, 10).Message, nil, 0)
+	merged = mergeRPC(merged, rpc)
+	for i := range rpc.Publish {
+		if !bytes.Equal(merged.encodedMessage(i+1), rpc.encodedMessage(i)) {
+			t.Fatalf("expected the encoding of message %d to be carried over", i)
+		}
+	}
+	checkRPCEncoding(t, merged)
+	checkHops(merged)
+
+	// and when splitting
+	p := &PubSub{maxMessageSize: 600}
+	frames := p.splitRPC(merged)
+	if len(frames) < 2 {
+		t.Fatalf("expected RPC to be split, got %d frames", len(frames))
+	}
+	for _, frame := range frames {
+		if frame.size() > p.maxMessageSize {
+			t.Fatalf("frame exceeds max message size: %d", frame.size())
+		}
+		checkRPCEncoding(t, frame)
+		checkHops(frame)
+	}
+
+	// the delimited writer splices the cached encodings into the same frames as the gogo writer
+	var expected, buf bytes.Buffer
+	if err := ggio.NewDelimitedWriter(&expected).WriteMsg(&rpc.RPC); err != nil {
+		t.Fatal(err)
+	}
+	dw := newDelimitedWriter(&buf)
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		if err := dw.WriteMsg(rpcFrame{rpc}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+			t.Fatal("delimited writer frame differs from the protobuf encoding")
+		}
+	}
+
+	// the compressed writer produces the same frames
+	buf.Reset()
+	w := newCompressedWriter(&buf, SnappyCompression{})
+	if err := w.WriteMsg(rpcFrame{rpc}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out pb.RPC
+	r := newCompressedReader(&buf, SnappyCompression{}, 1<<20)
+	if err := r.ReadMsg(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Size() != rpc.size() || len(out.Publish) != len(rpc.Publish) {
+		t.Fatal("decoded RPC differs from the written RPC")
+	}
+}
+
+func TestReadRPC(t *testing.T) {
+	rpc := new(RPC)
+	for i := 0; i < 3; i++ {
+		rpc.appendMessage(makeForwardMessage(i, 100*i).Message, nil, uint32(i))
+	}
+	topic := "test"
+	subscribe := true
+	rpc.Subscriptions = []*pb.RPC_SubOpts{{Subscribe: &subscribe, Topicid: &topic}}
+	rpc.Control = &pb.ControlMessage{
+		Ihave: []*pb.ControlIHave{{TopicID: &topic, MessageIDs: []string{"a", "b"}}},
+	}
+
+	// the readers keep the wire encodings of the messages, for both framings
+	for _, c := range []struct {
+		w func(io.Writer) ggio.Writer
+		r func(io.Reader) rpcReader
+	}{
+		{
+			func(w io.Writer) ggio.Writer { return newDelimitedWriter(w) },
+			func(r io.Reader) rpcReader { return newDelimitedReader(r, 1<<20) },
+		},
+		{
+			func(w io.Writer) ggio.Writer { return newCompressedWriter(w, SnappyCompression{}) },
+			func(r io.Reader) rpcReader { return newCompressedReader(r, SnappyCompression{}, 1<<20) },
+		},
+	} {
+		var buf bytes.Buffer
+		w := c.w(&buf)
+		for i := 0; i < 2; i++ {
+			if err := w.WriteMsg(rpcFrame{rpc}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := c.r(&buf)
+		var out RPC
+		if err := r.ReadRPC(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out.Publish) != len(rpc.Publish) || len(out.Subscriptions) != 1 || len(out.GetControl().GetIhave()) != 1 {
+			t.Fatal("decoded RPC differs from the written RPC")
+		}
+		for i, m := range out.Publish {
+			expected, err := m.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.encodedMessage(i), expected) {
+				t.Fatalf("expected the wire encoding of message %d", i)
+			}
+			if out.messageHops(i) != uint32(i) {
+				t.Fatalf("expected hop count %d for message %d, got %d", i, i, out.messageHops(i))
+			}
+		}
+
+		// the next frame is read in a buffer of its own, leaving the encodings intact
+		first := append([]byte(nil), out.encodedMessage(0)...)
+		var next pb.RPC
+		if err := r.ReadMsg(&next); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.encodedMessage(0), first) {
+			t.Fatal("expected the encodings to survive reading the next frame")
+		}
+	}
+}
+
+// benchmarkForward simulates receiving a message and forwarding it to D peers; as in the
+// routers, the RPC is shared by the peers and encoded by the writer of each peer. When cached,
+// the message is forwarded with the encoding it was received with.
+func benchmarkForward(b *testing.B, cached bool, newWriter func() ggio.Writer) {
+	const D = 8
+
+	writers := make([]ggio.Writer, D)
+	for i := range writers {
+		writers[i] = newWriter()
+	}
+
+	in := new(RPC)
+	in.appendMessage(makeForwardMessage(0, 1024).Message, nil, 0)
+	frame, err := rpcFrame{in}.Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// the reader reads every frame in a buffer of its own
+		data := append([]byte(nil), frame...)
+
+		rpc := new(RPC)
+		var out *RPC
+		if cached {
+			if err := rpc.unmarshal(data); err != nil {
+				b.Fatal(err)
+			}
+			out = new(RPC)
+			out.appendMessage(rpc.Publish[0], rpc.encodedMessage(0), 0)
+		} else {
+			if err := rpc.RPC.Unmarshal(data); err != nil {
+				b.Fatal(err)
+			}
+			out = rpcWithMessages(rpc.Publish[0])
+		}
+
+		for _, w := range writers {
+			if err := w.WriteMsg(rpcFrame{out}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkForward(b *testing.B) {
+	// the writers write to a buffered writer, as in the peer writer
+	delimited := func() ggio.Writer { return newDelimitedWriter(bufio.NewWriter(ioutil.Discard)) }
+	compressed := func() ggio.Writer {
+		return newCompressedWriter(bufio.NewWriter(ioutil.Discard), SnappyCompression{})
+	}
+
+	b.Run("Uncached", func(b *testing.B) { benchmarkForward(b, false, delimited) })
+	b.Run("Cached", func(b *testing.B) { benchmarkForward(b, true, delimited) })
+	b.Run("UncachedCompressed", func(b *testing.B) { benchmarkForward(b, false, compressed) })
+	b.Run("CachedCompressed", func(b *testing.B) { benchmarkForward(b, true, compressed) })
+}
+
+func TestEncodingCache(t *testing.T) {
+	p := &PubSub{msgID: DefaultMsgIdFn, encodings: newEncodingCache(100 * time.Millisecond)}
+
+	msg := makeForwardMessage(0, 100)
+	enc, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.encodings.Add(p.msgID(msg.Message), enc)
+	out := p.rpcWithMessage(msg)
+	if out.encodedMessage(0) == nil {
+		t.Fatal("expected the cached encoding")
+	}
+	checkRPCEncoding(t, out)
+
+	// other messages don't get the cached encoding
+	if p.rpcWithMessage(makeForwardMessage(1, 100)).encodedMessage(0) != nil {
+		t.Fatal("expected no cached encoding for another message")
+	}
+
+	// the first encoding of a message is kept
+	p.encodings.Add(p.msgID(msg.Message), []byte("other"))
+	if !bytes.Equal(p.encodings.Get(p.msgID(msg.Message)), enc) {
+		t.Fatal("expected the first encoding to be kept")
+	}
+
+	// and expires with the TTL, swept by later additions
+	time.Sleep(150 * time.Millisecond)
+	p.encodings.Add("other", enc)
+	if p.encodings.Get(p.msgID(msg.Message)) != nil {
+		t.Fatal("expected the encoding to expire")
+	}
+	if len(p.encodings.entries) != 1 || p.encodings.queue.Len() != 1 {
+		t.Fatal("expected the expired encoding to be swept")
+	}
+}
@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// rpcPriority is the priority of an outbound RPC, which selects its lane in the peer
+// outbound queue.
+type rpcPriority int
+
+const (
+	// rpcPriorityControl is the lane for subscriptions and mesh maintenance (GRAFT/PRUNE).
+	rpcPriorityControl rpcPriority = iota
+	// rpcPriorityPublish is the lane for messages we publish.
+	rpcPriorityPublish
+	// rpcPriorityForward is the lane for messages we forward.
+	rpcPriorityForward
+	// rpcPriorityGossip is the lane for gossip (IHAVE/IWANT) and IWANT responses.
+	rpcPriorityGossip
+
+	numRPCPriorities
+)
+
+// messagePriority returns the outbound priority for a message: messages we publish take
+// precedence over messages we forward.
+func (p *PubSub) messagePriority(msg *Message) rpcPriority {
+	if msg.ReceivedFrom == p.host.ID() {
+		return rpcPriorityPublish
+	}
+	return rpcPriorityForward
+}
+
+// rpcDrainSchedule is the weighted round robin schedule for draining the payload lanes;
+// the control lane is always drained first, so that control traffic is never delayed or
+// dropped due to payload congestion.
+var rpcDrainSchedule = []rpcPriority{
+	rpcPriorityPublish, rpcPriorityForward, rpcPriorityPublish, rpcPriorityForward,
+	rpcPriorityPublish, rpcPriorityGossip,
+}
+
+// rpcEntry is an RPC in the outbound queue.
+type rpcEntry struct {
+	rpc    *RPC
+	prio   rpcPriority
+	queued time.Time
+}
+
+// rpcQueue is the outbound queue for a peer, with a bounded lane per priority.
+// Pushing and closing must happen in the event loop, while the peer writer pops.
+type rpcQueue struct {
+	// moving average of the queue delay in nanoseconds, including outbound shaping;
+	// updated by the writer and read atomically.
+	// NOTE: Must be declared at the top of the struct as we perform atomic
+	// operations on this field.
+	delay int64
+
+	lanes [numRPCPriorities]chan rpcEntry
+	// position in the drain schedule
+	next int
+}
+
+func newRPCQueue(size int) *rpcQueue {
+	q := &rpcQueue{}
+	for i := range q.lanes {
+		q.lanes[i] = make(chan rpcEntry, size)
+	}
+	return q
+}
+
+// Push enqueues an RPC in the lane for prio, returning false if the lane is full.
+func (q *rpcQueue) Push(rpc *RPC, prio rpcPriority) bool {
+	select {
+	case q.lanes[prio] <- rpcEntry{rpc: rpc, prio: prio, queued: time.Now()}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the queue; the writer drains the queued RPCs before it is notified.
+func (q *rpcQueue) Close() {
+	for _, lane := range q.lanes {
+		close(lane)
+	}
+}
+
+// Delay returns the moving average of the time RPCs spend in the queue before being written.
+func (q *rpcQueue) Delay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&q.delay))
+}
+
+// observeDelay updates the queue delay average; it is only called by the writer.
+func (q *rpcQueue) observeDelay(d time.Duration) {
+	delay := atomic.LoadInt64(&q.delay)
+	atomic.StoreInt64(&q.delay, delay+(int64(d)-delay)/8)
+}
+
+// Pop dequeues the next RPC to send, blocking until one is available; it returns false when
+// the queue has been closed and drained or the context is done.
+func (q *rpcQueue) Pop(ctx context.Context) (rpcEntry, bool) {
+	for {
+		e, ok, closed := q.tryPop()
+		if ok {
+			return e, true
+		}
+		if closed {
+			return rpcEntry{}, false
+		}
+
+		select {
+		case e, ok := <-q.lanes[rpcPriorityControl]:
+			if ok {
+				return e, true
+			}
+		case e, ok := <-q.lanes[rpcPriorityPublish]:
+			if ok {
+				return e, true
+			}
+		case e, ok := <-q.lanes[rpcPriorityForward]:
+			if ok {
+				return e, true
+			}
+		case e, ok := <-q.lanes[rpcPriorityGossip]:
+			if ok {
+				return e, true
+			}
+		case <-ctx.Done():
+			return rpcEntry{}, false
+		}
+	}
+}
+
+// tryPop dequeues the next RPC according to the drain schedule without blocking; closed is
+// true if all lanes have been closed and drained.
+func (q *rpcQueue) tryPop() (e rpcEntry, ok bool, closed bool) {
+	closed = true
+
+	select {
+	case e, ok := <-q.lanes[rpcPriorityControl]:
+		if ok {
+			return e, true, false
+		}
+	default:
+		closed = false
+	}
+
+	for i := 0; i < len(rpcDrainSchedule); i++ {
+		pos := (q.next + i) % len(rpcDrainSchedule)
+		select {
+		case e, ok := <-q.lanes[rpcDrainSchedule[pos]]:
+			if ok {
+				q.next = pos + 1
+				return e, true, false
+			}
+		default:
+			closed = false
+		}
+	}
+
+	return rpcEntry{}, false, closed
+}
@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRPCQueuePriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newRPCQueue(8)
+
+	rpcs := make(map[*RPC]rpcPriority)
+	for prio := rpcPriorityGossip; prio >= rpcPriorityControl; prio-- {
+		for i := 0; i < 8; i++ {
+			rpc := new(RPC)
+			rpcs[rpc] = prio
+			if !q.Push(rpc, prio) {
+				t.Fatal("failed to push RPC")
+			}
+		}
+	}
+
+	// payload congestion doesn't affect the control lane
+	if q.Push(new(RPC), rpcPriorityForward) {
+		t.Fatal("expected full lane to reject RPC")
+	}
+
+	// control is drained first
+	for i := 0; i < 8; i++ {
+		e, ok := q.Pop(ctx)
+		if !ok || rpcs[e.rpc] != rpcPriorityControl {
+			t.Fatalf("expected control RPC, got %v", rpcs[e.rpc])
+		}
+	}
+
+	// and the payload lanes are drained in weighted round robin
+	counts := make(map[rpcPriority]int)
+	for i := 0; i < 12; i++ {
+		e, ok := q.Pop(ctx)
+		if !ok {
+			t.Fatal("expected RPC")
+		}
+		counts[rpcs[e.rpc]]++
+
+		if i == 5 {
+			// a newly queued control RPC goes first
+			ctl := new(RPC)
+			q.Push(ctl, rpcPriorityControl)
+			e, _ := q.Pop(ctx)
+			if e.rpc != ctl {
+				t.Fatal("expected control RPC")
+			}
+		}
+	}
+
+	if counts[rpcPriorityPublish] != 6 || counts[rpcPriorityForward] != 4 || counts[rpcPriorityGossip] != 2 {
+		t.Fatalf("unexpected drain counts: %v", counts)
+	}
+}
+
+func TestRPCQueueClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newRPCQueue(8)
+	q.Push(new(RPC), rpcPriorityGossip)
+	q.Push(new(RPC), rpcPriorityPublish)
+	q.Close()
+
+	// queued RPCs are drained before the writer is notified
+	for i := 0; i < 2; i++ {
+		if _, ok := q.Pop(ctx); !ok {
+			t.Fatal("expected queued RPC")
+		}
+	}
+	if _, ok := q.Pop(ctx); ok {
+		t.Fatal("expected closed queue")
+	}
+
+	// and Pop blocks until an RPC is queued or the context is done
+	q = newRPCQueue(8)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(new(RPC), rpcPriorityForward)
+	}()
+	if _, ok := q.Pop(ctx); !ok {
+		t.Fatal("expected RPC")
+	}
+
+	cancel()
+	if _, ok := q.Pop(ctx); ok {
+		t.Fatal("expected Pop to return when the context is done")
+	}
+}
@@ -26,6 +26,9 @@ type peerStats struct {
 
 	// IP tracking; store as string for easy processing
 	ips []string
+
+	// behavioural pattern penalties (applied by the router)
+	behaviourPenalty float64
 }
 
 type topicStats struct {
@@ -83,6 +86,9 @@ var _ scoreTracer = (*peerScore)(nil)
 type messageDeliveries struct {
 	records map[string]*deliveryRecord
 
+	// how long to keep delivery records; this matches the seen messages TTL
+	ttl time.Duration
+
 	// queue for cleaning up old delivery records
 	head *deliveryEntry
 	tail *deliveryEntry
@@ -138,7 +144,7 @@ func newPeerScore(params *PeerScoreParams) *peerScore {
 		params:     params,
 		peerStats:  make(map[peer.ID]*peerStats),
 		peerIPs:    make(map[string]map[peer.ID]struct{}),
-		deliveries: &messageDeliveries{records: make(map[string]*deliveryRecord)},
+		deliveries: &messageDeliveries{records: make(map[string]*deliveryRecord), ttl: TimeCacheDuration},
 		msgID:      DefaultMsgIdFn,
 	}
 }
@@ -151,6 +157,7 @@ func (ps *peerScore) Start(gs *GossipSubRouter) {
 
 	ps.msgID = gs.p.msgID
 	ps.host = gs.p.host
+	ps.deliveries.ttl = gs.p.seenMsgTTL
 	go ps.background(gs.p.ctx)
 }
 
@@ -249,6 +256,14 @@ func (ps *peerScore) score(p peer.ID) float64 {
 		}
 	}
 
+	// P7: behavioural pattern penalty
+	// NOTE: the weight of P7 is negative (validated in PeerScoreParams.validate), so this detracts.
+	if pstats.behaviourPenalty > ps.params.BehaviourPenaltyThreshold {
+		excess := pstats.behaviourPenalty - ps.params.BehaviourPenaltyThreshold
+		p7 := excess * excess
+		score += p7 * ps.params.BehaviourPenaltyWeight
+	}
+
 	return score
 }
 
@@ -364,6 +379,12 @@ func (ps *peerScore) refreshScores() {
 				}
 			}
 		}
+
+		// decay P7 counter
+		pstats.behaviourPenalty *= ps.params.BehaviourPenaltyDecay
+		if pstats.behaviourPenalty < ps.params.DecayToZero {
+			pstats.behaviourPenalty = 0
+		}
 	}
 }
 
@@ -394,6 +415,23 @@ func (ps *peerScore) gcDeliveryRecords() {
 	ps.deliveries.gc()
 }
 
+// AddPenalty adds a behavioural penalty of count to peer p.
+func (ps *peerScore) AddPenalty(p peer.ID, count int) {
+	if ps == nil {
+		return
+	}
+
+	ps.Lock()
+	defer ps.Unlock()
+
+	pstats, ok := ps.peerStats[p]
+	if !ok {
+		return
+	}
+
+	pstats.behaviourPenalty += float64(count)
+}
+
 // tracer interface
 func (ps *peerScore) AddPeer(p peer.ID, proto protocol.ID) {
 	ps.Lock()
@@ -532,6 +570,8 @@ func (ps *peerScore) RejectMessage(msg *Message, reason string) {
 		fallthrough
 	case rejectInvalidSignature:
 		fallthrough
+	case rejectHopLimitExceeded:
+		fallthrough
 	case rejectSelfOrigin:
 		ps.markInvalidMessageDelivery(msg.ReceivedFrom, msg)
 		return
@@ -551,9 +591,11 @@ func (ps *peerScore) RejectMessage(msg *Message, reason string) {
 
 	drec := ps.deliveries.getRecord(ps.msgID(msg.Message))
 
-	if reason == rejectValidationThrottled {
+	if reason == rejectValidationThrottled || reason == rejectMessageExpired || reason == rejectReplayedSeqno {
 		// if we reject with "validation throttled" we don't penalize the peer(s) that forward it
 		// because we don't know if it was valid.
+		// similarly, we don't penalize peers for expired messages, as clocks may be skewed, nor
+		// for replayed messages, as honest peers relay replays by the author.
 		drec.status = deliveryThrottled
 		// release the delivery time tracking map to free some memory early
 		drec.peers = nil
@@ -612,7 +654,7 @@ func (d *messageDeliveries) getRecord(id string) *deliveryRecord {
 	rec = &deliveryRecord{peers: make(map[peer.ID]struct{})}
 	d.records[id] = rec
 
-	entry := &deliveryEntry{id: id, expire: time.Now().Add(TimeCacheDuration)}
+	entry := &deliveryEntry{id: id, expire: time.Now().Add(d.ttl)}
 	if d.tail != nil {
 		d.tail.next = entry
 		d.tail = entry
@@ -72,6 +72,16 @@ type PeerScoreParams struct {
 	IPColocationFactorThreshold int
 	IPColocationFactorWhitelist map[string]struct{}
 
+	// P7: behavioural pattern penalties.
+	// This parameter has an associated counter which tracks misbehaviour as detected by the
+	// router. The router currently applies penalties for peers that don't follow up on IWANT
+	// requests solicited by their IHAVE advertisements within the IWANT followup time.
+	// The counter decays with BehaviourPenaltyDecay.
+	// If the counter exceeds BehaviourPenaltyThreshold, the value is the square of the excess,
+	// ie (counter - BehaviourPenaltyThreshold)^2; otherwise the value is 0.
+	// The weight of the parameter MUST be negative (or zero to disable).
+	BehaviourPenaltyWeight, BehaviourPenaltyThreshold, BehaviourPenaltyDecay float64
+
 	// the decay interval for parameter counters.
 	DecayInterval time.Duration
 
@@ -160,6 +170,17 @@ func (p *PeerScoreParams) validate() error {
 		return fmt.Errorf("invalid IPColocationFactorThreshold; must be at least 1")
 	}
 
+	// check the behaviour penalty
+	if p.BehaviourPenaltyWeight > 0 {
+		return fmt.Errorf("invalid BehaviourPenaltyWeight; must be negative (or 0 to disable)")
+	}
+	if p.BehaviourPenaltyWeight != 0 && (p.BehaviourPenaltyDecay <= 0 || p.BehaviourPenaltyDecay >= 1) {
+		return fmt.Errorf("invalid BehaviourPenaltyDecay; must be between 0 and 1")
+	}
+	if p.BehaviourPenaltyThreshold < 0 {
+		return fmt.Errorf("invalid BehaviourPenaltyThreshold; must be >= 0")
+	}
+
 	// check the decay parameters
 	if p.DecayInterval < time.Second {
 		return fmt.Errorf("invalid DecayInterval; must be at least 1s")
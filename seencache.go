@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+)
+
+// SeenMessagesCache is the interface for the cache of message IDs that PubSub uses to
+// detect duplicate messages.
+// The cache is always accessed with the PubSub seen messages lock held, so implementations
+// need not be safe for concurrent use.
+type SeenMessagesCache interface {
+	// Has returns whether the message ID is in the cache.
+	Has(id string) bool
+	// Add adds a message ID to the cache; it returns true if the ID was not already present.
+	Add(id string) bool
+}
+
+// SeenMessagesStrategy determines how entries expire from the built-in seen messages caches.
+type SeenMessagesStrategy int
+
+const (
+	// SeenMessagesFirstSeen expires entries a TTL after the message was first seen.
+	// This is the default strategy.
+	SeenMessagesFirstSeen SeenMessagesStrategy = iota
+	// SeenMessagesLastSeen expires entries a TTL after the message was last seen, so that
+	// messages that keep circulating in the network are not accepted again.
+	SeenMessagesLastSeen
+)
+
+// NewFirstSeenCache creates a seen messages cache that expires entries ttl after the message
+// was first seen.
+func NewFirstSeenCache(ttl time.Duration) SeenMessagesCache {
+	return newTimedSeenCache(ttl, false, 0)
+}
+
+// NewLastSeenCache creates a seen messages cache that expires entries ttl after the message
+// was last seen; every lookup of a cached ID extends its lifetime.
+func NewLastSeenCache(ttl time.Duration) SeenMessagesCache {
+	return newTimedSeenCache(ttl, true, 0)
+}
+
+// NewBoundedSeenCache creates a seen messages cache with the given expiry strategy that
+// holds at most capacity entries, evicting the entries closest to expiry when full.
+// This bounds the memory used by nodes that see very high message rates; the trade-off is
+// that an evicted message may be accepted (and validated) again if it is received after
+// eviction.
+func NewBoundedSeenCache(ttl time.Duration, strategy SeenMessagesStrategy, capacity int) (SeenMessagesCache, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("invalid seen messages cache capacity; must be positive")
+	}
+
+	switch strategy {
+	case SeenMessagesFirstSeen:
+		return newTimedSeenCache(ttl, false, capacity), nil
+	case SeenMessagesLastSeen:
+		return newTimedSeenCache(ttl, true, capacity), nil
+	default:
+		return nil, fmt.Errorf("unknown seen messages strategy %d", strategy)
+	}
+}
+
+// timedSeenCache is the implementation backing the built-in seen messages caches.
+// Entries are kept in a queue ordered by expiration time, which is the insertion
+// order for first-seen expiry and the access order for last-seen expiry; expired
+// entries are swept from the head of the queue on every access.
+type timedSeenCache struct {
+	ttl      time.Duration
+	sliding  bool
+	capacity int
+
+	queue   *list.List
+	entries map[string]*list.Element
+}
+
+type seenEntry struct {
+	id     string
+	expire time.Time
+}
+
+func newTimedSeenCache(ttl time.Duration, sliding bool, capacity int) *timedSeenCache {
+	return &timedSeenCache{
+		ttl:      ttl,
+		sliding:  sliding,
+		capacity: capacity,
+		queue:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *timedSeenCache) Has(id string) bool {
+	now := time.Now()
+	c.sweep(now)
+
+	e, ok := c.entries[id]
+	if !ok {
+		return false
+	}
+
+	if c.sliding {
+		c.refresh(e, now)
+	}
+
+	return true
+}
+
+func (c *timedSeenCache) Add(id string) bool {
+	now := time.Now()
+	c.sweep(now)
+
+	e, ok := c.entries[id]
+	if ok {
+		if c.sliding {
+			c.refresh(e, now)
+		}
+		return false
+	}
+
+	if c.capacity > 0 && len(c.entries) >= c.capacity {
+		c.remove(c.queue.Front())
+	}
+
+	c.entries[id] = c.queue.PushBack(&seenEntry{id: id, expire: now.Add(c.ttl)})
+	return true
+}
+
+func (c *timedSeenCache) refresh(e *list.Element, now time.Time) {
+	e.Value.(*seenEntry).expire = now.Add(c.ttl)
+	c.queue.MoveToBack(e)
+}
+
+func (c *timedSeenCache) sweep(now time.Time) {
+	for e := c.queue.Front(); e != nil; e = c.queue.Front() {
+		if now.Before(e.Value.(*seenEntry).expire) {
+			return
+		}
+		c.remove(e)
+	}
+}
+
+func (c *timedSeenCache) remove(e *list.Element) {
+	c.queue.Remove(e)
+	delete(c.entries, e.Value.(*seenEntry).id)
+}
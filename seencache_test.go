@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFirstSeenCache(t *testing.T) {
+	c := NewFirstSeenCache(100 * time.Millisecond)
+
+	if !c.Add("a") {
+		t.Fatal("expected fresh add")
+	}
+	if c.Add("a") {
+		t.Fatal("expected duplicate add to fail")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !c.Has("a") {
+		t.Fatal("expected entry to be in the cache")
+	}
+
+	// lookups do not extend the lifetime of the entry
+	time.Sleep(60 * time.Millisecond)
+	if c.Has("a") {
+		t.Fatal("expected entry to have expired")
+	}
+}
+
+func TestLastSeenCache(t *testing.T) {
+	c := NewLastSeenCache(100 * time.Millisecond)
+
+	c.Add("a")
+	c.Add("b")
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		if !c.Has("a") {
+			t.Fatal("expected entry to be in the cache")
+		}
+	}
+
+	if c.Has("b") {
+		t.Fatal("expected entry to have expired")
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if c.Has("a") {
+		t.Fatal("expected entry to have expired")
+	}
+}
+
+func TestBoundedSeenCache(t *testing.T) {
+	_, err := NewBoundedSeenCache(time.Minute, SeenMessagesFirstSeen, 0)
+	if err == nil {
+		t.Fatal("expected error for zero capacity")
+	}
+
+	c, err := NewBoundedSeenCache(time.Minute, SeenMessagesLastSeen, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		c.Add(fmt.Sprintf("%d", i))
+	}
+
+	// touch the oldest entry so that it is not the next to be evicted
+	if !c.Has("0") {
+		t.Fatal("expected entry to be in the cache")
+	}
+
+	for i := 10; i < 15; i++ {
+		c.Add(fmt.Sprintf("%d", i))
+	}
+
+	if !c.Has("0") {
+		t.Fatal("expected entry to be in the cache")
+	}
+	for i := 1; i < 6; i++ {
+		if c.Has(fmt.Sprintf("%d", i)) {
+			t.Fatalf("expected entry %d to have been evicted", i)
+		}
+	}
+	for i := 6; i < 15; i++ {
+		if !c.Has(fmt.Sprintf("%d", i)) {
+			t.Fatalf("expected entry %d to be in the cache", i)
+		}
+	}
+}
+
+func TestSeenMessagesTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0],
+		WithSeenMessagesTTL(100*time.Millisecond),
+		WithSeenMessagesStrategy(SeenMessagesLastSeen))
+
+	if !ps.markSeen("a") {
+		t.Fatal("expected message to be freshly marked")
+	}
+	if !ps.seenMessage("a") {
+		t.Fatal("expected message to be seen")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if ps.seenMessage("a") {
+		t.Fatal("expected message to have expired")
+	}
+}
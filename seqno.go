@@ -0,0 +1,253 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// DefaultSeqnoStoreLease is the default number of sequence numbers reserved ahead of use
+	// every time the high-water mark is persisted. After a restart, the counter resumes from
+	// the end of the last reserved lease.
+	DefaultSeqnoStoreLease uint64 = 1 << 20
+
+	// DefaultSeqnoStoreInterval is the default interval for extending the lease ahead of time.
+	DefaultSeqnoStoreInterval = 10 * time.Second
+)
+
+// SeqnoStore is an interface for persisting the sequence number high-water mark of message
+// authors, so that sequence numbers remain strictly monotonic across restarts.
+type SeqnoStore interface {
+	// Load returns the persisted high-water mark for the author, or 0 if there is none.
+	Load(author peer.ID) (uint64, error)
+	// Store persists the high-water mark for the author.
+	Store(author peer.ID, seqno uint64) error
+}
+
+// SeqnoStoreOpt is an option for the sequence number persistence; see WithSeqnoStore.
+type SeqnoStoreOpt func(*seqnoTracker) error
+
+// WithSeqnoStoreLease sets the number of sequence numbers reserved ahead of use every time the
+// high-water mark is persisted; the default is DefaultSeqnoStoreLease.
+func WithSeqnoStoreLease(lease uint64) SeqnoStoreOpt {
+	return func(s *seqnoTracker) error {
+		if lease == 0 {
+			return fmt.Errorf("sequence number lease must be positive")
+		}
+		s.lease = lease
+		return nil
+	}
+}
+
+// WithSeqnoStoreInterval sets the interval for extending the lease ahead of time; the default
+// is DefaultSeqnoStoreInterval.
+func WithSeqnoStoreInterval(interval time.Duration) SeqnoStoreOpt {
+	return func(s *seqnoTracker) error {
+		if interval <= 0 {
+			return fmt.Errorf("sequence number store interval must be positive")
+		}
+		s.interval = interval
+		return nil
+	}
+}
+
+// WithSeqnoStore provides a store for persisting sequence numbers across restarts; by
+// default sequence numbers are seeded from the wall clock at startup.
+// The high-water mark is persisted for the default message author only. Messages published
+// with per-topic or per-publish authors draw from the same counter, so their sequence numbers
+// remain monotonic across restarts as long as the entry of the default author is kept.
+func WithSeqnoStore(store SeqnoStore, opts ...SeqnoStoreOpt) Option {
+	return func(p *PubSub) error {
+		s := &seqnoTracker{
+			store:    store,
+			lease:    DefaultSeqnoStoreLease,
+			interval: DefaultSeqnoStoreInterval,
+			done:     make(chan struct{}),
+		}
+
+		for _, opt := range opts {
+			err := opt(s)
+			if err != nil {
+				return err
+			}
+		}
+
+		p.seqnos = s
+		return nil
+	}
+}
+
+// seqnoTracker maintains a persisted lease of sequence numbers for the PubSub counter.
+// The persisted high-water mark is always ahead of any sequence number we have used;
+// publishing synchronously extends the lease when exhausted, while the background
+// loop extends it ahead of time.
+type seqnoTracker struct {
+	sync.Mutex
+
+	store    SeqnoStore
+	author   peer.ID
+	lease    uint64
+	interval time.Duration
+
+	// the persisted high-water mark
+	hwm uint64
+
+	// closed when the background loop has exited
+	done chan struct{}
+}
+
+// Start loads the persisted high-water mark for the author and returns the initial value
+// for the counter.
+func (s *seqnoTracker) Start(author peer.ID, counter uint64) (uint64, error) {
+	s.author = author
+
+	hwm, err := s.store.Load(author)
+	if err != nil {
+		return 0, fmt.Errorf("error loading sequence number for %s: %w", author, err)
+	}
+
+	if hwm > counter {
+		counter = hwm
+	}
+
+	err = s.reserve(counter)
+	if err != nil {
+		return 0, err
+	}
+
+	return counter, nil
+}
+
+// Advance is called with every sequence number before use, and extends the lease if it
+// has been exhausted. If the lease can't be extended, the sequence number must not be used,
+// as it may be reused after a restart.
+func (s *seqnoTracker) Advance(counter uint64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if counter < s.hwm {
+		return nil
+	}
+
+	err := s.reserve(counter)
+	if err != nil {
+		return fmt.Errorf("error persisting sequence number: %w", err)
+	}
+
+	return nil
+}
+
+// reserve persists a new lease starting at counter; the caller must hold the lock.
+func (s *seqnoTracker) reserve(counter uint64) error {
+	hwm := counter + s.lease
+	err := s.store.Store(s.author, hwm)
+	if err != nil {
+		return err
+	}
+
+	s.hwm = hwm
+	return nil
+}
+
+// background extends the lease when more than half of it has been used. The persisted
+// high-water mark is always ahead of the counter, so there is nothing to persist at shutdown.
+func (s *seqnoTracker) background(p *PubSub) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Advance(p.currentSeqno() + s.lease/2)
+			if err != nil {
+				log.Warningf("%s", err)
+			}
+
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// FileSeqnoStore is a SeqnoStore backed by a JSON file.
+type FileSeqnoStore struct {
+	sync.Mutex
+	path   string
+	seqnos map[string]uint64
+}
+
+var _ SeqnoStore = (*FileSeqnoStore)(nil)
+
+// NewFileSeqnoStore creates a new FileSeqnoStore persisting to the file at path; the file is
+// created on the first Store if it doesn't exist.
+func NewFileSeqnoStore(path string) (*FileSeqnoStore, error) {
+	s := &FileSeqnoStore{path: path, seqnos: make(map[string]uint64)}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &s.seqnos)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sequence number file %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *FileSeqnoStore) Load(author peer.ID) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.seqnos[author.Pretty()], nil
+}
+
+func (s *FileSeqnoStore) Store(author peer.ID, seqno uint64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seqnos[author.Pretty()] = seqno
+
+	data, err := json.Marshal(s.seqnos)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes to a temporary file and renames it to path, so that we never leave a
+// truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,219 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestFileSeqnoStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seqno")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "seqnos.json")
+	s, err := NewFileSeqnoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := peer.ID("test")
+	seqno, err := s.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqno != 0 {
+		t.Fatalf("expected no seqno, got %d", seqno)
+	}
+
+	err = s.Store(p, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileSeqnoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seqno, err = s.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqno != 1234 {
+		t.Fatalf("expected seqno 1234, got %d", seqno)
+	}
+}
+
+func TestSeqnoStoreRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "seqno")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "seqnos.json")
+	store, err := NewFileSeqnoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := getNetHosts(t, ctx, 1)
+
+	// simulate a clock that has jumped backwards since the last run
+	future := uint64(time.Now().Add(time.Hour).UnixNano())
+	err = store.Store(hosts[0].ID(), future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	psctx, pscancel := context.WithCancel(ctx)
+	ps := getPubsub(psctx, hosts[0], WithSeqnoStore(store))
+
+	var last uint64
+	for i := 0; i < 10; i++ {
+		buf, err := ps.nextSeqno()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqno := binary.BigEndian.Uint64(buf)
+		if seqno <= future || seqno <= last {
+			t.Fatalf("seqno %d is not monotonic", seqno)
+		}
+		last = seqno
+	}
+
+	hwm, _ := store.Load(hosts[0].ID())
+	if hwm < last {
+		t.Fatalf("persisted high-water mark %d is behind the last seqno %d", hwm, last)
+	}
+
+	// shutdown leaves the persisted high-water mark alone
+	err = ps.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pscancel()
+
+	store, err = NewFileSeqnoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	persisted, _ := store.Load(hosts[0].ID())
+	if persisted != hwm {
+		t.Fatalf("expected persisted seqno %d, got %d", hwm, persisted)
+	}
+}
+
+type failingSeqnoStore struct {
+	sync.Mutex
+	fail  bool
+	seqno uint64
+}
+
+func (s *failingSeqnoStore) Load(author peer.ID) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.seqno, nil
+}
+
+func (s *failingSeqnoStore) Store(author peer.ID, seqno uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fail {
+		return fmt.Errorf("store failure")
+	}
+	s.seqno = seqno
+	return nil
+}
+
+func (s *failingSeqnoStore) setFail(fail bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.fail = fail
+}
+
+func TestSeqnoStoreFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+
+	store := &failingSeqnoStore{}
+	ps := getPubsub(ctx, hosts[0], WithSeqnoStore(store))
+
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// exhaust the lease, so that the next publish must persist a new one
+	store.Lock()
+	hwm := store.seqno
+	store.Unlock()
+	atomic.StoreUint64(&ps.counter, hwm-1)
+
+	store.setFail(true)
+	for i := 0; i < 3; i++ {
+		err = topic.Publish(ctx, []byte("hello"))
+		if err == nil {
+			t.Fatal("expected publish to fail without a persisted lease")
+		}
+	}
+
+	store.setFail(false)
+	err = topic.Publish(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Lock()
+	persisted := store.seqno
+	store.Unlock()
+	if persisted <= ps.currentSeqno() {
+		t.Fatalf("persisted high-water mark %d is not ahead of the counter %d", persisted, ps.currentSeqno())
+	}
+}
+
+func TestSeqnoStoreOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+
+	_, err := NewFloodSub(ctx, hosts[0], WithSeqnoStore(&failingSeqnoStore{}, WithSeqnoStoreLease(0)))
+	if err == nil {
+		t.Fatal("expected error for zero lease")
+	}
+	_, err = NewFloodSub(ctx, hosts[0], WithSeqnoStore(&failingSeqnoStore{}, WithSeqnoStoreInterval(0)))
+	if err == nil {
+		t.Fatal("expected error for zero interval")
+	}
+
+	// the lease is reserved ahead of the counter
+	store := &failingSeqnoStore{}
+	ps := getPubsub(ctx, hosts[0], WithSeqnoStore(store, WithSeqnoStoreLease(100), WithSeqnoStoreInterval(time.Hour)))
+
+	counter := atomic.LoadUint64(&ps.counter)
+	store.Lock()
+	hwm := store.seqno
+	store.Unlock()
+	if hwm != counter+100 {
+		t.Fatalf("expected high-water mark %d, got %d", counter+100, hwm)
+	}
+}
@@ -0,0 +1,166 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// OutboundShapingMaxDelay is the maximum time a payload RPC may be delayed in the outbound
+// queue when bandwidth shaping is enabled; RPCs that would exceed it are dropped by the
+// shaper rather than held back. Control RPCs are never dropped by the shaper.
+var OutboundShapingMaxDelay = 5 * time.Second
+
+// WithOutboundBandwidthLimit is an option to shape the outbound pubsub traffic with token
+// buckets, limiting the total rate to globalRate bytes per second and the rate to each peer
+// to peerRate bytes per second; a rate of 0 leaves the respective limit disabled.
+// The buckets allow bursts of up to one second worth of traffic.
+//
+// Shaped traffic is held in the peer outbound queues, whose delay is taken into account by the
+// gossipsub router when selecting peers. Payload RPCs that would be delayed beyond
+// OutboundShapingMaxDelay are dropped and traced as SHAPE_RPC events.
+func WithOutboundBandwidthLimit(globalRate, peerRate int) Option {
+	return func(p *PubSub) error {
+		if globalRate < 0 || peerRate < 0 {
+			return fmt.Errorf("bandwidth limits must be non-negative")
+		}
+
+		if globalRate > 0 {
+			p.shaper = newTokenBucket(globalRate, globalRate)
+		}
+		p.peerRate = peerRate
+		return nil
+	}
+}
+
+// shaping returns true if outbound bandwidth shaping is enabled.
+func (p *PubSub) shaping() bool {
+	return p.shaper != nil || p.peerRate > 0
+}
+
+// queueDelay returns the outbound queue delay for a peer.
+// Only called from processLoop.
+func (p *PubSub) queueDelay(pid peer.ID) time.Duration {
+	q, ok := p.peers[pid]
+	if !ok {
+		return 0
+	}
+	return q.Delay()
+}
+
+// tokenBucket is a token bucket rate limiter, which allows going into debt so that frames
+// larger than the burst size can be sent once the debt they incur has been repaid.
+type tokenBucket struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accrued since the last refill; the lock must be held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Delay returns the time until the bucket is out of debt.
+func (b *tokenBucket) Delay() time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refill(time.Now())
+	return b.delay()
+}
+
+func (b *tokenBucket) delay() time.Duration {
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Reserve takes n tokens from the bucket, returning the time to wait before sending, until
+// the bucket is out of the debt incurred by the reservation.
+func (b *tokenBucket) Reserve(n int) time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	return b.delay()
+}
+
+// peerShaper shapes the outbound traffic to a peer, with the peer and global token buckets.
+type peerShaper struct {
+	global *tokenBucket
+	peer   *tokenBucket
+}
+
+func (p *PubSub) newPeerShaper() *peerShaper {
+	if !p.shaping() {
+		return nil
+	}
+
+	s := &peerShaper{global: p.shaper}
+	if p.peerRate > 0 {
+		s.peer = newTokenBucket(p.peerRate, p.peerRate)
+	}
+	return s
+}
+
+// Delay returns the time until we can send.
+func (s *peerShaper) Delay() time.Duration {
+	var delay time.Duration
+	if s.global != nil {
+		delay = s.global.Delay()
+	}
+	if s.peer != nil {
+		if d := s.peer.Delay(); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// Wait reserves n bytes of bandwidth and waits until they can be sent.
+func (s *peerShaper) Wait(ctx context.Context, n int) error {
+	var delay time.Duration
+	if s.global != nil {
+		delay = s.global.Reserve(n)
+	}
+	if s.peer != nil {
+		if d := s.peer.Reserve(n); d > delay {
+			delay = d
+		}
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(1000, 1000)
+
+	// the burst is available immediately
+	if d := b.Reserve(1000); d != 0 {
+		t.Fatalf("expected no delay, got %s", d)
+	}
+
+	// but frames past it wait for the debt they incur to be repaid
+	d := b.Reserve(500)
+	if d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Fatalf("expected ~500ms delay, got %s", d)
+	}
+	d = b.Reserve(100)
+	if d < 500*time.Millisecond || d > 600*time.Millisecond {
+		t.Fatalf("expected ~600ms delay, got %s", d)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	d = b.Delay()
+	if d < 300*time.Millisecond || d > 400*time.Millisecond {
+		t.Fatalf("expected ~400ms delay, got %s", d)
+	}
+
+	// a frame larger than the bucket waits for the excess to be repaid, even with a full bucket
+	b = newTokenBucket(1000, 1000)
+	d = b.Reserve(2500)
+	if d < 1400*time.Millisecond || d > 1500*time.Millisecond {
+		t.Fatalf("expected ~1500ms delay, got %s", d)
+	}
+}
+
+type shapeTracer struct {
+	mx     sync.Mutex
+	shaped int
+}
+
+func (t *shapeTracer) Trace(evt *pb.TraceEvent) {
+	if evt.GetType() != pb.TraceEvent_SHAPE_RPC {
+		return
+	}
+
+	t.mx.Lock()
+	t.shaped++
+	t.mx.Unlock()
+}
+
+func TestOutboundBandwidthLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orig := OutboundShapingMaxDelay
+	OutboundShapingMaxDelay = 500 * time.Millisecond
+	defer func() {
+		OutboundShapingMaxDelay = orig
+	}()
+
+	tracer := &shapeTracer{}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithOutboundBandwidthLimit(0, 5000), WithEventTracer(tracer)),
+		getGossipsub(ctx, hosts[1]),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second)
+
+	// publish at 4x the rate limit for 2s
+	for i := 0; i < 40; i++ {
+		err := psubs[0].Publish("test", make([]byte, 1000+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	shaped := func() int {
+		tracer.mx.Lock()
+		defer tracer.mx.Unlock()
+		return tracer.shaped
+	}
+
+	// a coalesced frame holds the writer until its whole size has been paid for, which can
+	// take a few seconds at this rate, so we wait until every message has been accounted for
+	received := 0
+	for received+shaped() < 40 {
+		wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+		_, err := sub.Next(wctx)
+		wcancel()
+		if err != nil {
+			break
+		}
+		received++
+	}
+
+	// the messages that couldn't be sent within the max shaping delay were dropped
+	if received == 0 || received == 40 {
+		t.Fatalf("expected some messages to be shaped; received %d", received)
+	}
+
+	if n := shaped(); n+received != 40 {
+		t.Fatalf("expected %d shaped RPCs, got %d", 40-received, n)
+	}
+
+	// and the queue delay is exposed to the router
+	res := make(chan time.Duration, 1)
+	psubs[0].eval <- func() {
+		res <- psubs[0].queueDelay(hosts[1].ID())
+	}
+	if d := <-res; d == 0 {
+		t.Fatal("expected non-zero queue delay")
+	}
+}
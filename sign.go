@@ -71,7 +71,19 @@ func messagePubKey(m *pb.Message) (crypto.PubKey, error) {
 	return pubk, nil
 }
 
-func signMessage(pid peer.ID, key crypto.PrivKey, m *pb.Message) error {
+// Signer is an interface for signing outbound messages. Any crypto.PrivKey is a Signer, but
+// implementations may also delegate signing to an external service, keeping the private key
+// out of process memory.
+type Signer interface {
+	// Sign signs the given bytes, returning the signature.
+	Sign(data []byte) ([]byte, error)
+	// GetPublic returns the public key corresponding to the signing key.
+	GetPublic() crypto.PubKey
+}
+
+var _ Signer = (crypto.PrivKey)(nil)
+
+func signMessage(pid peer.ID, key Signer, m *pb.Message) error {
 	bytes, err := m.Marshal()
 	if err != nil {
 		return err
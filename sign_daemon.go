@@ -0,0 +1,151 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// Signing daemon protocol operations.
+//
+// The signing daemon protocol is a simple request/response protocol over a Unix socket,
+// with one request per connection. Requests consist of an operation byte followed by a
+// uvarint length-prefixed payload; responses consist of a status byte followed by a uvarint
+// length-prefixed payload, which is the result of the operation when the status is
+// SignDaemonStatusOK and an error message otherwise.
+const (
+	// SignDaemonOpPublicKey requests the marshalled public key of the signing key; the
+	// request payload is empty.
+	SignDaemonOpPublicKey = byte(1)
+	// SignDaemonOpSign requests a signature for the request payload.
+	SignDaemonOpSign = byte(2)
+
+	SignDaemonStatusOK    = byte(0)
+	SignDaemonStatusError = byte(1)
+)
+
+var (
+	// SignDaemonTimeout is the timeout for requests to the signing daemon.
+	SignDaemonTimeout = 5 * time.Second
+
+	// SignDaemonMaxResponseSize is the maximum size of a response from the signing daemon.
+	SignDaemonMaxResponseSize = 64 * 1024
+)
+
+// UnixSocketSigner is a Signer that delegates signing to a local signing daemon listening
+// on a Unix socket, so that the private key never enters process memory.
+type UnixSocketSigner struct {
+	path string
+	pubk crypto.PubKey
+}
+
+var _ Signer = (*UnixSocketSigner)(nil)
+
+// NewUnixSocketSigner creates a new signer for the signing daemon listening at path. The
+// public key is retrieved from the daemon once at construction time.
+func NewUnixSocketSigner(path string) (*UnixSocketSigner, error) {
+	s := &UnixSocketSigner{path: path}
+
+	res, err := s.request(SignDaemonOpPublicKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving public key from signing daemon: %w", err)
+	}
+
+	s.pubk, err = crypto.UnmarshalPublicKey(res)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling public key from signing daemon: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *UnixSocketSigner) Sign(data []byte) ([]byte, error) {
+	sig, err := s.request(SignDaemonOpSign, data)
+	if err != nil {
+		return nil, fmt.Errorf("error signing with signing daemon: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (s *UnixSocketSigner) GetPublic() crypto.PubKey {
+	return s.pubk
+}
+
+func (s *UnixSocketSigner) request(op byte, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", s.path, SignDaemonTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(SignDaemonTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(conn)
+	err = writeSignDaemonFrame(w, op, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	status, res, err := readSignDaemonFrame(bufio.NewReader(conn), SignDaemonMaxResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != SignDaemonStatusOK {
+		return nil, errors.New(string(res))
+	}
+
+	return res, nil
+}
+
+func writeSignDaemonFrame(w *bufio.Writer, tag byte, payload []byte) error {
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = tag
+	n := binary.PutUvarint(buf[1:], uint64(len(payload)))
+
+	_, err := w.Write(buf[:1+n])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func readSignDaemonFrame(r *bufio.Reader, maxSize int) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if size > uint64(maxSize) {
+		return 0, nil, fmt.Errorf("frame too large (%d bytes)", size)
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return tag, payload, nil
+}
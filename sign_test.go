@@ -1,7 +1,15 @@
 package pubsub
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
@@ -23,8 +31,8 @@ func TestSigning(t *testing.T) {
 	testSignVerify(t, privk)
 }
 
-func testSignVerify(t *testing.T, privk crypto.PrivKey) {
-	id, err := peer.IDFromPublicKey(privk.GetPublic())
+func testSignVerify(t *testing.T, signer Signer) {
+	id, err := peer.IDFromPublicKey(signer.GetPublic())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,9 +42,166 @@ func testSignVerify(t *testing.T, privk crypto.PrivKey) {
 		From:     []byte(id),
 		Seqno:    []byte("123"),
 	}
-	signMessage(id, privk, &m)
+	signMessage(id, signer, &m)
 	err = verifyMessageSignature(&m)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+// serveSignDaemon is a minimal signing daemon for testing the UnixSocketSigner.
+func serveSignDaemon(t *testing.T, l net.Listener, privk crypto.PrivKey) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			op, payload, err := readSignDaemonFrame(bufio.NewReader(conn), 1<<20)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			var res []byte
+			switch op {
+			case SignDaemonOpPublicKey:
+				res, err = privk.GetPublic().Bytes()
+			case SignDaemonOpSign:
+				res, err = privk.Sign(payload)
+			default:
+				err = fmt.Errorf("unknown op %d", op)
+			}
+
+			status := SignDaemonStatusOK
+			if err != nil {
+				status = SignDaemonStatusError
+				res = []byte(err.Error())
+			}
+
+			writeSignDaemonFrame(bufio.NewWriter(conn), status, res)
+		}(conn)
+	}
+}
+
+func TestUnixSocketSigner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	privk, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("unix", filepath.Join(dir, "signer.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveSignDaemon(t, l, privk)
+
+	signer, err := NewUnixSocketSigner(filepath.Join(dir, "signer.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSignVerify(t, signer)
+
+	// publish with the signer as the author
+	author, err := peer.IDFromPublicKey(privk.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithMessageSigner(signer)),
+		getPubsub(ctx, hosts[1]),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = psubs[0].Publish("test", []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetFrom() != author {
+		t.Fatalf("expected message from %s, got %s", author, msg.GetFrom())
+	}
+}
+
+func TestNilMessageSigner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	_, err := NewFloodSub(ctx, hosts[0], WithMessageSigner(nil))
+	if err == nil {
+		t.Fatal("expected an error for a nil message signer")
+	}
+}
+
+func TestMessageSignerOptionOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+
+	// a signer whose key is not in the peerstore
+	signer, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := peer.IDFromPublicKey(signer.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the custom signer is kept regardless of the order of the options
+	for _, opts := range [][]Option{
+		{WithMessageSigner(signer), WithMessageSigning(true)},
+		{WithMessageSigning(true), WithMessageSigner(signer)},
+		{WithMessageSigner(signer), WithMessageAuthor(author)},
+		{WithMessageAuthor(author), WithMessageSigner(signer)},
+	} {
+		ps, err := NewFloodSub(ctx, hosts[0], opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ps.signer != signer || ps.signID != author {
+			t.Fatal("expected the custom signer to be kept")
+		}
+	}
+
+	// and conflicting options are rejected in either order
+	for _, opts := range [][]Option{
+		{WithMessageSigner(signer), WithMessageSigning(false)},
+		{WithMessageSigning(false), WithMessageSigner(signer)},
+		{WithMessageSigner(signer), WithMessageAuthor(hosts[0].ID())},
+		{WithMessageAuthor(hosts[0].ID()), WithMessageSigner(signer)},
+	} {
+		_, err := NewFloodSub(ctx, hosts[0], opts...)
+		if err == nil {
+			t.Fatal("expected an error for conflicting signing options")
+		}
+	}
+}
@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"context"
+	"sync"
 )
 
 // Subscription handles the details of a particular Topic subscription.
@@ -12,6 +13,11 @@ type Subscription struct {
 	cancelCh chan<- *Subscription
 	ctx      context.Context
 	err      error
+
+	// reassembler for chunked messages; nil if the topic doesn't use chunking.
+	// Next may be called concurrently, so the reassembler is protected by reasmMx.
+	reasmMx sync.Mutex
+	reasm   *chunkReassembler
 }
 
 // Topic returns the topic string associated with the Subscription
@@ -21,15 +27,27 @@ func (sub *Subscription) Topic() string {
 
 // Next returns the next message in our subscription
 func (sub *Subscription) Next(ctx context.Context) (*Message, error) {
-	select {
-	case msg, ok := <-sub.ch:
-		if !ok {
-			return msg, sub.err
-		}
+	for {
+		select {
+		case msg, ok := <-sub.ch:
+			if !ok {
+				return msg, sub.err
+			}
 
-		return msg, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
+			if sub.reasm == nil || msg.Chunk == nil {
+				return msg, nil
+			}
+
+			sub.reasmMx.Lock()
+			msg = sub.reasm.Add(msg)
+			sub.reasmMx.Unlock()
+
+			if msg != nil {
+				return msg, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 }
 
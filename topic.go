@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
@@ -19,6 +20,17 @@ type Topic struct {
 	p     *PubSub
 	topic string
 
+	// author and signer for messages published in this topic, overriding the PubSub default;
+	// signer is nil when the topic uses the default author or signing is disabled.
+	signID peer.ID
+	signer Signer
+
+	// messages larger than chunkSize are published in fragments; 0 if chunking is disabled
+	chunkSize int
+
+	// hooks run in the event loop when the topic is registered and when it is closed
+	onAdd, onRemove []func()
+
 	evtHandlerMux sync.RWMutex
 	evtHandlers   map[*TopicEventHandler]struct{}
 
@@ -98,6 +110,10 @@ func (t *Topic) Subscribe(opts ...SubOpt) (*Subscription, error) {
 		ctx:   t.p.ctx,
 	}
 
+	if t.chunkSize > 0 {
+		sub.reasm = newChunkReassembler(ChunkReassemblyTimeout, ChunkReassemblyMemoryLimit)
+	}
+
 	for _, opt := range opts {
 		err := opt(sub)
 		if err != nil {
@@ -125,7 +141,10 @@ func (t *Topic) Subscribe(opts ...SubOpt) (*Subscription, error) {
 type RouterReady func(rt PubSubRouter, topic string) (bool, error)
 
 type PublishOptions struct {
-	ready RouterReady
+	ready    RouterReady
+	author   peer.ID
+	ttl      time.Duration
+	hopLimit *uint32
 }
 
 type PubOpt func(pub *PublishOptions) error
@@ -138,41 +157,163 @@ func (t *Topic) Publish(ctx context.Context, data []byte, opts ...PubOpt) error
 		return ErrTopicClosed
 	}
 
-	seqno := t.p.nextSeqno()
-	id := t.p.host.ID()
+	pub := &PublishOptions{}
+	for _, opt := range opts {
+		err := opt(pub)
+		if err != nil {
+			return err
+		}
+	}
+
+	author, signer, err := t.getAuthor(pub.author)
+	if err != nil {
+		return err
+	}
+
+	if t.chunkSize > 0 && len(data) > t.chunkSize {
+		frags, chunks := chunkData(data, t.chunkSize)
+		msgs := make([]*pb.Message, 0, len(frags))
+		for i := range frags {
+			m, err := t.newMessage(frags[i], chunks[i], author, signer, pub)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, m)
+		}
+		return t.publish(ctx, pub, msgs...)
+	}
+
+	m, err := t.newMessage(data, nil, author, signer, pub)
+	if err != nil {
+		return err
+	}
+
+	return t.publish(ctx, pub, m)
+}
+
+func (t *Topic) newMessage(data []byte, chunk *pb.MessageChunk, author peer.ID, signer Signer, pub *PublishOptions) (*pb.Message, error) {
+	seqno, err := t.p.nextSeqno()
+	if err != nil {
+		return nil, err
+	}
+
 	m := &pb.Message{
 		Data:     data,
 		TopicIDs: []string{t.topic},
-		From:     []byte(id),
+		From:     []byte(author),
 		Seqno:    seqno,
+		HopLimit: pub.hopLimit,
+		Chunk:    chunk,
+	}
+	if pub.ttl > 0 {
+		expiry := time.Now().Add(pub.ttl).UnixNano()
+		m.Expiry = &expiry
 	}
-	if t.p.signKey != nil {
-		m.From = []byte(t.p.signID)
-		err := signMessage(t.p.signID, t.p.signKey, m)
+	if signer != nil {
+		err := signMessage(author, signer, m)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	pub := &PublishOptions{}
-	for _, opt := range opts {
-		err := opt(pub)
+	return m, nil
+}
+
+func (t *Topic) publish(ctx context.Context, pub *PublishOptions, msgs ...*pb.Message) error {
+	if pub.ready != nil {
+		t.p.disc.Bootstrap(ctx, t.topic, pub.ready)
+	}
+
+	id := t.p.host.ID()
+	for _, m := range msgs {
+		select {
+		case t.p.publish <- &Message{Message: m, ReceivedFrom: id}:
+		case <-t.p.ctx.Done():
+			return t.p.ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// getAuthor returns the author and signer for a message published in the topic; the author
+// is the per publish author if set, then the topic author and finally the PubSub author.
+// The signer is nil if message signing is disabled.
+func (t *Topic) getAuthor(author peer.ID) (peer.ID, Signer, error) {
+	if author == "" {
+		if t.signID != "" {
+			return t.signID, t.signer, nil
+		}
+
+		if t.p.signer == nil {
+			return t.p.host.ID(), nil, nil
+		}
+
+		return t.p.signID, t.p.signer, nil
+	}
+
+	signer, err := t.p.getSigner(author)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return author, signer, nil
+}
+
+// WithTopicMessageAuthor is a topic option that sets the author for messages published in
+// the topic, overriding the author set with WithMessageAuthor. If message signing is enabled,
+// the private key must be available in the host's peerstore.
+func WithTopicMessageAuthor(author peer.ID) TopicOpt {
+	return func(t *Topic) error {
+		signer, err := t.p.getSigner(author)
 		if err != nil {
 			return err
 		}
+
+		t.signID = author
+		t.signer = signer
+		return nil
 	}
+}
 
-	if pub.ready != nil {
-		t.p.disc.Bootstrap(ctx, t.topic, pub.ready)
+// WithPublishAuthor returns a publishing option that sets the author of the published message,
+// overriding the topic and PubSub authors. If message signing is enabled, the private key must
+// be available in the host's peerstore.
+func WithPublishAuthor(author peer.ID) PubOpt {
+	return func(pub *PublishOptions) error {
+		pub.author = author
+		return nil
 	}
+}
 
-	select {
-	case t.p.publish <- &Message{m, id, nil}:
-	case <-t.p.ctx.Done():
-		return t.p.ctx.Err()
+// WithMessageTTL returns a publishing option that sets an expiration time for the message,
+// after which peers will neither deliver, forward nor serve it from their message cache.
+// The expiration time is signed and uses the wall clock, so the TTL should account for
+// clock skew between peers.
+func WithMessageTTL(ttl time.Duration) PubOpt {
+	return func(pub *PublishOptions) error {
+		if ttl <= 0 {
+			return fmt.Errorf("message TTL must be positive")
+		}
+		pub.ttl = ttl
+		return nil
 	}
+}
 
-	return nil
+// WithHopLimit returns a publishing option that limits the number of hops the message may
+// travel; a hop limit of 1 delivers the message to our direct peers only.
+// The hop limit is signed, but the hop count is not: forwarders can't re-sign the message, so
+// the count is carried in the RPC envelope instead, where a malicious peer can reset it. The
+// limit is a propagation hint rather than a security mechanism.
+// Peers that don't support hop limits forward the message without counting the hop.
+func WithHopLimit(limit uint32) PubOpt {
+	return func(pub *PublishOptions) error {
+		if limit == 0 {
+			return fmt.Errorf("hop limit must be positive")
+		}
+		pub.hopLimit = &limit
+		return nil
+	}
 }
 
 // WithReadiness returns a publishing option for only publishing when the router is ready.
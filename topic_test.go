@@ -8,6 +8,9 @@ import (
 	"testing"
 	"time"
 
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -577,3 +580,199 @@ func readAllQueuedEvents(ctx context.Context, t *testing.T, evt *TopicEventHandl
 	}
 	return peerState
 }
+
+func TestTopicMessageAuthor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts)
+	connectAll(t, hosts)
+
+	// add a service identity to the sender's peerstore
+	privk, pubk, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := peer.IDFromPublicKey(pubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hosts[0].Peerstore().AddPrivKey(service, privk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// authors without a key in the peerstore are rejected
+	_, err = psubs[0].Join("bogus", WithTopicMessageAuthor(hosts[1].ID()))
+	if err == nil {
+		t.Fatal("expected error joining topic with an author without a private key")
+	}
+
+	serviceTopic, err := psubs[0].Join("service", WithTopicMessageAuthor(service))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeTopic, err := psubs[0].Join("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serviceSub, err := psubs[1].Subscribe("service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeSub, err := psubs[1].Subscribe("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	checkAuthor := func(sub *Subscription, author peer.ID) {
+		t.Helper()
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetFrom() != author {
+			t.Fatalf("expected message from %s, got %s", author, msg.GetFrom())
+		}
+	}
+
+	err = serviceTopic.Publish(ctx, []byte("service message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAuthor(serviceSub, service)
+
+	err = nodeTopic.Publish(ctx, []byte("node message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAuthor(nodeSub, hosts[0].ID())
+
+	// per publish authors override the topic author
+	err = serviceTopic.Publish(ctx, []byte("node message"), WithPublishAuthor(hosts[0].ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAuthor(serviceSub, hosts[0].ID())
+
+	err = nodeTopic.Publish(ctx, []byte("service message"), WithPublishAuthor(service))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAuthor(nodeSub, service)
+}
+
+func TestMessageHopLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getPubsubs(ctx, hosts)
+	topics := getTopics(psubs, "test")
+
+	// a line topology: 0 - 1 - 2
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+
+	var subs []*Subscription
+	for _, topic := range topics[1:] {
+		sub, err := topic.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err := topics[0].Publish(ctx, []byte("one hop"), WithHopLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, subs[0], []byte("one hop"))
+
+	err = topics[0].Publish(ctx, []byte("two hops"), WithHopLimit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, subs[0], []byte("two hops"))
+
+	// the first message was not forwarded past the first hop
+	msg, err := subs[1].Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.GetData(), []byte("two hops")) {
+		t.Fatalf("expected the two hops message, got %s", msg.GetData())
+	}
+
+	// the hop count is not part of the message, so peers that don't support hop limits can
+	// verify the signature of a message that has been forwarded
+	if len(msg.XXX_unrecognized) != 0 {
+		t.Fatal("expected no unknown fields in the forwarded message")
+	}
+	err = baselineVerify(msg.Message)
+	if err != nil {
+		t.Fatalf("baseline signature verification failed for the forwarded message: %s", err)
+	}
+}
+
+// baselineVerify verifies the signature of a message like peers that don't support hop limits,
+// without discounting any field but the signature and key.
+func baselineVerify(m *pb.Message) error {
+	pubk, err := messagePubKey(m)
+	if err != nil {
+		return err
+	}
+
+	xm := *m
+	xm.Signature = nil
+	xm.Key = nil
+	data, err := xm.Marshal()
+	if err != nil {
+		return err
+	}
+
+	valid, err := pubk.Verify(withSignPrefix(data), m.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func TestMessageExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts)
+	topics := getTopics(psubs, "test")
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := topics[1].Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = topics[0].Publish(ctx, []byte("expired"), WithMessageTTL(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = topics[0].Publish(ctx, []byte("fresh"), WithMessageTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertReceive(t, sub, []byte("fresh"))
+}
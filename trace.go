@@ -1,6 +1,7 @@
 package pubsub
 
 import (
+	"context"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -32,10 +33,26 @@ type scoreTracer interface {
 type pubsubTracer struct {
 	tracer EventTracer
 	score  scoreTracer
+	gossip *gossipTracer
 	pid    peer.ID
 	msgID  MsgIdFunction
 }
 
+// flush waits until the buffered events of the event tracer have been written, if it is one of
+// the tracers of this package; the tracer is left open.
+func (t *pubsubTracer) flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	tr, ok := t.tracer.(interface{ flush(context.Context) error })
+	if !ok {
+		return nil
+	}
+
+	return tr.flush(ctx)
+}
+
 func (t *pubsubTracer) PublishMessage(msg *Message) {
 	if t == nil {
 		return
@@ -67,6 +84,10 @@ func (t *pubsubTracer) ValidateMessage(msg *Message) {
 	if t.score != nil && msg.ReceivedFrom != t.pid {
 		t.score.ValidateMessage(msg)
 	}
+
+	if t.gossip != nil {
+		t.gossip.ValidateMessage(msg)
+	}
 }
 
 func (t *pubsubTracer) RejectMessage(msg *Message, reason string) {
@@ -78,6 +99,10 @@ func (t *pubsubTracer) RejectMessage(msg *Message, reason string) {
 		t.score.RejectMessage(msg, reason)
 	}
 
+	if t.gossip != nil {
+		t.gossip.RejectMessage(msg, reason)
+	}
+
 	if t.tracer == nil {
 		return
 	}
@@ -133,6 +158,10 @@ func (t *pubsubTracer) DeliverMessage(msg *Message) {
 		t.score.DeliverMessage(msg)
 	}
 
+	if t.gossip != nil {
+		t.gossip.DeliverMessage(msg)
+	}
+
 	if t.tracer == nil {
 		return
 	}
@@ -250,6 +279,16 @@ func (t *pubsubTracer) SendRPC(rpc *RPC, p peer.ID) {
 	t.tracer.Trace(evt)
 }
 
+// WriteRPC is called by the peer writer when an RPC has been written to the stream; unlike the
+// other RPC events, it is not traced, as the RPC has already been traced by SendRPC.
+func (t *pubsubTracer) WriteRPC(rpc *RPC, p peer.ID) {
+	if t == nil {
+		return
+	}
+
+	t.gossip.WriteRPC(rpc, p)
+}
+
 func (t *pubsubTracer) DropRPC(rpc *RPC, p peer.ID) {
 	if t == nil {
 		return
@@ -273,6 +312,31 @@ func (t *pubsubTracer) DropRPC(rpc *RPC, p peer.ID) {
 	t.tracer.Trace(evt)
 }
 
+func (t *pubsubTracer) ShapeRPC(rpc *RPC, p peer.ID, delay time.Duration) {
+	if t == nil {
+		return
+	}
+
+	if t.tracer == nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	queueDelay := int64(delay)
+	evt := &pb.TraceEvent{
+		Type:      pb.TraceEvent_SHAPE_RPC.Enum(),
+		PeerID:    []byte(t.pid),
+		Timestamp: &now,
+		ShapeRPC: &pb.TraceEvent_ShapeRPC{
+			SendTo:     []byte(p),
+			Meta:       t.traceRPCMeta(rpc),
+			QueueDelay: &queueDelay,
+		},
+	}
+
+	t.tracer.Trace(evt)
+}
+
 func (t *pubsubTracer) traceRPCMeta(rpc *RPC) *pb.TraceEvent_RPCMeta {
 	rpcMeta := new(pb.TraceEvent_RPCMeta)
 
@@ -34,14 +34,21 @@ const (
 	rejectValidationThrottled = "validation throttled"
 	rejectValidationFailed    = "validation failed"
 	rejectSelfOrigin          = "self originated message"
+	rejectReplayedSeqno       = "replayed sequence number"
+	rejectMessageExpired      = "expired message"
+	rejectHopLimitExceeded    = "hop limit exceeded"
 )
 
 type basicTracer struct {
-	ch     chan struct{}
+	ch chan struct{}
+	// closed by the writer when it has written the buffered events after the tracer is closed
+	done   chan struct{}
 	mx     sync.Mutex
 	buf    []*pb.TraceEvent
 	lossy  bool
 	closed bool
+	// pending flushes, closed by the writer once it has written the events buffered before them
+	flushes []chan struct{}
 }
 
 func (t *basicTracer) Trace(evt *pb.TraceEvent) {
@@ -73,6 +80,48 @@ func (t *basicTracer) Close() {
 	}
 }
 
+// flush waits until the events buffered so far have been written, without closing the tracer.
+func (t *basicTracer) flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	t.mx.Lock()
+	if t.closed {
+		// the writer writes the remaining events before exiting
+		flushed = t.done
+	} else {
+		t.flushes = append(t.flushes, flushed)
+	}
+	t.mx.Unlock()
+
+	select {
+	case t.ch <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeFlushes returns the pending flushes, to be acknowledged once the buffered events have
+// been written; the lock must be held.
+func (t *basicTracer) takeFlushes() []chan struct{} {
+	flushes := t.flushes
+	t.flushes = nil
+	return flushes
+}
+
+func ackFlushes(flushes []chan struct{}) {
+	for _, ch := range flushes {
+		close(ch)
+	}
+}
+
 // JSONTracer is a tracer that writes events to a file, encoded in ndjson.
 type JSONTracer struct {
 	basicTracer
@@ -91,13 +140,15 @@ func OpenJSONTracer(file string, flags int, perm os.FileMode) (*JSONTracer, erro
 		return nil, err
 	}
 
-	tr := &JSONTracer{w: f, basicTracer: basicTracer{ch: make(chan struct{}, 1)}}
+	tr := &JSONTracer{w: f, basicTracer: basicTracer{ch: make(chan struct{}, 1), done: make(chan struct{})}}
 	go tr.doWrite()
 
 	return tr, nil
 }
 
 func (t *JSONTracer) doWrite() {
+	defer close(t.done)
+
 	var buf []*pb.TraceEvent
 	enc := json.NewEncoder(t.w)
 	for {
@@ -107,6 +158,7 @@ func (t *JSONTracer) doWrite() {
 		tmp := t.buf
 		t.buf = buf[:0]
 		buf = tmp
+		flushes := t.takeFlushes()
 		t.mx.Unlock()
 
 		for i, evt := range buf {
@@ -116,6 +168,7 @@ func (t *JSONTracer) doWrite() {
 			}
 			buf[i] = nil
 		}
+		ackFlushes(flushes)
 
 		if !ok {
 			t.w.Close()
@@ -143,13 +196,15 @@ func OpenPBTracer(file string, flags int, perm os.FileMode) (*PBTracer, error) {
 		return nil, err
 	}
 
-	tr := &PBTracer{w: f, basicTracer: basicTracer{ch: make(chan struct{}, 1)}}
+	tr := &PBTracer{w: f, basicTracer: basicTracer{ch: make(chan struct{}, 1), done: make(chan struct{})}}
 	go tr.doWrite()
 
 	return tr, nil
 }
 
 func (t *PBTracer) doWrite() {
+	defer close(t.done)
+
 	var buf []*pb.TraceEvent
 	w := ggio.NewDelimitedWriter(t.w)
 	for {
@@ -159,6 +214,7 @@ func (t *PBTracer) doWrite() {
 		tmp := t.buf
 		t.buf = buf[:0]
 		buf = tmp
+		flushes := t.takeFlushes()
 		t.mx.Unlock()
 
 		for i, evt := range buf {
@@ -168,6 +224,7 @@ func (t *PBTracer) doWrite() {
 			}
 			buf[i] = nil
 		}
+		ackFlushes(flushes)
 
 		if !ok {
 			t.w.Close()
@@ -190,13 +247,15 @@ type RemoteTracer struct {
 
 // NewRemoteTracer constructs a RemoteTracer, tracing to the peer identified by pi
 func NewRemoteTracer(ctx context.Context, host host.Host, pi peer.AddrInfo) (*RemoteTracer, error) {
-	tr := &RemoteTracer{ctx: ctx, host: host, peer: pi.ID, basicTracer: basicTracer{ch: make(chan struct{}, 1), lossy: true}}
+	tr := &RemoteTracer{ctx: ctx, host: host, peer: pi.ID, basicTracer: basicTracer{ch: make(chan struct{}, 1), done: make(chan struct{}), lossy: true}}
 	host.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.PermanentAddrTTL)
 	go tr.doWrite()
 	return tr, nil
 }
 
 func (t *RemoteTracer) doWrite() {
+	defer close(t.done)
+
 	var buf []*pb.TraceEvent
 
 	s, err := t.openStream()
@@ -217,7 +276,7 @@ func (t *RemoteTracer) doWrite() {
 		deadline := time.Now().Add(time.Second)
 
 		t.mx.Lock()
-		for len(t.buf) < MinTraceBatchSize && time.Now().Before(deadline) {
+		for len(t.buf) < MinTraceBatchSize && len(t.flushes) == 0 && time.Now().Before(deadline) {
 			t.mx.Unlock()
 			time.Sleep(100 * time.Millisecond)
 			t.mx.Lock()
@@ -226,6 +285,7 @@ func (t *RemoteTracer) doWrite() {
 		tmp := t.buf
 		t.buf = buf[:0]
 		buf = tmp
+		flushes := t.takeFlushes()
 		t.mx.Unlock()
 
 		if len(buf) == 0 {
@@ -251,6 +311,7 @@ func (t *RemoteTracer) doWrite() {
 		for i := range buf {
 			buf[i] = nil
 		}
+		ackFlushes(flushes)
 
 		if !ok {
 			if err != nil {
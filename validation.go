@@ -45,6 +45,9 @@ type validation struct {
 
 	// this is the number of synchronous validation workers
 	validateWorkers int
+
+	// sequence number replay protection; nil when disabled
+	replay *replayFilter
 }
 
 // validation requests
@@ -210,6 +213,15 @@ func (v *validation) validate(vals []*topicVal, src peer.ID, msg *Message) {
 		v.tracer.ValidateMessage(msg)
 	}
 
+	// reject replays of old signed messages; this is done after marking the message as seen,
+	// so that plain duplicates are not mistaken for replays. The sequence number is only
+	// recorded once the message has passed validation, see acceptReplay.
+	if v.replay != nil && msg.Signature != nil && !v.replay.Check(msg) {
+		log.Warningf("message sequence number replayed; dropping message from %s", src)
+		v.tracer.RejectMessage(msg, rejectReplayedSeqno)
+		return
+	}
+
 	var inline, async []*topicVal
 	for _, val := range vals {
 		if val.validateInline {
@@ -244,7 +256,22 @@ func (v *validation) validate(vals []*topicVal, src peer.ID, msg *Message) {
 	}
 
 	// no async validators, send the message
-	v.p.sendMsg <- msg
+	if v.acceptReplay(src, msg) {
+		v.p.sendMsg <- msg
+	}
+}
+
+// acceptReplay records the sequence number of a validated message for replay protection;
+// it returns false if a message with the same sequence number has been accepted while
+// the message was being validated.
+func (v *validation) acceptReplay(src peer.ID, msg *Message) bool {
+	if v.replay == nil || msg.Signature == nil || v.replay.Accept(msg) {
+		return true
+	}
+
+	log.Warningf("message sequence number replayed; dropping message from %s", src)
+	v.tracer.RejectMessage(msg, rejectReplayedSeqno)
+	return false
 }
 
 func (v *validation) validateSignature(msg *Message) bool {
@@ -264,7 +291,9 @@ func (v *validation) doValidateTopic(vals []*topicVal, src peer.ID, msg *Message
 		return
 	}
 
-	v.p.sendMsg <- msg
+	if v.acceptReplay(src, msg) {
+		v.p.sendMsg <- msg
+	}
 }
 
 func (v *validation) validateTopic(vals []*topicVal, src peer.ID, msg *Message) bool {